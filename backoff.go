@@ -0,0 +1,121 @@
+package grmln
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+// Backoff determines how long to wait between connection attempts
+type Backoff interface {
+	// Next returns how long to wait after the given number of failed attempts. prev is the
+	// previous wait (0 after the first failure). Returning false gives up on the host permanently.
+	Next(attempts int, prev time.Duration) (time.Duration, bool)
+}
+
+// DecorrelatedJitterBackoff waits a random duration between Base and three times the previous wait, capped at Max
+type DecorrelatedJitterBackoff struct {
+	Base time.Duration
+	Max  time.Duration
+}
+
+// Next implements Backoff
+func (b DecorrelatedJitterBackoff) Next(attempts int, prev time.Duration) (time.Duration, bool) {
+	if prev < b.Base {
+		return b.Base, true
+	}
+
+	upper := int64(prev) * 3
+	base := int64(b.Base)
+	if upper <= base {
+		return b.Base, true
+	}
+
+	return time.Duration(
+		math.Min(
+			float64(b.Max),
+			float64(rand.Int63n(upper-base)+base),
+		),
+	), true
+}
+
+// ExponentialBackoff multiplies the wait by Multiplier after every attempt, capped at Max
+type ExponentialBackoff struct {
+	Base time.Duration
+	Max  time.Duration
+
+	// Multiplier defaults to 2
+	Multiplier float64
+
+	// Jitter is the fraction (0-1) of each wait that is randomly removed
+	Jitter float64
+}
+
+// Next implements Backoff
+func (b ExponentialBackoff) Next(attempts int, prev time.Duration) (time.Duration, bool) {
+	multiplier := b.Multiplier
+	if multiplier <= 0 {
+		multiplier = 2
+	}
+
+	if b.Base <= 0 {
+		return 0, true
+	}
+
+	// Without Max the wait keeps growing, past what a Duration can hold
+	limit := float64(math.MaxInt64)
+	if b.Max > 0 {
+		limit = float64(b.Max)
+	}
+	sleep := math.Min(limit, float64(b.Base)*math.Pow(multiplier, float64(attempts-1)))
+
+	if b.Jitter > 0 {
+		sleep -= sleep * b.Jitter * rand.Float64()
+	}
+
+	if sleep >= float64(math.MaxInt64) {
+		return time.Duration(math.MaxInt64), true
+	}
+	return time.Duration(sleep), true
+}
+
+// ConstantBackoff always waits Delay
+type ConstantBackoff struct {
+	Delay time.Duration
+}
+
+// Next implements Backoff
+func (b ConstantBackoff) Next(attempts int, prev time.Duration) (time.Duration, bool) {
+	return b.Delay, true
+}
+
+// MaxAttemptsBackoff gives up once MaxAttempts connection attempts have failed
+type MaxAttemptsBackoff struct {
+	Backoff
+	MaxAttempts int
+}
+
+// Next implements Backoff
+func (b MaxAttemptsBackoff) Next(attempts int, prev time.Duration) (time.Duration, bool) {
+	if attempts >= b.MaxAttempts {
+		return 0, false
+	}
+
+	return b.Backoff.Next(attempts, prev)
+}
+
+// Clock provides timers to the cluster. It can be replaced for deterministic tests
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
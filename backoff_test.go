@@ -0,0 +1,146 @@
+package grmln
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock only moves when told to. Timers move the clock forward and fire immediately, or never
+// fire when block is set so the test controls when they would have. Requested durations are sent
+// to sleeps when it isn't nil
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	block  bool
+	sleeps chan time.Duration
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	if c.sleeps != nil {
+		c.sleeps <- d
+	}
+
+	ch := make(chan time.Time, 1)
+	if !c.block {
+		ch <- c.advance(d)
+	}
+	return ch
+}
+
+func (c *fakeClock) advance(d time.Duration) time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	return c.now
+}
+
+func TestDecorrelatedJitterBackoff(t *testing.T) {
+	b := DecorrelatedJitterBackoff{Base: time.Millisecond, Max: time.Millisecond * 50}
+
+	var sleep time.Duration
+	for i := 1; i <= 100; i++ {
+		prev := sleep
+		sleep, _ = b.Next(i, prev)
+
+		if sleep < b.Base || sleep > b.Max {
+			t.Fatalf("attempt %d: sleep %v out of range [%v, %v]", i, sleep, b.Base, b.Max)
+		}
+		if prev != 0 && sleep > prev*3 {
+			t.Fatalf("attempt %d: sleep %v exceeds 3 * %v", i, sleep, prev)
+		}
+	}
+}
+
+func TestExponentialBackoff(t *testing.T) {
+	b := ExponentialBackoff{Base: time.Millisecond, Max: time.Millisecond * 10}
+
+	expected := []time.Duration{1, 2, 4, 8, 10, 10}
+	for i, e := range expected {
+		t.Run(fmt.Sprintf("attempt %d", i+1), func(t *testing.T) {
+			actual, ok := b.Next(i+1, 0)
+			if !ok {
+				t.Fatal("expected retry")
+			}
+			if actual != e*time.Millisecond {
+				t.Fatalf("expected %v but got %v", e*time.Millisecond, actual)
+			}
+		})
+	}
+}
+
+// TestExponentialBackoffUnbounded ensures waits without Max stop growing rather than overflowing
+func TestExponentialBackoffUnbounded(t *testing.T) {
+	b := ExponentialBackoff{Base: time.Second, Jitter: 0.5}
+
+	prev := time.Duration(0)
+	for _, attempts := range []int{1, 10, 40, 64, 100, 1000, 100000} {
+		actual, ok := b.Next(attempts, prev)
+		if !ok {
+			t.Fatal("expected retry")
+		}
+		if actual <= 0 {
+			t.Fatalf("attempt %d: expected a positive wait but got %v", attempts, actual)
+		}
+		prev = actual
+	}
+
+	b.Jitter = 0
+	if actual, _ := b.Next(1000, 0); actual != time.Duration(math.MaxInt64) {
+		t.Fatalf("expected the longest wait but got %v", actual)
+	}
+}
+
+// TestClusterGiveUp ensures a host is abandoned once the backoff gives up
+func TestClusterGiveUp(t *testing.T) {
+	const addr = "ws://127.0.0.1:1/gremlin"
+
+	clock := newFakeClock()
+	clock.sleeps = make(chan time.Duration, 10)
+	events := make(chan Event, 1)
+
+	c := NewCluster(ClusterConfig{
+		Backoff: MaxAttemptsBackoff{
+			Backoff:     ConstantBackoff{Delay: time.Hour},
+			MaxAttempts: 3,
+		},
+		Clock:   clock,
+		OnEvent: func(e Event) { events <- e },
+	}, addr)
+	defer c.Close()
+
+	select {
+	case e := <-events:
+		gaveUp, ok := e.(HostGaveUpEvent)
+		if !ok {
+			t.Fatalf("expected HostGaveUpEvent but got %T", e)
+		}
+		if gaveUp.Addr != addr || gaveUp.Attempts != 3 {
+			t.Fatalf("unexpected event %+v", gaveUp)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("cluster never gave up on host")
+	}
+
+	if n := len(clock.sleeps); n != 2 {
+		t.Fatalf("expected 2 backoff sleeps but got %d", n)
+	}
+
+	err := c.ProcessRequest(context.Background(), NewRequest("", processorDefault, opEval, EvalArgs{Gremlin: "g.V()"}))
+	if !IsNoHostsAvailable(err) {
+		t.Fatalf("expected no hosts available error but got %v", err)
+	}
+}
@@ -0,0 +1,328 @@
+package grmln
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Circuit breaker defaults
+const (
+	DefaultBreakerWindow           = time.Second * 10
+	DefaultBreakerMinRequests      = 10
+	DefaultBreakerErrorRate        = 0.5
+	DefaultBreakerSlowRate         = 0.5
+	DefaultBreakerOpenTimeout      = time.Second * 30
+	DefaultBreakerHalfOpenRequests = 1
+)
+
+// breakerBuckets is the number of buckets the sliding window is divided into
+const breakerBuckets = 10
+
+// breakerRecheckInterval is how often a request waiting for a connection checks whether a host's
+// breaker has started allowing requests again
+const breakerRecheckInterval = time.Millisecond * 10
+
+// BreakerState is the state of a host's circuit breaker
+type BreakerState int
+
+// Breaker states
+const (
+	// BreakerClosed means requests flow to the host normally
+	BreakerClosed BreakerState = iota
+	// BreakerOpen means the host is not sent any requests
+	BreakerOpen
+	// BreakerHalfOpen means a limited number of trial requests are sent to the host
+	BreakerHalfOpen
+)
+
+var breakerStateStrings = map[BreakerState]string{
+	BreakerClosed:   "Closed",
+	BreakerOpen:     "Open",
+	BreakerHalfOpen: "Half Open",
+}
+
+func (s BreakerState) String() string {
+	str, ok := breakerStateStrings[s]
+	if !ok {
+		return fmt.Sprintf("Invalid Breaker State: %d", s)
+	}
+
+	return str
+}
+
+// BreakerConfig configures the per-host circuit breakers of a cluster
+type BreakerConfig struct {
+	// Window is the sliding window over which error and latency rates are measured. Defaults to 10s
+	Window time.Duration
+
+	// MinRequests is the number of requests required in the window before the breaker can open. Defaults to 10
+	MinRequests int
+
+	// ErrorRate is the fraction (0-1] of failed requests in the window that opens the breaker. Defaults to 0.5
+	ErrorRate float64
+
+	// LatencyThreshold is the duration after which a request counts as slow. 0 disables latency tracking
+	LatencyThreshold time.Duration
+
+	// SlowRate is the fraction (0-1] of slow requests in the window that opens the breaker. Defaults to 0.5
+	SlowRate float64
+
+	// OpenTimeout is how long the breaker stays open before allowing trial requests. Defaults to 30s
+	OpenTimeout time.Duration
+
+	// HalfOpenRequests is the number of trial requests that must succeed to close the breaker. Defaults to 1
+	HalfOpenRequests int
+}
+
+func (config BreakerConfig) setDefaults() BreakerConfig {
+	if config.Window == 0 {
+		config.Window = DefaultBreakerWindow
+	}
+
+	if config.MinRequests == 0 {
+		config.MinRequests = DefaultBreakerMinRequests
+	}
+
+	if config.ErrorRate == 0 {
+		config.ErrorRate = DefaultBreakerErrorRate
+	}
+
+	if config.SlowRate == 0 {
+		config.SlowRate = DefaultBreakerSlowRate
+	}
+
+	if config.OpenTimeout == 0 {
+		config.OpenTimeout = DefaultBreakerOpenTimeout
+	}
+
+	if config.HalfOpenRequests == 0 {
+		config.HalfOpenRequests = DefaultBreakerHalfOpenRequests
+	}
+
+	return config
+}
+
+// BreakerStateEvent is emitted when a host's circuit breaker changes state
+type BreakerStateEvent struct {
+	Addr string
+	From BreakerState
+	To   BreakerState
+}
+
+func (BreakerStateEvent) isEvent() {}
+
+type breakerBucket struct {
+	start    time.Time
+	total    int
+	failures int
+	slow     int
+}
+
+// breaker is a circuit breaker for a single host
+type breaker struct {
+	addr    string
+	config  BreakerConfig
+	clock   Clock
+	onEvent OnEvent
+
+	mu       sync.Mutex
+	state    BreakerState
+	openedAt time.Time
+	trials   int
+	passed   int
+	buckets  [breakerBuckets]breakerBucket
+
+	// pending holds transitions made under the lock so they can be emitted after unlocking
+	pending []Event
+}
+
+func newBreaker(addr string, config BreakerConfig, clock Clock, onEvent OnEvent) *breaker {
+	return &breaker{
+		addr:    addr,
+		config:  config.setDefaults(),
+		clock:   clock,
+		onEvent: onEvent,
+	}
+}
+
+// State returns the current state of the breaker
+func (b *breaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == BreakerOpen && b.clock.Now().Sub(b.openedAt) >= b.config.OpenTimeout {
+		return BreakerHalfOpen
+	}
+	return b.state
+}
+
+// allow returns whether a request may be sent to the host. Every allowed request must be followed by a call to record.
+func (b *breaker) allow() bool {
+	b.mu.Lock()
+
+	switch b.state {
+	case BreakerOpen:
+		if b.clock.Now().Sub(b.openedAt) < b.config.OpenTimeout {
+			b.mu.Unlock()
+			return false
+		}
+		b.transition(BreakerHalfOpen)
+		fallthrough
+	case BreakerHalfOpen:
+		if b.trials >= b.config.HalfOpenRequests {
+			b.mu.Unlock()
+			return false
+		}
+		b.trials++
+	}
+
+	b.mu.Unlock()
+	b.emitPending()
+	return true
+}
+
+// allows returns whether allow would let a request through, without taking a half-open trial
+func (b *breaker) allows() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		// Once the open timeout has passed allow moves to half-open with every trial available
+		return b.clock.Now().Sub(b.openedAt) >= b.config.OpenTimeout
+	case BreakerHalfOpen:
+		return b.trials < b.config.HalfOpenRequests
+	}
+	return true
+}
+
+// record records the outcome of an allowed request
+func (b *breaker) record(latency time.Duration, err error) {
+	if err == context.Canceled {
+		// the caller gave up; this says nothing about the host
+		b.release()
+		return
+	}
+
+	failed := isHostFailure(err)
+	slow := b.config.LatencyThreshold > 0 && latency >= b.config.LatencyThreshold
+
+	b.mu.Lock()
+
+	switch b.state {
+	case BreakerHalfOpen:
+		b.trials--
+		if failed || slow {
+			b.open()
+			break
+		}
+		b.passed++
+		if b.passed >= b.config.HalfOpenRequests {
+			b.buckets = [breakerBuckets]breakerBucket{}
+			b.transition(BreakerClosed)
+		}
+	case BreakerClosed:
+		bucket := b.bucket(b.clock.Now())
+		bucket.total++
+		if failed {
+			bucket.failures++
+		}
+		if slow {
+			bucket.slow++
+		}
+
+		if b.shouldOpen() {
+			b.open()
+		}
+	}
+
+	b.mu.Unlock()
+	b.emitPending()
+}
+
+// release gives back a half-open trial without recording an outcome
+func (b *breaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == BreakerHalfOpen {
+		b.trials--
+	}
+}
+
+func (b *breaker) bucket(now time.Time) *breakerBucket {
+	width := b.config.Window / breakerBuckets
+	start := now.Truncate(width)
+	bucket := &b.buckets[(start.UnixNano()/int64(width))%breakerBuckets]
+	if !bucket.start.Equal(start) {
+		*bucket = breakerBucket{start: start}
+	}
+	return bucket
+}
+
+func (b *breaker) shouldOpen() bool {
+	var total, failures, slow int
+
+	cutoff := b.clock.Now().Add(-b.config.Window)
+	for _, bucket := range b.buckets {
+		if bucket.start.Before(cutoff) {
+			continue
+		}
+		total += bucket.total
+		failures += bucket.failures
+		slow += bucket.slow
+	}
+
+	if total < b.config.MinRequests {
+		return false
+	}
+
+	if float64(failures)/float64(total) >= b.config.ErrorRate {
+		return true
+	}
+
+	return b.config.LatencyThreshold > 0 && float64(slow)/float64(total) >= b.config.SlowRate
+}
+
+func (b *breaker) open() {
+	b.openedAt = b.clock.Now()
+	b.transition(BreakerOpen)
+}
+
+func (b *breaker) transition(to BreakerState) {
+	if b.state == to {
+		return
+	}
+
+	b.pending = append(b.pending, BreakerStateEvent{Addr: b.addr, From: b.state, To: to})
+	b.state = to
+	b.trials = 0
+	b.passed = 0
+}
+
+func (b *breaker) emitPending() {
+	b.mu.Lock()
+	pending := b.pending
+	b.pending = nil
+	b.mu.Unlock()
+
+	for _, e := range pending {
+		b.onEvent(e)
+	}
+}
+
+// isHostFailure returns whether err indicates a problem with the host rather than with the request
+func isHostFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	if _, ok := err.(responseError); ok {
+		return IsServerError(err) || IsServerTimeout(err)
+	}
+
+	// Network errors, timeouts, and anything else unexpected
+	return true
+}
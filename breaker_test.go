@@ -0,0 +1,191 @@
+package grmln
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBreakerTransitions(t *testing.T) {
+	clock := newFakeClock()
+
+	var events []BreakerStateEvent
+	b := newBreaker("host", BreakerConfig{
+		MinRequests: 4,
+		OpenTimeout: time.Second,
+	}, clock, func(e Event) {
+		events = append(events, e.(BreakerStateEvent))
+	})
+
+	serverError := responseError{response: Response{Status: ResponseStatus{Code: StatusServerError}}}
+	scriptError := responseError{response: Response{Status: ResponseStatus{Code: StatusScriptEvaluationError}}}
+
+	// Script errors are the caller's fault and never open the breaker
+	for i := 0; i < 10; i++ {
+		if !b.allow() {
+			t.Fatal("expected closed breaker to allow request")
+		}
+		b.record(time.Millisecond, scriptError)
+	}
+
+	if state := b.State(); state != BreakerClosed {
+		t.Fatalf("expected %v but got %v", BreakerClosed, state)
+	}
+
+	// Move past the window so the script errors count as successes that have expired
+	clock.advance(DefaultBreakerWindow * 2)
+
+	b.record(time.Millisecond, nil)
+	b.record(time.Millisecond, serverError)
+	b.record(time.Millisecond, errors.New("connection reset"))
+	if state := b.State(); state != BreakerClosed {
+		t.Fatalf("expected %v below min requests but got %v", BreakerClosed, state)
+	}
+
+	b.record(time.Millisecond, nil)
+	if state := b.State(); state != BreakerOpen {
+		t.Fatalf("expected %v but got %v", BreakerOpen, state)
+	}
+
+	if b.allow() {
+		t.Fatal("expected open breaker to reject request")
+	}
+
+	clock.advance(time.Second)
+
+	if !b.allow() {
+		t.Fatal("expected half open breaker to allow a trial request")
+	}
+	if b.allow() {
+		t.Fatal("expected half open breaker to allow only one trial request")
+	}
+
+	b.record(time.Millisecond, nil)
+	if state := b.State(); state != BreakerClosed {
+		t.Fatalf("expected %v but got %v", BreakerClosed, state)
+	}
+
+	expected := []BreakerStateEvent{
+		{Addr: "host", From: BreakerClosed, To: BreakerOpen},
+		{Addr: "host", From: BreakerOpen, To: BreakerHalfOpen},
+		{Addr: "host", From: BreakerHalfOpen, To: BreakerClosed},
+	}
+
+	if len(events) != len(expected) {
+		t.Fatalf("expected %v but got %v", expected, events)
+	}
+	for i := range expected {
+		if events[i] != expected[i] {
+			t.Fatalf("expected %v but got %v", expected, events)
+		}
+	}
+}
+
+func TestBreakerLatency(t *testing.T) {
+	clock := newFakeClock()
+
+	b := newBreaker("host", BreakerConfig{
+		MinRequests:      2,
+		LatencyThreshold: time.Second,
+	}, clock, func(Event) {})
+
+	b.record(time.Millisecond, nil)
+	b.record(time.Second*2, nil)
+
+	if state := b.State(); state != BreakerOpen {
+		t.Fatalf("expected %v but got %v", BreakerOpen, state)
+	}
+}
+
+// TestBreakerCancel ensures requests the caller cancelled neither count against the host nor use up trials
+func TestBreakerCancel(t *testing.T) {
+	clock := newFakeClock()
+
+	b := newBreaker("host", BreakerConfig{
+		MinRequests:      2,
+		OpenTimeout:      time.Second,
+		LatencyThreshold: time.Second,
+	}, clock, func(Event) {})
+
+	for i := 0; i < 10; i++ {
+		b.record(time.Second*2, context.Canceled)
+	}
+	if state := b.State(); state != BreakerClosed {
+		t.Fatalf("expected cancelled requests to leave the breaker %v but got %v", BreakerClosed, state)
+	}
+
+	b.record(time.Millisecond, errors.New("connection reset"))
+	b.record(time.Millisecond, errors.New("connection reset"))
+	clock.advance(time.Second)
+
+	if !b.allow() {
+		t.Fatal("expected half open breaker to allow a trial request")
+	}
+	b.record(time.Millisecond, context.Canceled)
+
+	if state := b.State(); state != BreakerHalfOpen {
+		t.Fatalf("expected %v but got %v", BreakerHalfOpen, state)
+	}
+	if !b.allow() {
+		t.Fatal("expected a cancelled trial to free its slot")
+	}
+}
+
+// TestGetConnBreakers ensures requests waiting for a connection see breakers change and don't wait on
+// hosts with no trials left
+func TestGetConnBreakers(t *testing.T) {
+	clock := newFakeClock()
+	config := BreakerConfig{MinRequests: 1, OpenTimeout: time.Millisecond * 50}
+
+	pool := newConnPool([]string{"a", "b"}, 1)
+	c := &Cluster{
+		writers:    pool,
+		clock:      clock,
+		checkedOut: map[*Conn]struct{}{},
+		closing:    make(chan struct{}),
+		breakers: map[string]*breaker{
+			"a": newBreaker("a", config, clock, func(Event) {}),
+			"b": newBreaker("b", config, clock, func(Event) {}),
+		},
+	}
+	a, b := &Conn{addr: "a", pool: pool}, &Conn{addr: "b", pool: pool}
+	pool.conns <- a
+	pool.conns <- b
+
+	open := func(addr string) {
+		c.breakers[addr].allow()
+		c.breakers[addr].record(0, errors.New("failed"))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	// a's only trial is in use and b is open, so nothing can be sent
+	open("a")
+	open("b")
+	clock.advance(config.OpenTimeout)
+	c.breakers["a"].allow()
+	open("b")
+
+	if _, err := c.getConn(ctx, pool, "", true); !IsNoHostsAvailable(err) {
+		t.Fatalf("expected no hosts available but got %v", err)
+	}
+	if len(pool.conns) != 2 {
+		t.Fatalf("expected the skipped connections to be returned but the pool has %d", len(pool.conns))
+	}
+
+	// a recovers but its connection is in use, and b becomes half-open while we wait
+	c.breakers["a"].record(0, nil)
+	if conn := <-pool.conns; conn != a {
+		t.Fatalf("expected a's connection first but got %v", conn.addr)
+	}
+
+	conn, err := c.getConn(ctx, pool, "", true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if conn != b || c.breakers["b"].State() != BreakerHalfOpen {
+		t.Fatalf("expected the half-open host's connection but got %v", conn.addr)
+	}
+}
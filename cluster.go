@@ -2,9 +2,8 @@ package grmln
 
 import (
 	"context"
-	"math"
-	"math/rand"
 	"net/http"
+	"sync"
 	"time"
 )
 
@@ -18,15 +17,46 @@ const (
 type (
 	// OnConnectError is called when there is an error connecting
 	OnConnectError func(addr string, err error, attempts int)
+
+	// RetryConnect is called after a failed connection attempt. Returning false gives up on the host permanently
+	RetryConnect func(addr string, err error, attempts int) bool
 )
 
 // Cluster represents a cluster of Gremlin servers
 type Cluster struct {
-	conns       chan *Conn
-	backoffBase time.Duration
-	backoffMax  time.Duration
+	// writers receives every request unless the cluster has readers
+	writers *connPool
+	// readers receives read-only requests. nil unless created with NewReadWriteCluster
+	readers *connPool
+
+	detectReadOnly       bool
+	readFallbackToWriter bool
+
+	// hedge is nil unless hedged requests are enabled
+	hedge *hedger
+
+	backoff Backoff
+	clock   Clock
 
 	onConnectError OnConnectError
+	retryConnect   RetryConnect
+	onEvent        OnEvent
+	metrics        Metrics
+	logger         Logger
+
+	// breakers holds the circuit breaker for each address. nil if breakers are disabled
+	breakers map[string]*breaker
+
+	// dialCtx is cancelled on shutdown to abort any dials in progress
+	dialCtx    context.Context
+	cancelDial context.CancelFunc
+
+	mu         sync.Mutex
+	closed     bool
+	hostConns  map[string]int
+	checkedOut map[*Conn]struct{}
+	inflight   sync.WaitGroup
+	connecting sync.WaitGroup
 
 	closing chan struct{}
 }
@@ -54,9 +84,41 @@ type ClusterConfig struct {
 	// BackoffMax is the maximum time we can wait between connect attempts
 	BackoffMax time.Duration
 
+	// Backoff decides how long to wait between connect attempts. Defaults to
+	// DecorrelatedJitterBackoff using BackoffBase and BackoffMax
+	Backoff Backoff
+
+	// Clock is used for backoff timers. Defaults to the system clock
+	Clock Clock
+
 	// OnConnectError is called when there is an error connecting
 	OnConnectError OnConnectError
 
+	// RetryConnect is called after every failed connect attempt. Defaults to always retrying
+	RetryConnect RetryConnect
+
+	// OnEvent is called for cluster lifecycle events such as giving up on a host
+	OnEvent OnEvent
+
+	// Breaker enables a circuit breaker per address when set
+	Breaker *BreakerConfig
+
+	// Metrics collects metrics from the cluster and its connections. Defaults to no collection
+	Metrics Metrics
+
+	// Logger logs connection lifecycle and authentication events. Defaults to no logging
+	Logger Logger
+
+	// DetectReadOnly routes eval requests without mutating steps (addV, addE, property, drop) to
+	// readers when the request context is not marked with WithReadOnly. Only used by NewReadWriteCluster
+	DetectReadOnly bool
+
+	// Hedge enables hedged requests for idempotent and read-only requests when set
+	Hedge *HedgeConfig
+
+	// ReadFallbackToWriter sends read-only requests to the writers when no reader is healthy. Only used by NewReadWriteCluster
+	ReadFallbackToWriter bool
+
 	// UserName is the connection username
 	UserName string
 
@@ -69,23 +131,60 @@ type ClusterConfig struct {
 
 // NewCluster creates a new cluster
 func NewCluster(config ClusterConfig, addrs ...string) *Cluster {
+	return newCluster(config, addrs, nil)
+}
+
+func newCluster(config ClusterConfig, writers, readers []string) *Cluster {
 	config = setDefaults(config)
 
-	cluster := Cluster{
-		conns:          make(chan *Conn, len(addrs)*config.ConnectionsPerAddress),
-		backoffBase:    config.BackoffBase,
-		backoffMax:     config.BackoffMax,
-		onConnectError: config.OnConnectError,
-		closing:        make(chan struct{}),
+	dialCtx, cancelDial := context.WithCancel(context.Background())
+
+	cluster := &Cluster{
+		writers:              newConnPool(writers, config.ConnectionsPerAddress),
+		detectReadOnly:       config.DetectReadOnly,
+		readFallbackToWriter: config.ReadFallbackToWriter,
+		backoff:              config.Backoff,
+		clock:                config.Clock,
+		onConnectError:       config.OnConnectError,
+		retryConnect:         config.RetryConnect,
+		onEvent:              config.OnEvent,
+		metrics:              config.Metrics,
+		logger:               config.Logger,
+		hostConns:            map[string]int{},
+		dialCtx:              dialCtx,
+		cancelDial:           cancelDial,
+		checkedOut:           map[*Conn]struct{}{},
+		closing:              make(chan struct{}),
+	}
+
+	if config.Hedge != nil {
+		cluster.hedge = newHedger(*config.Hedge)
 	}
 
-	for _, addr := range addrs {
-		for i := 0; i < config.ConnectionsPerAddress; i++ {
-			go cluster.putConn(cluster.connect(addr, config.MimeType, config.UserName, config.Password, config.Headers), nil)
+	pools := []*connPool{cluster.writers}
+	if readers != nil {
+		cluster.readers = newConnPool(readers, config.ConnectionsPerAddress)
+		pools = append(pools, cluster.readers)
+	}
+
+	if config.Breaker != nil {
+		cluster.breakers = map[string]*breaker{}
+		for _, pool := range pools {
+			for _, addr := range pool.addrs {
+				cluster.breakers[addr] = newBreaker(addr, *config.Breaker, config.Clock, cluster.onEvent)
+			}
+		}
+	}
+
+	for _, pool := range pools {
+		for _, addr := range pool.addrs {
+			for i := 0; i < config.ConnectionsPerAddress; i++ {
+				cluster.startConnect(pool, addr, config.MimeType, config.UserName, config.Password, config.Headers)
+			}
 		}
 	}
 
-	return &cluster
+	return cluster
 }
 
 func setDefaults(config ClusterConfig) ClusterConfig {
@@ -97,10 +196,44 @@ func setDefaults(config ClusterConfig) ClusterConfig {
 		config.BackoffMax = DefaultBackoffMax
 	}
 
+	if config.Backoff == nil {
+		config.Backoff = DecorrelatedJitterBackoff{
+			Base: config.BackoffBase,
+			Max:  config.BackoffMax,
+		}
+	}
+
+	if config.Clock == nil {
+		config.Clock = realClock{}
+	}
+
+	if config.Metrics == nil {
+		config.Metrics = noopMetrics{}
+	}
+
 	if config.OnConnectError == nil {
 		config.OnConnectError = func(addr string, err error, attempts int) {}
 	}
 
+	if config.RetryConnect == nil {
+		config.RetryConnect = func(addr string, err error, attempts int) bool { return true }
+	}
+
+	if config.OnEvent == nil {
+		config.OnEvent = func(e Event) {}
+	}
+
+	if config.Logger == nil {
+		config.Logger = noopLogger{}
+	}
+
+	// Every event is logged before it's passed on
+	logger, onEvent := config.Logger, config.OnEvent
+	config.OnEvent = func(e Event) {
+		logEvent(logger, e)
+		onEvent(e)
+	}
+
 	if config.ConnectionsPerAddress == 0 {
 		config.ConnectionsPerAddress = 1
 	}
@@ -112,100 +245,397 @@ func setDefaults(config ClusterConfig) ClusterConfig {
 	return config
 }
 
-func (c *Cluster) getConn(ctx context.Context) (*Conn, error) {
+// getConn gets a connection from pool, skipping connections to exclude. If wait is false
+// and no connection is immediately available, a no hosts available error is returned.
+func (c *Cluster) getConn(ctx context.Context, pool *connPool, exclude string, wait bool) (*Conn, error) {
 	select {
 	case <-c.closing:
 		return nil, clusterErrorClusterClosed
 	default:
 	}
 
-	select {
-	case conn, ok := <-c.conns:
-		if !ok {
+	// Connections to hosts whose breaker won't allow a request are held aside
+	// until we find a usable one so we don't receive them again
+	var skipped []*Conn
+	returnSkipped := func() {
+		for _, conn := range skipped {
+			c.putConn(conn, nil)
+		}
+		skipped = nil
+	}
+	defer returnSkipped()
+
+	for {
+		var conn *Conn
+
+		select {
+		case conn = <-pool.conns:
+		default:
+			if !wait || (len(skipped) > 0 && !c.anyHostAllowed(pool)) {
+				return nil, clusterErrorNoHostsAvailable
+			}
+
+			// A skipped host's breaker may allow requests again while we wait, so the skipped
+			// connections are returned and checked again every so often
+			var recheck <-chan time.Time
+			if len(skipped) > 0 {
+				recheck = c.clock.After(breakerRecheckInterval)
+			}
+
+			select {
+			case conn = <-pool.conns:
+			case <-recheck:
+				returnSkipped()
+				continue
+			case <-c.closing:
+				return nil, clusterErrorClusterClosed
+			case <-pool.exhausted:
+				return nil, clusterErrorNoHostsAvailable
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+
+		if conn.addr == exclude {
+			skipped = append(skipped, conn)
+			continue
+		}
+
+		if b := c.breakers[conn.addr]; b != nil && !b.allow() {
+			skipped = append(skipped, conn)
+			continue
+		}
+
+		c.mu.Lock()
+		if c.closed {
+			c.mu.Unlock()
+			// Shutdown has already drained the pool; nobody else will close this one
+			conn.Close()
+			c.record(conn.addr, 0, context.Canceled)
 			return nil, clusterErrorClusterClosed
 		}
+		c.checkedOut[conn] = struct{}{}
+		c.mu.Unlock()
+
 		return conn, nil
-	case <-ctx.Done():
-		return nil, ctx.Err()
 	}
 }
 
+// anyHostAllowed returns whether any of pool's hosts has a breaker that would allow a request
+func (c *Cluster) anyHostAllowed(pool *connPool) bool {
+	if len(c.breakers) == 0 {
+		return true
+	}
+
+	for _, addr := range pool.addrs {
+		if c.breakers[addr].allows() {
+			return true
+		}
+	}
+	return false
+}
+
+// healthy returns whether pool has at least one connected host whose breaker is not open
+func (c *Cluster) healthy(pool *connPool) bool {
+	c.mu.Lock()
+	connected := pool.connected > 0
+	c.mu.Unlock()
+
+	return connected && c.anyHostAllowed(pool)
+}
+
+// Healthy returns whether the cluster is open and has at least one connected host whose breaker is not open
+func (c *Cluster) Healthy() bool {
+	c.mu.Lock()
+	closed := c.closed
+	c.mu.Unlock()
+
+	return !closed && c.healthy(c.writers)
+}
+
+// record records the outcome of a request against addr's breaker
+func (c *Cluster) record(addr string, latency time.Duration, err error) {
+	if b := c.breakers[addr]; b != nil {
+		b.record(latency, err)
+	}
+}
+
+// BreakerState returns the state of addr's circuit breaker. Hosts are always
+// closed when the cluster has no breakers configured.
+func (c *Cluster) BreakerState(addr string) BreakerState {
+	if b := c.breakers[addr]; b != nil {
+		return b.State()
+	}
+	return BreakerClosed
+}
+
+// putConn returns a connection to its pool. If err is not nil the connection is
+// discarded and a replacement is dialed in the background.
 func (c *Cluster) putConn(conn *Conn, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.checkedOut, conn)
+
+	if c.closed {
+		conn.Close()
+		return
+	}
+
 	if err != nil {
-		go func() {
-			conn := c.connect(conn.addr, conn.mimeType, conn.userName, conn.password, conn.headers)
-			if conn != nil {
-				c.conns <- conn
-			}
-		}()
+		c.logger.Log(LogWarn, "discarding connection after error", "addr", conn.addr, "error", err)
+		conn.Close()
+		conn.pool.connected--
+		c.hostConns[conn.addr]--
+		c.metrics.PoolSize(conn.addr, c.hostConns[conn.addr])
+		c.startConnectLocked(conn.pool, conn.addr, conn.mimeType, conn.userName, conn.password, conn.headers)
 		return
 	}
 
-	c.conns <- conn
+	// conns has capacity for every connection in the pool so this never blocks
+	conn.pool.conns <- conn
 }
 
-func (c *Cluster) randomJitter(sleep time.Duration) time.Duration {
-	base := int64(c.backoffBase)
-	return time.Duration(
-		math.Min(
-			float64(c.backoffMax),
-			float64(rand.Int63n(int64(sleep)-base)+base),
-		),
-	)
+// addConn adds a newly connected connection to pool
+func (c *Cluster) addConn(pool *connPool, conn *Conn) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	conn.pool = pool
+
+	if c.closed {
+		conn.Close()
+		return
+	}
+
+	pool.connected++
+	c.hostConns[conn.addr]++
+	c.metrics.PoolSize(conn.addr, c.hostConns[conn.addr])
+	pool.conns <- conn
+}
+
+// startConnect dials addr in the background and adds the connection to pool once connected
+func (c *Cluster) startConnect(pool *connPool, addr, mimeType, userName, password string, headers http.Header) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.startConnectLocked(pool, addr, mimeType, userName, password, headers)
 }
 
-func (c *Cluster) connect(addr, mimeType, userName, password string, headers http.Header) *Conn {
-	sleep := c.backoffBase
+func (c *Cluster) startConnectLocked(pool *connPool, addr, mimeType, userName, password string, headers http.Header) {
+	if c.closed {
+		return
+	}
+
+	c.connecting.Add(1)
+	go func() {
+		defer c.connecting.Done()
+
+		conn := c.connect(pool, addr, mimeType, userName, password, headers)
+		if conn != nil {
+			c.addConn(pool, conn)
+		}
+	}()
+}
+
+func (c *Cluster) connect(pool *connPool, addr, mimeType, userName, password string, headers http.Header) *Conn {
+	var sleep time.Duration
 	attempts := 1
 	for {
-		conn, err := Dial(context.Background(), addr, mimeType, userName, password, headers)
+		conn, err := Dial(c.dialCtx, addr, mimeType, userName, password, headers)
 		if err == nil {
 			// connected!
+			c.metrics.ConnectAttempt(addr, nil)
+			c.logger.Log(LogInfo, "connected", "addr", addr, "attempts", attempts)
+			conn.metrics = c.metrics
+			conn.logger = c.logger
 			return conn
 		}
 
+		select {
+		case <-c.closing:
+			return nil
+		default:
+		}
+
+		c.metrics.ConnectAttempt(addr, err)
+		c.logger.Log(LogWarn, "connect failed", "addr", addr, "attempts", attempts, "error", err)
+
 		c.onConnectError(addr, err, attempts)
 
+		var retry bool
+		sleep, retry = c.backoff.Next(attempts, sleep)
+		if !retry || !c.retryConnect(addr, err, attempts) {
+			c.giveUp(pool, addr, err, attempts)
+			return nil
+		}
+
 		select {
 		case <-c.closing:
 			return nil
-		case <-time.After(sleep):
+		case <-c.clock.After(sleep):
 		}
-		sleep = c.randomJitter(sleep * 3)
 		attempts++
 	}
 }
 
+// giveUp permanently removes a connection slot for addr from pool
+func (c *Cluster) giveUp(pool *connPool, addr string, err error, attempts int) {
+	c.mu.Lock()
+	pool.slots--
+	if pool.slots == 0 {
+		close(pool.exhausted)
+	}
+	c.mu.Unlock()
+
+	c.onEvent(HostGaveUpEvent{
+		Addr:     addr,
+		Err:      err,
+		Attempts: attempts,
+	})
+}
+
 // ProcessRequest can process a raw gremlin request
 func (c *Cluster) ProcessRequest(ctx context.Context, r Request, onResponse ...OnResponse) error {
-	conn, err := c.getConn(ctx)
-	if err != nil {
-		return err
+	if !c.startRequest() {
+		return clusterErrorClusterClosed
 	}
+	defer c.inflight.Done()
 
-	err = conn.sendRequest(ctx, r)
-	if err != nil {
-		c.putConn(conn, err)
-		return err
+	pool := c.route(ctx, r)
+	if c.hedge != nil && c.isIdempotent(ctx, r) {
+		return c.processHedged(ctx, pool, r, onResponse...)
 	}
 
-	err = conn.readResponse(ctx, onResponse...)
+	conn, err := c.getConn(ctx, pool, "", true)
 	if err != nil {
-		c.putConn(conn, err)
 		return err
 	}
+	setRequestHost(ctx, conn.addr)
 
-	c.putConn(conn, nil)
-	return nil
+	start := c.clock.Now()
+	err = c.roundTrip(ctx, conn, r, onResponse...)
+	c.record(conn.addr, c.clock.Now().Sub(start), err)
+	return err
 }
 
-// Close closes the cluster
+// roundTrip sends r on conn, reads the response, and returns conn to the pool
+func (c *Cluster) roundTrip(ctx context.Context, conn *Conn, r Request, onResponse ...OnResponse) error {
+	err := conn.roundTrip(ctx, r, onResponse...)
+	c.putConn(conn, err)
+	return err
+}
+
+// startRequest registers an in-flight request. It returns false if the cluster is shutting down.
+func (c *Cluster) startRequest() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return false
+	}
+
+	c.inflight.Add(1)
+	return true
+}
+
+// Shutdown gracefully shuts down the cluster. New requests are rejected immediately,
+// in-flight requests are given until ctx is done to complete, reconnect loops are
+// stopped, and every connection is sent a websocket close frame before being closed.
+// Any errors encountered are aggregated into the returned error.
+func (c *Cluster) Shutdown(ctx context.Context) error {
+	return c.shutdown(ctx, true)
+}
+
+// Close closes the cluster immediately without waiting for in-flight requests
 func (c *Cluster) Close() error {
-	close(c.closing) // prevent further gets outside of close function
+	return c.shutdown(context.Background(), false)
+}
 
-	close(c.conns)
-	for conn := range c.conns {
-		conn.Close()
+func (c *Cluster) shutdown(ctx context.Context, wait bool) error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return clusterErrorClusterClosed
+	}
+	c.closed = true
+	close(c.closing)
+	c.cancelDial()
+	c.mu.Unlock()
+
+	c.logger.Log(LogInfo, "cluster shutting down", "wait", wait)
+
+	var errs multiError
+
+	waitErr := context.Canceled
+	if wait {
+		waitErr = waitContext(ctx, &c.inflight)
+		if waitErr != nil {
+			errs = append(errs, waitErr)
+		}
+	}
+
+	if waitErr != nil {
+		// Requests that are still running will close their own connection when
+		// they return it, but we don't want to wait for them any longer
+		c.mu.Lock()
+		for conn := range c.checkedOut {
+			conn.ws.Close()
+		}
+		c.mu.Unlock()
+	}
+
+	// Dials are cancelled and backoff sleeps are interrupted so this returns quickly
+	c.connecting.Wait()
+
+	// ctx may have expired waiting for requests, so the close handshakes get their own deadline
+	closeCtx, cancel := context.WithTimeout(context.Background(), closeFrameTimeout)
+	defer cancel()
+
+	for _, pool := range []*connPool{c.writers, c.readers} {
+		if pool == nil {
+			continue
+		}
+
+		for {
+			select {
+			case conn := <-pool.conns:
+				if err := conn.Shutdown(closeCtx); err != nil {
+					errs = append(errs, err)
+				}
+				continue
+			default:
+			}
+			break
+		}
+	}
+
+	if err := errs.errOrNil(); err != nil {
+		c.logger.Log(LogError, "cluster shut down with errors", "error", err)
+		return err
 	}
+
+	c.logger.Log(LogInfo, "cluster shut down")
 	return nil
 }
+
+// waitContext waits for wg or for ctx to be done, whichever is first
+func waitContext(ctx context.Context, wg *sync.WaitGroup) error {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		select {
+		case <-done:
+			return nil
+		default:
+			return ctx.Err()
+		}
+	}
+}
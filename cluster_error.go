@@ -1,15 +1,22 @@
 package grmln
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+)
 
 type clusterError int
 
 const (
 	clusterErrorClusterClosed clusterError = iota
+	clusterErrorNoHostsAvailable
+	clusterErrorNoShardKey
 )
 
 var clusterErrorStrings = map[clusterError]string{
-	clusterErrorClusterClosed: "Cluster Closed",
+	clusterErrorClusterClosed:    "Cluster Closed",
+	clusterErrorNoHostsAvailable: "No Hosts Available",
+	clusterErrorNoShardKey:       "No Shard Key",
 }
 
 func (e clusterError) Error() string {
@@ -25,12 +32,61 @@ func (e clusterError) IsClusterClosed() bool {
 	return e == clusterErrorClusterClosed
 }
 
+func (e clusterError) IsNoHostsAvailable() bool {
+	return e == clusterErrorNoHostsAvailable
+}
+
+func (e clusterError) IsNoShardKey() bool {
+	return e == clusterErrorNoShardKey
+}
+
 type clusterClosed interface {
 	IsClusterClosed() bool
 }
+type noHostsAvailable interface {
+	IsNoHostsAvailable() bool
+}
+type noShardKey interface {
+	IsNoShardKey() bool
+}
 
 // IsClusterClosed returns whether or not the error is a cluster closed error
 func IsClusterClosed(err error) bool {
 	e, ok := err.(clusterClosed)
 	return ok && e.IsClusterClosed()
 }
+
+// IsNoHostsAvailable returns whether or not the error is because the cluster has no usable hosts
+func IsNoHostsAvailable(err error) bool {
+	e, ok := err.(noHostsAvailable)
+	return ok && e.IsNoHostsAvailable()
+}
+
+// IsNoShardKey returns whether or not the error is because a sharded request had no shard key
+func IsNoShardKey(err error) bool {
+	e, ok := err.(noShardKey)
+	return ok && e.IsNoShardKey()
+}
+
+// multiError aggregates multiple errors into a single error
+type multiError []error
+
+func (e multiError) Error() string {
+	strs := make([]string, len(e))
+	for i, err := range e {
+		strs[i] = err.Error()
+	}
+	return strings.Join(strs, "; ")
+}
+
+// Unwrap returns the aggregated errors
+func (e multiError) Unwrap() []error {
+	return e
+}
+
+func (e multiError) errOrNil() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
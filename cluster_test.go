@@ -0,0 +1,46 @@
+package grmln
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// TestClusterShutdown ensures shutdown stops reconnect loops and releases waiting requests
+func TestClusterShutdown(t *testing.T) {
+	c := NewCluster(ClusterConfig{
+		BackoffBase: time.Millisecond,
+		BackoffMax:  time.Millisecond * 5,
+	}, "ws://127.0.0.1:1/gremlin", "ws://127.0.0.1:1/gremlin")
+
+	errs := make(chan error)
+	go func() {
+		errs <- c.ProcessRequest(context.Background(), NewRequest("", processorDefault, opEval, EvalArgs{Gremlin: "g.V()"}))
+	}()
+
+	time.Sleep(time.Millisecond * 20)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if err := c.Shutdown(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	select {
+	case err := <-errs:
+		if !IsClusterClosed(err) {
+			t.Fatalf("expected cluster closed error but got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("waiting request was not released by shutdown")
+	}
+
+	if err := c.ProcessRequest(context.Background(), Request{}); !IsClusterClosed(err) {
+		t.Fatalf("expected cluster closed error but got %v", err)
+	}
+
+	if err := c.Close(); !IsClusterClosed(err) {
+		t.Fatalf("expected cluster closed error but got %v", err)
+	}
+}
@@ -0,0 +1,471 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/evandigby/grmln"
+	"github.com/google/uuid"
+)
+
+// workload is the set of queries bench sends
+type workload struct {
+	Queries []*workloadQuery `json:"queries"`
+}
+
+// workloadQuery is a parameterized query. Queries are picked in proportion to their weight
+type workloadQuery struct {
+	Name     string                `json:"name"`
+	Gremlin  string                `json:"gremlin"`
+	Weight   int                   `json:"weight"`
+	Bindings map[string]*generator `json:"bindings"`
+
+	report *report
+}
+
+// generator generates random binding values
+type generator struct {
+	// Type is int, float, string, uuid, choice, sequence or const
+	Type string `json:"type"`
+
+	// Min and Max bound int and float values
+	Min float64 `json:"min"`
+	Max float64 `json:"max"`
+
+	// Length is the length of string values. Defaults to 8
+	Length int `json:"length"`
+
+	// Values are the values to choose from, or the value of a const
+	Values []interface{} `json:"values"`
+	Value  interface{}   `json:"value"`
+
+	// Start is the first value of a sequence
+	Start int64 `json:"start"`
+
+	mu   sync.Mutex
+	next int64
+}
+
+const letters = "abcdefghijklmnopqrstuvwxyz"
+
+func (g *generator) validate() error {
+	switch g.Type {
+	case "int", "float":
+		if g.Max < g.Min {
+			return fmt.Errorf("max must not be less than min")
+		}
+	case "string", "uuid", "const":
+	case "choice":
+		if len(g.Values) == 0 {
+			return fmt.Errorf("choice requires values")
+		}
+	case "sequence":
+		g.next = g.Start
+	default:
+		return fmt.Errorf("unknown generator type %q", g.Type)
+	}
+	return nil
+}
+
+func (g *generator) generate(r *rand.Rand) interface{} {
+	switch g.Type {
+	case "int":
+		return int64(g.Min) + r.Int63n(int64(g.Max)-int64(g.Min)+1)
+	case "float":
+		return g.Min + r.Float64()*(g.Max-g.Min)
+	case "string":
+		n := g.Length
+		if n <= 0 {
+			n = 8
+		}
+		b := make([]byte, n)
+		for i := range b {
+			b[i] = letters[r.Intn(len(letters))]
+		}
+		return string(b)
+	case "uuid":
+		return uuid.New().String()
+	case "choice":
+		return g.Values[r.Intn(len(g.Values))]
+	case "sequence":
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		v := g.next
+		g.next++
+		return v
+	}
+	return g.Value
+}
+
+func loadWorkload(r io.Reader) (*workload, error) {
+	var w workload
+	if err := json.NewDecoder(r).Decode(&w); err != nil {
+		return nil, err
+	}
+	if len(w.Queries) == 0 {
+		return nil, fmt.Errorf("workload has no queries")
+	}
+
+	for i, q := range w.Queries {
+		if q.Name == "" {
+			q.Name = fmt.Sprintf("query%d", i+1)
+		}
+		if strings.TrimSpace(q.Gremlin) == "" {
+			return nil, fmt.Errorf("%s: missing gremlin", q.Name)
+		}
+		if q.Weight < 0 {
+			return nil, fmt.Errorf("%s: weight must not be negative", q.Name)
+		}
+		if q.Weight == 0 {
+			q.Weight = 1
+		}
+		for name, g := range q.Bindings {
+			if g == nil {
+				return nil, fmt.Errorf("%s: binding %s has no generator", q.Name, name)
+			}
+			if err := g.validate(); err != nil {
+				return nil, fmt.Errorf("%s: binding %s: %v", q.Name, name, err)
+			}
+		}
+		q.report = newReport()
+	}
+	return &w, nil
+}
+
+// pick chooses a query at random by weight
+func (w *workload) pick(r *rand.Rand) *workloadQuery {
+	total := 0
+	for _, q := range w.Queries {
+		total += q.Weight
+	}
+
+	n := r.Intn(total)
+	for _, q := range w.Queries {
+		if n < q.Weight {
+			return q
+		}
+		n -= q.Weight
+	}
+	return w.Queries[len(w.Queries)-1]
+}
+
+func (q *workloadQuery) bindings(r *rand.Rand) grmln.Bindings {
+	if len(q.Bindings) == 0 {
+		return nil
+	}
+	b := make(grmln.Bindings, len(q.Bindings))
+	for name, g := range q.Bindings {
+		b[name] = g.generate(r)
+	}
+	return b
+}
+
+// hostCounter counts completed requests per host
+type hostCounter struct {
+	mu    sync.Mutex
+	hosts map[string]int
+}
+
+func (h *hostCounter) RequestCompleted(addr, op string, status grmln.StatusCode, latency time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.hosts[addr]++
+}
+func (h *hostCounter) ResponseFrames(op string, frames int)                        {}
+func (h *hostCounter) BytesSent(addr string, n int)                                {}
+func (h *hostCounter) BytesReceived(addr string, n int)                            {}
+func (h *hostCounter) PoolSize(addr string, connections int)                       {}
+func (h *hostCounter) ConnectAttempt(addr string, err error)                       {}
+func (h *hostCounter) AuthRoundTrip(addr string, latency time.Duration, err error) {}
+
+func runBench(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("bench", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: grmln bench [flags] workload.json")
+		fmt.Fprint(stderr, `
+The workload is JSON with weighted, parameterized queries whose bindings are generated at random:
+
+  {"queries": [
+    {"name": "byId", "gremlin": "g.V(id)", "weight": 3, "bindings": {"id": {"type": "int", "min": 1, "max": 1000}}},
+    {"name": "add", "gremlin": "g.addV('person').property('name', name)", "bindings": {"name": {"type": "string", "length": 12}}}
+  ]}
+
+Generator types are int, float (min, max), string (length), uuid, choice (values), sequence (start) and const (value).
+`)
+		fs.PrintDefaults()
+	}
+
+	var conn connFlags
+	conn.register(fs)
+
+	concurrency := fs.Int("concurrency", 8, "number of requests in flight at once")
+	rate := fs.Float64("rate", 0, "target requests per second. 0 sends as fast as concurrency allows")
+	duration := fs.Duration("duration", time.Second*30, "how long to send requests. Requests in flight at the end are waited for. Defaults to no limit with -requests")
+	requests := fs.Int("requests", 0, "stop after this many requests. 0 runs for the duration")
+	requestTimeout := fs.Duration("request-timeout", time.Second*30, "timeout for each request")
+	seed := fs.Int64("seed", 0, "random seed. 0 uses the current time")
+
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+	if *concurrency < 1 {
+		fmt.Fprintln(stderr, "concurrency must be at least 1")
+		return 2
+	}
+	// The ticker needs an interval of at least a nanosecond
+	if !(*rate >= 0 && *rate <= float64(time.Second)) {
+		fmt.Fprintf(stderr, "rate must be between 0 and %d\n", time.Second)
+		return 2
+	}
+	if *requests < 0 {
+		fmt.Fprintln(stderr, "requests must not be negative")
+		return 2
+	}
+	if *requests > 0 && !flagSet(fs, "duration") {
+		*duration = 0
+	}
+
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	w, err := loadWorkload(f)
+	f.Close()
+	if err != nil {
+		fmt.Fprintf(stderr, "%s: %v\n", fs.Arg(0), err)
+		return 1
+	}
+
+	hosts := &hostCounter{hosts: map[string]int{}}
+	conn.metrics = hosts
+
+	c, err := conn.connect(context.Background(), stderr)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	defer c.close()
+
+	if *seed == 0 {
+		*seed = time.Now().UnixNano()
+	}
+
+	b := &bench{
+		op:             c.op,
+		workload:       w,
+		concurrency:    *concurrency,
+		rate:           *rate,
+		duration:       *duration,
+		requests:       *requests,
+		requestTimeout: *requestTimeout,
+		seed:           *seed,
+	}
+	total, elapsed := b.run(context.Background())
+	b.writeReport(stdout, total, elapsed, hosts)
+
+	if total.failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// flagSet returns whether the named flag was given on the command line
+func flagSet(fs *flag.FlagSet, name string) bool {
+	set := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// bench sends a workload at a target rate or concurrency
+type bench struct {
+	op             *grmln.Operator
+	workload       *workload
+	concurrency    int
+	rate           float64
+	duration       time.Duration
+	requests       int
+	requestTimeout time.Duration
+	seed           int64
+}
+
+type benchJob struct {
+	query    *workloadQuery
+	bindings grmln.Bindings
+}
+
+// run sends requests until the duration has passed or the requests have been sent. Requests in
+// flight at the end run to completion so slow requests aren't left out of the report
+func (b *bench) run(ctx context.Context) (*report, time.Duration) {
+	dispatch := ctx
+	if b.duration > 0 {
+		var cancel context.CancelFunc
+		dispatch, cancel = context.WithTimeout(ctx, b.duration)
+		defer cancel()
+	}
+
+	total := newReport()
+	jobs := make(chan benchJob, b.concurrency)
+
+	var wg sync.WaitGroup
+	for i := 0; i < b.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				// Jobs still queued when the run ends are never sent
+				if dispatch.Err() != nil {
+					continue
+				}
+				latency, err := b.send(ctx, job)
+				job.query.report.record(latency, err)
+				total.record(latency, err)
+			}
+		}()
+	}
+
+	start := time.Now()
+	b.produce(dispatch, jobs)
+	close(jobs)
+	wg.Wait()
+
+	return total, time.Since(start)
+}
+
+// produce generates jobs until the run ends, pacing them if there is a target rate
+func (b *bench) produce(ctx context.Context, jobs chan<- benchJob) {
+	r := rand.New(rand.NewSource(b.seed))
+
+	var tick <-chan time.Time
+	if b.rate > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / b.rate))
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for n := 0; b.requests == 0 || n < b.requests; n++ {
+		if tick != nil {
+			select {
+			case <-tick:
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		q := b.workload.pick(r)
+		select {
+		case jobs <- benchJob{query: q, bindings: q.bindings(r)}:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (b *bench) send(ctx context.Context, job benchJob) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, b.requestTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err := b.op.EvalDefault(ctx, job.query.Gremlin, job.bindings)
+	return time.Since(start), err
+}
+
+func (b *bench) writeReport(w io.Writer, total *report, elapsed time.Duration, hosts *hostCounter) {
+	n := total.succeeded + total.failed
+	fmt.Fprintf(w, "%d requests in %v (%.1f/s): %d succeeded, %d failed\n",
+		n, round(elapsed), float64(n)/elapsed.Seconds(), total.succeeded, total.failed)
+	total.writeLatencies(w)
+
+	fmt.Fprintln(w, "\nlatency histogram:")
+	writeHistogram(w, total.sortedLatencies())
+
+	if total.failed > 0 {
+		fmt.Fprintln(w, "\nerrors:")
+		total.writeErrors(w)
+	}
+
+	fmt.Fprintln(w, "\nqueries:")
+	for _, q := range b.workload.Queries {
+		sorted := q.report.sortedLatencies()
+		fmt.Fprintf(w, "  %-20s %8d requests %6d failed  p50 %v  p99 %v\n",
+			q.Name, len(sorted), q.report.failed, round(percentile(sorted, 50)), round(percentile(sorted, 99)))
+	}
+
+	hosts.mu.Lock()
+	defer hosts.mu.Unlock()
+
+	addrs := make([]string, 0, len(hosts.hosts))
+	for addr := range hosts.hosts {
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+
+	fmt.Fprintln(w, "\nhosts:")
+	for _, addr := range addrs {
+		fmt.Fprintf(w, "  %-40s %8d requests\n", addr, hosts.hosts[addr])
+	}
+}
+
+// histogramBounds are the upper bounds of the latency histogram buckets
+var histogramBounds = []time.Duration{
+	time.Millisecond,
+	time.Millisecond * 2,
+	time.Millisecond * 5,
+	time.Millisecond * 10,
+	time.Millisecond * 25,
+	time.Millisecond * 50,
+	time.Millisecond * 100,
+	time.Millisecond * 250,
+	time.Millisecond * 500,
+	time.Second,
+	time.Second * 2,
+	time.Second * 5,
+}
+
+const histogramWidth = 40
+
+// writeHistogram writes a bar for each bucket. latencies must be sorted
+func writeHistogram(w io.Writer, latencies []time.Duration) {
+	if len(latencies) == 0 {
+		return
+	}
+
+	counts := make([]int, len(histogramBounds)+1)
+	for _, l := range latencies {
+		i := sort.Search(len(histogramBounds), func(i int) bool { return l <= histogramBounds[i] })
+		counts[i]++
+	}
+
+	most := 0
+	for _, c := range counts {
+		if c > most {
+			most = c
+		}
+	}
+
+	for i, c := range counts {
+		label := fmt.Sprintf("> %v", histogramBounds[len(histogramBounds)-1])
+		if i < len(histogramBounds) {
+			label = fmt.Sprintf("<= %v", histogramBounds[i])
+		}
+		fmt.Fprintf(w, "  %8s %8d %s\n", label, c, strings.Repeat("#", c*histogramWidth/most))
+	}
+}
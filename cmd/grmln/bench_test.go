@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/evandigby/grmln"
+	"github.com/evandigby/grmln/grmlntest"
+)
+
+func TestLoadWorkload(t *testing.T) {
+	tests := map[string]string{
+		`{"queries": []}`:              "no queries",
+		`{"queries": [{"name": "a"}]}`: "missing gremlin",
+		`{"queries": [{"gremlin": "g.V(id)", "bindings": {"id": {"type": "bogus"}}}]}`:                   "unknown generator",
+		`{"queries": [{"gremlin": "g.V(id)", "bindings": {"id": {"type": "int", "min": 2, "max": 1}}}]}`: "max must not be less than min",
+	}
+	for input, expected := range tests {
+		_, err := loadWorkload(strings.NewReader(input))
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("%s: expected error containing %q but got %v", input, expected, err)
+		}
+	}
+
+	w, err := loadWorkload(strings.NewReader(`{"queries": [
+		{"name": "heavy", "gremlin": "g.V(id)", "weight": 9, "bindings": {"id": {"type": "int", "min": 1, "max": 3}}},
+		{"name": "light", "gremlin": "g.V(id)", "bindings": {"id": {"type": "sequence", "start": 10}}}
+	]}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	r := rand.New(rand.NewSource(1))
+	counts := map[string]int{}
+	for i := 0; i < 1000; i++ {
+		q := w.pick(r)
+		counts[q.Name]++
+
+		id := q.bindings(r)["id"].(int64)
+		if q.Name == "heavy" && (id < 1 || id > 3) {
+			t.Fatalf("int binding %d out of range", id)
+		}
+	}
+	if counts["heavy"] < 850 || counts["heavy"] > 950 {
+		t.Fatalf("expected queries to be picked by weight but got %v", counts)
+	}
+	if next := w.Queries[1].Bindings["id"].generate(r); next != int64(10+counts["light"]) {
+		t.Fatalf("expected sequence to continue at %d but got %v", 10+counts["light"], next)
+	}
+}
+
+func TestBench(t *testing.T) {
+	s := grmlntest.NewServer(grmlntest.NewGraph().Handler())
+	defer s.Close()
+
+	file := filepath.Join(t.TempDir(), "workload.json")
+	err := os.WriteFile(file, []byte(`{"queries": [
+		{"name": "count", "gremlin": "g.V().count()", "weight": 3},
+		{"name": "add", "gremlin": "g.addV('person').property('name', name)", "bindings": {"name": {"type": "string"}}}
+	]}`), 0600)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	code := run([]string{"bench", "-addr", s.URL, "-requests", "50", "-concurrency", "4", file}, nil, &stdout, &stderr)
+	if code != 0 {
+		t.Fatalf("expected exit code 0 but got %d: %s", code, stderr.String())
+	}
+
+	out := stdout.String()
+	for _, expected := range []string{"50 requests", "50 succeeded, 0 failed", "latency histogram:", "count", "add", s.URL} {
+		if !strings.Contains(out, expected) {
+			t.Fatalf("expected report to contain %q but got:\n%s", expected, out)
+		}
+	}
+}
+
+func TestBenchEnd(t *testing.T) {
+	s := grmlntest.NewServer(grmlntest.NewScriptMux().
+		Handle("slow", grmlntest.Delay(time.Millisecond*100, grmlntest.Results([]int{1}))).
+		Fallback(grmlntest.Error(grmln.StatusServerError, "failed")))
+	defer s.Close()
+
+	dir := writeFiles(t, map[string]string{
+		"slow.json": `{"queries": [{"name": "slow", "gremlin": "slow"}]}`,
+		"bad.json":  `{"queries": [{"name": "bad", "gremlin": "bad"}]}`,
+	})
+
+	// Requests in flight when the duration ends are waited for and reported
+	var stdout, stderr bytes.Buffer
+	code := run([]string{"bench", "-addr", s.URL, "-duration", "20ms", "-concurrency", "2", filepath.Join(dir, "slow.json")}, nil, &stdout, &stderr)
+	if code != 0 || !strings.Contains(stdout.String(), "2 requests") || !strings.Contains(stdout.String(), "2 succeeded, 0 failed") {
+		t.Fatalf("expected the in-flight requests to be reported but got exit code %d:\n%s%s", code, stdout.String(), stderr.String())
+	}
+
+	// Failed requests fail the run
+	stdout.Reset()
+	code = run([]string{"bench", "-addr", s.URL, "-requests", "3", filepath.Join(dir, "bad.json")}, nil, &stdout, &stderr)
+	if code != 1 || !strings.Contains(stdout.String(), "0 succeeded, 3 failed") {
+		t.Fatalf("expected failures to fail the run but got exit code %d:\n%s", code, stdout.String())
+	}
+}
+
+func TestBenchFlags(t *testing.T) {
+	tests := []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"-rate", "2e9"}, "rate must be between 0 and 1000000000"},
+		{[]string{"-rate", "-1"}, "rate must be between 0 and 1000000000"},
+		{[]string{"-rate", "NaN"}, "rate must be between 0 and 1000000000"},
+		{[]string{"-requests", "-1"}, "requests must not be negative"},
+	}
+
+	for _, test := range tests {
+		var stdout, stderr bytes.Buffer
+		code := run(append(append([]string{"bench"}, test.args...), "workload.json"), nil, &stdout, &stderr)
+		if code != 2 || !strings.Contains(stderr.String(), test.expected) {
+			t.Fatalf("expected %v to fail with %q but got exit code %d: %s", test.args, test.expected, code, stderr.String())
+		}
+	}
+}
@@ -0,0 +1,487 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/evandigby/grmln"
+)
+
+const (
+	prompt             = "gremlin> "
+	sessionPrompt      = "gremlin[session]> "
+	continuationPrompt = "......> "
+)
+
+// console is an interactive gremlin console
+type console struct {
+	op      *grmln.Operator
+	session *grmln.SessionOperator
+
+	// single is whether op uses a single connection. Sessions need one because a cluster sends each
+	// request to any of its servers
+	single bool
+	// reconnect replaces the single connection, which can't be used after an interrupted request
+	reconnect func() error
+
+	bindings grmln.Bindings
+	stats    bool
+	format   string
+
+	history     []string
+	historyFile string
+
+	in      *bufio.Reader
+	out     io.Writer
+	errOut  io.Writer
+	prompts bool
+}
+
+func runConsole(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("console", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+
+	var conn connFlags
+	conn.register(fs)
+
+	historyFile := fs.String("history", defaultHistoryFile(), "history file. Empty disables saved history")
+	stats := fs.Bool("stats", true, "print timing and frame statistics after each query")
+	format := fs.String("format", "json", "output format: "+formatNames())
+
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if _, err := newFormatter(*format, stdout); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+
+	c, err := conn.connect(context.Background(), stderr)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	defer func() { c.close() }()
+
+	con := &console{
+		op:          c.op,
+		single:      conn.single,
+		bindings:    grmln.Bindings{},
+		stats:       *stats,
+		format:      *format,
+		historyFile: *historyFile,
+		in:          bufio.NewReader(stdin),
+		out:         stdout,
+		errOut:      stderr,
+		prompts:     isTerminal(stdin),
+	}
+	if conn.single {
+		con.reconnect = func() error {
+			c.close()
+			next, err := conn.connect(context.Background(), stderr)
+			if err != nil {
+				return err
+			}
+			c, con.op = next, next.op
+			return nil
+		}
+	}
+	con.loadHistory()
+
+	return con.run()
+}
+
+func defaultHistoryFile() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".grmln_history")
+}
+
+func isTerminal(r io.Reader) bool {
+	f, ok := r.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// run reads and evaluates input until EOF or :quit. It returns the process exit code
+func (c *console) run() int {
+	defer c.closeSession()
+
+	for {
+		input, err := c.read()
+		if input != "" {
+			if quit := c.handle(input); quit {
+				return 0
+			}
+		}
+		if err == io.EOF {
+			return 0
+		}
+		if err != nil {
+			fmt.Fprintln(c.errOut, err)
+			return 1
+		}
+	}
+}
+
+// read reads a complete statement, continuing onto more lines while brackets or strings are open
+func (c *console) read() (string, error) {
+	var lines []string
+	for {
+		switch {
+		case !c.prompts:
+		case len(lines) > 0:
+			fmt.Fprint(c.out, continuationPrompt)
+		case c.session != nil:
+			fmt.Fprint(c.out, sessionPrompt)
+		default:
+			fmt.Fprint(c.out, prompt)
+		}
+
+		line, err := c.in.ReadString('\n')
+		line = strings.TrimRight(line, "\r\n")
+
+		// Blank lines before a statement are skipped, console commands are always a single line
+		if len(lines) == 0 && (strings.TrimSpace(line) == "" || strings.HasPrefix(strings.TrimSpace(line), ":")) {
+			if err != nil || strings.TrimSpace(line) != "" {
+				return strings.TrimSpace(line), err
+			}
+			continue
+		}
+
+		continued := strings.HasSuffix(line, "\\")
+		lines = append(lines, strings.TrimSuffix(line, "\\"))
+
+		statement := strings.Join(lines, "\n")
+		if err != nil || (!continued && !incomplete(statement)) {
+			return strings.TrimSpace(statement), err
+		}
+	}
+}
+
+// incomplete reports whether a statement has open brackets or strings, or ends with a dot or comma
+func incomplete(s string) bool {
+	depth := 0
+	var quote rune
+	escaped := false
+
+	for _, r := range s {
+		switch {
+		case escaped:
+			escaped = false
+		case quote != 0:
+			if r == '\\' {
+				escaped = true
+			} else if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"':
+			quote = r
+		case r == '(' || r == '[' || r == '{':
+			depth++
+		case r == ')' || r == ']' || r == '}':
+			depth--
+		}
+	}
+
+	trimmed := strings.TrimSpace(s)
+	return depth > 0 || quote != 0 || strings.HasSuffix(trimmed, ".") || strings.HasSuffix(trimmed, ",")
+}
+
+// handle runs a console command or evaluates a statement. It returns true to quit. Bound values may
+// be secrets so :bind isn't added to history
+func (c *console) handle(input string) bool {
+	if !strings.HasPrefix(input, ":!") && !strings.HasPrefix(input, ":bind") {
+		c.addHistory(input)
+	}
+
+	if !strings.HasPrefix(input, ":") {
+		c.eval(input)
+		return false
+	}
+
+	fields := strings.Fields(input)
+	switch fields[0] {
+	case ":quit", ":exit", ":q":
+		return true
+	case ":help", ":h":
+		c.help()
+	case ":session":
+		c.sessionCommand(fields[1:])
+	case ":bind":
+		c.bind(strings.TrimSpace(strings.TrimPrefix(input, ":bind")))
+	case ":unbind":
+		for _, name := range fields[1:] {
+			delete(c.bindings, name)
+		}
+	case ":stats":
+		if len(fields) > 1 {
+			c.stats = fields[1] == "on"
+		}
+		fmt.Fprintf(c.out, "stats %s\n", onOff(c.stats))
+	case ":format":
+		if len(fields) > 1 {
+			if _, err := newFormatter(fields[1], c.out); err != nil {
+				fmt.Fprintln(c.errOut, err)
+				return false
+			}
+			c.format = fields[1]
+		}
+		fmt.Fprintf(c.out, "format %s\n", c.format)
+	case ":history":
+		for i, h := range c.history {
+			fmt.Fprintf(c.out, "%4d  %s\n", i+1, strings.ReplaceAll(h, "\n", "\n      "))
+		}
+	default:
+		if strings.HasPrefix(fields[0], ":!") {
+			n, err := strconv.Atoi(strings.TrimPrefix(fields[0], ":!"))
+			if err != nil || n < 1 || n > len(c.history) {
+				fmt.Fprintf(c.errOut, "no history entry %q\n", strings.TrimPrefix(fields[0], ":!"))
+				return false
+			}
+			entry := c.history[n-1]
+			fmt.Fprintln(c.out, entry)
+			return c.handle(entry)
+		}
+		fmt.Fprintf(c.errOut, "unknown command %s. Type :help for help\n", fields[0])
+	}
+	return false
+}
+
+func (c *console) help() {
+	fmt.Fprint(c.out, `:help                  show this help
+:quit                  exit the console
+:session [on|off]      evaluate in a session so variables are kept between statements. Requires -single
+:bind name value       bind a variable. value is JSON, otherwise it is a string
+:bind                  list bound variables
+:unbind name...        remove bound variables
+:stats [on|off]        print timing and frame statistics after each query
+:format [name]         set the output format: json, ndjson, table, csv or tree
+:history               list history
+:!n                    run history entry n
+
+Statements continue onto the next line while brackets or strings are open,
+the line ends with . or , or the line ends with \
+`)
+}
+
+func onOff(b bool) string {
+	if b {
+		return "on"
+	}
+	return "off"
+}
+
+func (c *console) sessionCommand(args []string) {
+	on := c.session == nil
+	if len(args) > 0 {
+		on = args[0] == "on"
+	}
+
+	switch {
+	case on && c.session == nil && !c.single:
+		fmt.Fprintln(c.errOut, "sessions require -single")
+	case on && c.session == nil:
+		c.session = c.op.NewSession()
+	case !on:
+		c.closeSession()
+	}
+	fmt.Fprintf(c.out, "session %s\n", onOff(c.session != nil))
+}
+
+func (c *console) closeSession() {
+	if c.session == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	if err := c.session.CloseDefault(ctx); err != nil {
+		fmt.Fprintf(c.errOut, "error closing session: %v\n", err)
+	}
+	c.session = nil
+}
+
+func (c *console) bind(arg string) {
+	if arg == "" {
+		names := make([]string, 0, len(c.bindings))
+		for name := range c.bindings {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			value, _ := json.Marshal(c.bindings[name])
+			fmt.Fprintf(c.out, "%s = %s\n", name, value)
+		}
+		return
+	}
+
+	parts := strings.SplitN(arg, " ", 2)
+	if len(parts) != 2 {
+		fmt.Fprintln(c.errOut, "usage: :bind name value")
+		return
+	}
+
+	name, raw := parts[0], strings.TrimSpace(parts[1])
+	var value interface{}
+	if err := json.Unmarshal([]byte(raw), &value); err != nil {
+		value = raw
+	}
+	c.bindings[name] = value
+}
+
+// queryStats are the statistics printed after each query
+type queryStats struct {
+	frames     int
+	partial    int
+	results    int
+	firstFrame time.Duration
+	total      time.Duration
+}
+
+func (s queryStats) String() string {
+	return fmt.Sprintf("%d results in %d frames (%d partial). first frame %v, total %v",
+		s.results, s.frames, s.partial, s.firstFrame.Round(time.Microsecond), s.total.Round(time.Microsecond))
+}
+
+func (c *console) eval(gremlin string) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Interrupts cancel the query rather than exiting the console
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	defer signal.Stop(interrupts)
+	go func() {
+		select {
+		case <-interrupts:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	// newFormatter can't fail here, the format name is checked when it's set
+	f, _ := newFormatter(c.format, c.out)
+
+	var stats queryStats
+	start := time.Now()
+
+	onResponse := func(resp *grmln.Response) {
+		if stats.frames == 0 {
+			stats.firstFrame = time.Since(start)
+		}
+		stats.frames++
+		if resp.Status.Code == grmln.StatusPartialContent {
+			stats.partial++
+		}
+
+		results, err := decodeResults(resp.Result.Data)
+		if err != nil {
+			fmt.Fprintln(c.out, string(resp.Result.Data))
+			return
+		}
+		stats.results += len(results)
+
+		if err := f.Frame(results); err != nil {
+			fmt.Fprintf(c.errOut, "error writing results: %v\n", err)
+		}
+	}
+
+	bindings := grmln.Bindings(nil)
+	if len(c.bindings) > 0 {
+		bindings = c.bindings
+	}
+
+	var err error
+	if c.session != nil {
+		err = c.session.EvalDefault(ctx, gremlin, bindings, onResponse)
+	} else {
+		err = c.op.EvalDefault(ctx, gremlin, bindings, onResponse)
+	}
+	stats.total = time.Since(start)
+	f.End()
+
+	if err != nil {
+		fmt.Fprintf(c.errOut, "error: %v\n", err)
+	}
+	if c.stats {
+		fmt.Fprintln(c.errOut, stats)
+	}
+
+	if err == context.Canceled && c.reconnect != nil {
+		c.reopen()
+	}
+}
+
+// reopen replaces the single connection after an interrupted query. The session is on the old
+// connection so it ends
+func (c *console) reopen() {
+	if c.session != nil {
+		c.session = nil
+		fmt.Fprintln(c.out, "session off")
+	}
+
+	if err := c.reconnect(); err != nil {
+		fmt.Fprintf(c.errOut, "error reconnecting: %v\n", err)
+	}
+}
+
+func (c *console) loadHistory() {
+	if c.historyFile == "" {
+		return
+	}
+
+	f, err := os.Open(c.historyFile)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	s.Buffer(nil, 1024*1024)
+	for s.Scan() {
+		var entry string
+		if json.Unmarshal(s.Bytes(), &entry) == nil {
+			c.history = append(c.history, entry)
+		}
+	}
+}
+
+// addHistory records an entry, saving it if there is a history file. Entries are saved as JSON strings so multi-line statements survive
+func (c *console) addHistory(entry string) {
+	if len(c.history) > 0 && c.history[len(c.history)-1] == entry {
+		return
+	}
+	c.history = append(c.history, entry)
+
+	if c.historyFile == "" {
+		return
+	}
+
+	f, err := os.OpenFile(c.historyFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	b, _ := json.Marshal(entry)
+	f.Write(append(b, '\n'))
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/evandigby/grmln/grmlntest"
+)
+
+func TestIncomplete(t *testing.T) {
+	tests := map[string]bool{
+		"g.V()":                     false,
+		"g.V().":                    true,
+		"g.V().has('name',":         true,
+		"g.V().has('name', 'a)')":   false,
+		"g.V().has('name', 'a(":     true,
+		"g.inject([1, 2]).unfold()": false,
+		"g.inject([1,\n2":           true,
+	}
+
+	for s, expected := range tests {
+		if actual := incomplete(s); actual != expected {
+			t.Errorf("%q: expected %v but got %v", s, expected, actual)
+		}
+	}
+}
+
+func TestConsole(t *testing.T) {
+	s := grmlntest.NewServer(grmlntest.NewGraph().Handler())
+	defer s.Close()
+
+	history := filepath.Join(t.TempDir(), "history")
+
+	input := strings.Join([]string{
+		`:bind name "marko"`,
+		`g.addV('person').`,
+		`  property('name', name)`,
+		``,
+		`g.V().values('name')`,
+		`:session on`,
+		`g.V().count()`,
+		`:session off`,
+		`:!2`,
+		`:quit`,
+		`g.V().drop()`,
+	}, "\n")
+
+	var stdout, stderr bytes.Buffer
+	code := run([]string{"console", "-addr", s.URL, "-single", "-history", history}, strings.NewReader(input), &stdout, &stderr)
+	if code != 0 {
+		t.Fatalf("expected exit code 0 but got %d: %s", code, stderr.String())
+	}
+
+	out := stdout.String()
+	for _, expected := range []string{`"marko"`, "session on", "session off", "g.V().values('name')"} {
+		if !strings.Contains(out, expected) {
+			t.Fatalf("expected output to contain %q but got:\n%s", expected, out)
+		}
+	}
+	if n := strings.Count(out, "\n\"marko\"\n"); n != 2 {
+		t.Fatalf("expected history to re-run the query but got:\n%s", out)
+	}
+
+	if n := strings.Count(stderr.String(), "1 results in 1 frames (0 partial)"); n != 4 {
+		t.Fatalf("expected stats for 4 queries but got:\n%s", stderr.String())
+	}
+
+	// History is kept between runs, without bound values
+	stdout.Reset()
+	code = run([]string{"console", "-addr", s.URL, "-history", history}, strings.NewReader(":history"), &stdout, &stderr)
+	if code != 0 || !strings.Contains(stdout.String(), "g.addV('person').\n") {
+		t.Fatalf("expected saved history but got:\n%s", stdout.String())
+	}
+	if strings.Contains(stdout.String(), "marko") {
+		t.Fatalf("expected :bind not to be saved in history but got:\n%s", stdout.String())
+	}
+
+	// A cluster can't keep a session on one server
+	stdout.Reset()
+	stderr.Reset()
+	run([]string{"console", "-addr", s.URL, "-history", ""}, strings.NewReader(":session on"), &stdout, &stderr)
+	if !strings.Contains(stderr.String(), "sessions require -single") || !strings.Contains(stdout.String(), "session off") {
+		t.Fatalf("expected sessions to require -single but got:\n%s%s", stdout.String(), stderr.String())
+	}
+}
+
+func TestConsoleInterrupt(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("interrupts can't be sent to the process on windows")
+	}
+
+	s := grmlntest.NewServer(grmlntest.NewScriptMux().
+		Handle("slow", grmlntest.Delay(time.Second, grmlntest.Results([]int{1}))).
+		Handle("fast", grmlntest.Results([]int{2})))
+	defer s.Close()
+
+	p, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	time.AfterFunc(time.Millisecond*100, func() {
+		p.Signal(os.Interrupt)
+	})
+
+	// The interrupt stops the slow query and the console carries on with a new connection
+	var stdout, stderr bytes.Buffer
+	start := time.Now()
+	code := run([]string{"console", "-addr", s.URL, "-single", "-history", ""}, strings.NewReader("slow\nfast\n"), &stdout, &stderr)
+	if code != 0 {
+		t.Fatalf("expected exit code 0 but got %d: %s", code, stderr.String())
+	}
+	if elapsed := time.Since(start); elapsed > time.Millisecond*800 {
+		t.Fatalf("expected the interrupt to stop the query but it took %v", elapsed)
+	}
+	if !strings.Contains(stderr.String(), "error: context canceled") || !strings.Contains(stdout.String(), "2") {
+		t.Fatalf("expected the query to be interrupted and the next to run but got:\n%s%s", stdout.String(), stderr.String())
+	}
+}
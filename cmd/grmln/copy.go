@@ -0,0 +1,574 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/evandigby/grmln"
+)
+
+// copyRules transform the properties of the elements with one label. They're applied in order:
+// keep, drop, set, hash, rename and then label
+type copyRules struct {
+	// Skip doesn't copy the elements. Edges of skipped vertices are skipped too
+	Skip bool `json:"skip"`
+
+	// Keep drops every property not listed
+	Keep []string `json:"keep"`
+	Drop []string `json:"drop"`
+
+	// Set replaces the values of existing properties, for redacting them
+	Set map[string]interface{} `json:"set"`
+
+	// Hash replaces values with the hex SHA-256 of the salt and value, so equal values stay equal.
+	// The config must have a salt
+	Hash []string `json:"hash"`
+
+	Rename map[string]string `json:"rename"`
+	Label  string            `json:"label"`
+}
+
+// copyConfig is the rules file. Rules are keyed by source label. The rules for "*" apply to every
+// label before its own rules
+type copyConfig struct {
+	Salt     string                `json:"salt"`
+	Vertices map[string]*copyRules `json:"vertices"`
+	Edges    map[string]*copyRules `json:"edges"`
+}
+
+func loadCopyConfig(path string) (*copyConfig, error) {
+	c := &copyConfig{}
+	if path == "" {
+		return c, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	dec := json.NewDecoder(f)
+	dec.UseNumber()
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(c); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	for _, rules := range []map[string]*copyRules{c.Vertices, c.Edges} {
+		for label, r := range rules {
+			// Unsalted hashes of guessable values such as emails can be reversed by hashing guesses
+			if len(r.Hash) > 0 && c.Salt == "" {
+				return nil, fmt.Errorf("%s: hash rules for %q require a salt", path, label)
+			}
+			for key, v := range r.Set {
+				r.Set[key] = plainValue(v)
+			}
+		}
+	}
+	return c, nil
+}
+
+// transform applies the rules for label to an element. It returns false if the element is skipped
+func (c *copyConfig) transform(rules map[string]*copyRules, label string, props []property) (string, []property, bool) {
+	newLabel := label
+	for _, name := range []string{"*", label} {
+		r := rules[name]
+		if r == nil {
+			continue
+		}
+		if r.Skip {
+			return "", nil, false
+		}
+		newLabel, props = r.apply(c.Salt, newLabel, props)
+	}
+	return newLabel, props, true
+}
+
+func (r *copyRules) apply(salt, label string, props []property) (string, []property) {
+	keep, drop, hash := stringSet(r.Keep), stringSet(r.Drop), stringSet(r.Hash)
+
+	out := make([]property, 0, len(props))
+	for _, p := range props {
+		if (len(keep) > 0 && !keep[p.key]) || drop[p.key] {
+			continue
+		}
+
+		if v, ok := r.Set[p.key]; ok {
+			p.value = v
+		} else if hash[p.key] {
+			sum := sha256.Sum256([]byte(salt + fmt.Sprint(p.value)))
+			p.value = hex.EncodeToString(sum[:])
+		}
+		if key, ok := r.Rename[p.key]; ok {
+			p.key = key
+		}
+		out = append(out, p)
+	}
+
+	if r.Label != "" {
+		label = r.Label
+	}
+	return label, out
+}
+
+func stringSet(list []string) map[string]bool {
+	set := make(map[string]bool, len(list))
+	for _, s := range list {
+		set[s] = true
+	}
+	return set
+}
+
+// idMap maps source vertex ids to target vertex ids. New entries are appended to a file as JSON Lines
+// so an interrupted copy can resume without copying vertices again
+type idMap struct {
+	mu  sync.Mutex
+	ids map[string]interface{}
+	w   io.Writer
+}
+
+type idMapEntry struct {
+	Source interface{} `json:"source"`
+	Target interface{} `json:"target"`
+}
+
+// loadIDMap reads the entries in path and opens it for appending. An empty path keeps the map in memory
+func loadIDMap(path string) (*idMap, func() error, error) {
+	m := &idMap{ids: map[string]interface{}{}}
+	if path == "" {
+		return m, func() error { return nil }, nil
+	}
+
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dec := json.NewDecoder(bufio.NewReader(f))
+	dec.UseNumber()
+	for {
+		var e idMapEntry
+		err := dec.Decode(&e)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			f.Close()
+			return nil, nil, fmt.Errorf("%s: %v", path, err)
+		}
+		m.ids[fmt.Sprint(plainValue(e.Source))] = plainValue(e.Target)
+	}
+
+	if _, err := f.Seek(0, io.SeekEnd); err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	m.w = f
+	return m, f.Close, nil
+}
+
+func (m *idMap) get(source interface{}) (interface{}, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	target, ok := m.ids[fmt.Sprint(source)]
+	return target, ok
+}
+
+func (m *idMap) set(source, target interface{}) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.ids[fmt.Sprint(source)] = target
+	if m.w == nil {
+		return nil
+	}
+
+	b, err := json.Marshal(idMapEntry{source, target})
+	if err != nil {
+		return err
+	}
+	_, err = m.w.Write(append(b, '\n'))
+	return err
+}
+
+func (m *idMap) len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.ids)
+}
+
+// copier copies vertices and then edges from one server to another. Vertices are upserted on their source
+// id, either as the target id or in an id property, and edges are wired through the id map
+type copier struct {
+	from     *exporter
+	to       *grmln.Operator
+	config   *copyConfig
+	preserve bool
+	idKey    string
+	ids      *idMap
+	rejects  *rejectLog
+
+	vertices int64
+	edges    int64
+	skipped  int64
+}
+
+func (c *copier) run(ctx context.Context) error {
+	err := c.from.scan(ctx, c.from.vertexBase(), func(page []map[string]interface{}) error {
+		var records []*importRecord
+		for _, v := range page {
+			id := plainValue(v["id"])
+			if _, ok := c.ids.get(id); ok {
+				continue
+			}
+
+			label, _ := v["label"].(string)
+			rec := &importRecord{id: id, raw: v}
+
+			var ok bool
+			rec.label, rec.props, ok = c.config.transform(c.config.Vertices, label, vertexPropertyList(v))
+			if !ok {
+				atomic.AddInt64(&c.skipped, 1)
+				continue
+			}
+			records = append(records, rec)
+		}
+		return c.write(ctx, "vertices", records)
+	})
+	if err != nil {
+		return err
+	}
+
+	return c.from.scan(ctx, c.from.edgeBase(), func(page []map[string]interface{}) error {
+		var records []*importRecord
+		for _, e := range page {
+			from, ok1 := c.ids.get(plainValue(e["outV"]))
+			to, ok2 := c.ids.get(plainValue(e["inV"]))
+			label, _ := e["label"].(string)
+			rec := &importRecord{edge: true, id: plainValue(e["id"]), from: endpoint{id: from}, to: endpoint{id: to}, raw: e}
+
+			var ok bool
+			rec.label, rec.props, ok = c.config.transform(c.config.Edges, label, edgePropertyList(e))
+			if !ok || !ok1 || !ok2 {
+				atomic.AddInt64(&c.skipped, 1)
+				continue
+			}
+			records = append(records, rec)
+		}
+		return c.write(ctx, "edges", records)
+	})
+}
+
+// vertexPropertyList returns a vertex's property values ordered by key
+func vertexPropertyList(v map[string]interface{}) []property {
+	props := vertexProperties(v)
+	keys := make([]string, 0, len(props))
+	for key := range props {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var list []property
+	for _, key := range keys {
+		for _, value := range props[key] {
+			list = append(list, property{key: key, value: plainValue(value)})
+		}
+	}
+	return list
+}
+
+func edgePropertyList(e map[string]interface{}) []property {
+	props, _ := e["properties"].(map[string]interface{})
+
+	var list []property
+	for _, key := range sortedKeys(props) {
+		list = append(list, property{key: key, value: plainValue(props[key])})
+	}
+	return list
+}
+
+// write upserts records as a single script. If the script fails each record is retried on its own
+// so only the records at fault are rejected. Errors that aren't caused by the records stop the copy
+func (c *copier) write(ctx context.Context, source string, records []*importRecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+
+	results, err := c.upsert(ctx, records)
+	if err == nil && len(results) == len(records) {
+		return c.finish(source, records, results)
+	}
+	if err != nil && !isResponseError(err) {
+		return err
+	}
+
+	for _, rec := range records {
+		results, err := c.upsert(ctx, []*importRecord{rec})
+		switch {
+		case err != nil && !isResponseError(err):
+			return err
+		case err != nil:
+			c.rejects.reject(source, rec, err)
+		case len(results) != 1:
+			c.rejects.reject(source, rec, fmt.Errorf("expected 1 result but got %d", len(results)))
+		default:
+			if err := c.finish(source, []*importRecord{rec}, results); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// finish records the target id of each vertex, or counts each edge. An edge upsert that wrote nothing
+// means its vertices were removed from the target
+func (c *copier) finish(source string, records []*importRecord, results []interface{}) error {
+	for i, rec := range records {
+		if rec.edge {
+			if fmt.Sprint(results[i]) == "0" {
+				c.rejects.reject(source, rec, errors.New("vertex not found"))
+				continue
+			}
+			atomic.AddInt64(&c.edges, 1)
+			continue
+		}
+
+		if err := c.ids.set(rec.id, plainValue(results[i])); err != nil {
+			return err
+		}
+		atomic.AddInt64(&c.vertices, 1)
+	}
+	return nil
+}
+
+func (c *copier) upsert(ctx context.Context, records []*importRecord) ([]interface{}, error) {
+	gremlin, bindings := c.script(records)
+	p := &pager{op: c.to}
+	return p.query(ctx, gremlin, bindings)
+}
+
+// script builds a list of upsert traversals with one result per record: the target id of a vertex,
+// or the number of edges written
+func (c *copier) script(records []*importRecord) (string, grmln.Bindings) {
+	bindings := grmln.Bindings{}
+	if !c.preserve {
+		bindings["k"] = c.idKey
+	}
+	statements := make([]string, len(records))
+
+	bind := func(name string, i int, v interface{}) string {
+		key := fmt.Sprintf("%s%d", name, i)
+		bindings[key] = v
+		return key
+	}
+
+	for i, rec := range records {
+		var b strings.Builder
+		label := bind("l", i, rec.label)
+		id := bind("i", i, rec.id)
+
+		switch {
+		case rec.edge && c.preserve:
+			fmt.Fprintf(&b, "g.V(%s).as('a').V(%s).coalesce(__.inE(%s).hasId(%s), __.addE(%s).from('a').property(T.id, %s))",
+				bind("f", i, rec.from.id), bind("t", i, rec.to.id), label, id, label, id)
+		case rec.edge:
+			fmt.Fprintf(&b, "g.V(%s).as('a').V(%s).coalesce(__.inE(%s).has(k, %s), __.addE(%s).from('a').property(k, %s))",
+				bind("f", i, rec.from.id), bind("t", i, rec.to.id), label, id, label, id)
+		case c.preserve:
+			fmt.Fprintf(&b, "g.V(%s).fold().coalesce(__.unfold(), __.addV(%s).property(T.id, %s))", id, label, id)
+		default:
+			fmt.Fprintf(&b, "g.V().has(%s, k, %s).fold().coalesce(__.unfold(), __.addV(%s).property(k, %s))",
+				label, id, label, id)
+		}
+
+		// The first value of a key replaces any values from an earlier copy, the rest are added to it
+		seen := map[string]bool{}
+		for j, p := range rec.props {
+			key := bind(fmt.Sprintf("pk%d_", i), j, p.key)
+			value := bind(fmt.Sprintf("pv%d_", i), j, p.value)
+			switch {
+			case rec.edge:
+				fmt.Fprintf(&b, ".property(%s, %s)", key, value)
+			case seen[p.key]:
+				fmt.Fprintf(&b, ".property(set, %s, %s)", key, value)
+			default:
+				fmt.Fprintf(&b, ".property(single, %s, %s)", key, value)
+			}
+			seen[p.key] = true
+		}
+
+		if rec.edge {
+			b.WriteString(".count().next()")
+		} else {
+			b.WriteString(".id().next()")
+		}
+		statements[i] = b.String()
+	}
+
+	return "[" + strings.Join(statements, ",\n") + "]", bindings
+}
+
+// progress reports the number of elements copied so far every interval until stop is closed
+func (c *copier) progress(w io.Writer, interval time.Duration, stop <-chan struct{}) {
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			fmt.Fprintf(w, "copied %d vertices and %d edges. %d skipped\n",
+				atomic.LoadInt64(&c.vertices), atomic.LoadInt64(&c.edges), atomic.LoadInt64(&c.skipped))
+		case <-stop:
+			return
+		}
+	}
+}
+
+func runCopy(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("copy", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: grmln copy -from-addr|-from-profile|-from-dsn source -to-addr|-to-profile|-to-dsn target [flags]")
+		fmt.Fprint(stderr, `
+Copies the graph, or the vertices matching -vertices and the edges between them, from one server to
+another. Vertices keep their ids with -ids preserve, or get new ids with the source id stored in the
+-id-key property. Source ids are mapped to target ids in the -id-map file so edges are wired to the
+right vertices and an interrupted copy can be resumed. A rules file transforms properties by label:
+
+  {"salt": "s3cret",
+   "vertices": {"*":      {"drop": ["ssn"]},
+                "person": {"hash": ["email"], "set": {"phone": "redacted"}, "rename": {"name": "fullName"}},
+                "audit":  {"skip": true}},
+   "edges":    {"knows":  {"keep": ["since"], "label": "friend"}}}
+
+`)
+		fs.PrintDefaults()
+	}
+
+	var from, to connFlags
+	from.registerPrefix(fs, "from-", "source ")
+	to.registerPrefix(fs, "to-", "target ")
+
+	vertexFilter := fs.String("vertices", "", "steps filtering the vertices to copy")
+	edgeFilter := fs.String("edges", "", "steps filtering the edges to copy")
+	ids := fs.String("ids", "remap", "vertex and edge ids: preserve or remap")
+	idKey := fs.String("id-key", "sourceId", "property holding the source id of remapped elements")
+	rulesFile := fs.String("rules", "", "property transformation rules file")
+	idMapFile := fs.String("id-map", "", "file mapping source to target vertex ids, to resume from and append to")
+	rejectsFile := fs.String("rejects", "", "file to append rejected elements to as JSON Lines")
+	paging := fs.String("paging", "id", "pagination: id (ordered by id, starting after the last id) or range")
+	pageSize := fs.Int("page", 100, "elements per page, and per upsert script")
+	partitions := fs.Int("partitions", 1, "number of partitions to copy in parallel")
+	progress := fs.Duration("progress", time.Second*5, "how often to report progress. 0 disables progress")
+
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if (len(from.addrs) == 0 && !from.usesProfile()) || (len(to.addrs) == 0 && !to.usesProfile()) {
+		fs.Usage()
+		return 2
+	}
+	if *ids != "preserve" && *ids != "remap" {
+		fmt.Fprintf(stderr, "unknown ids %q\n", *ids)
+		return 2
+	}
+	if *paging != "id" && *paging != "range" {
+		fmt.Fprintf(stderr, "unknown paging %q\n", *paging)
+		return 2
+	}
+	if *pageSize < 1 || *partitions < 1 {
+		fmt.Fprintln(stderr, "page and partitions must be at least 1")
+		return 2
+	}
+
+	config, err := loadCopyConfig(*rulesFile)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+
+	m, closeIDMap, err := loadIDMap(*idMapFile)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	defer closeIDMap()
+
+	rejects := &rejectLog{}
+	if *rejectsFile != "" {
+		f, err := os.OpenFile(*rejectsFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		defer f.Close()
+		rejects.w = f
+	}
+
+	source, err := from.connect(context.Background(), stderr)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	defer source.close()
+
+	target, err := to.connect(context.Background(), stderr)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	defer target.close()
+
+	c := &copier{
+		from: &exporter{
+			op:           source.op,
+			vertexFilter: *vertexFilter,
+			edgeFilter:   *edgeFilter,
+			paging:       *paging,
+			pageSize:     *pageSize,
+			partitions:   *partitions,
+		},
+		to:       target.op,
+		config:   config,
+		preserve: *ids == "preserve",
+		idKey:    *idKey,
+		ids:      m,
+		rejects:  rejects,
+	}
+
+	start := time.Now()
+	stop := make(chan struct{})
+	go c.progress(stderr, *progress, stop)
+
+	err = c.run(context.Background())
+	close(stop)
+	if err != nil {
+		fmt.Fprintf(stderr, "copy stopped: %v\n", err)
+		return 1
+	}
+
+	fmt.Fprintf(stdout, "copied %d vertices and %d edges in %v. %d skipped, %d rejected, %d ids mapped\n",
+		c.vertices, c.edges, round(time.Since(start)), c.skipped, rejects.count, m.len())
+	if rejects.count > 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/evandigby/grmln/grmlntest"
+)
+
+func TestCopy(t *testing.T) {
+	source := grmlntest.NewServer(newExportGraph(t).Handler())
+	defer source.Close()
+
+	g := grmlntest.NewGraph()
+	target := grmlntest.NewServer(g.Handler())
+	defer target.Close()
+
+	dir := writeFiles(t, map[string]string{
+		"rules.json": `{
+  "vertices": {"*": {"drop": ["age"]}, "person": {"rename": {"name": "fullName"}}, "software": {"skip": true}},
+  "edges": {"knows": {"label": "friend", "set": {"weight": 1}}}
+}`,
+	})
+	args := []string{"copy", "-from-addr", source.URL, "-to-addr", target.URL, "-page", "1", "-progress", "0",
+		"-rules", filepath.Join(dir, "rules.json"), "-id-map", filepath.Join(dir, "ids.jsonl")}
+
+	var stdout, stderr bytes.Buffer
+	if code := run(args, nil, &stdout, &stderr); code != 0 {
+		t.Fatalf("expected exit code 0 but got %d: %s", code, stderr.String())
+	}
+	if !strings.HasPrefix(stdout.String(), "copied 2 vertices and 1 edges") || !strings.HasSuffix(stdout.String(), "2 skipped, 0 rejected, 2 ids mapped\n") {
+		t.Fatalf("unexpected summary %q", stdout.String())
+	}
+
+	checks := map[string]string{
+		"g.V().order().by('sourceId').values('sourceId', 'fullName')": "1,marko,4,vadas",
+		"g.V().properties('age').count()":                             "0",
+		"g.E().hasLabel('friend').outV().values('fullName')":          "marko",
+		"g.E().values('weight', 'sourceId')":                          "1,9",
+	}
+	for gremlin, expected := range checks {
+		if actual := evalGraph(t, g, gremlin); actual != expected {
+			t.Fatalf("expected %s to return %q but got %q", gremlin, expected, actual)
+		}
+	}
+
+	// The id map lets a second run skip the copied vertices and upsert the same edges
+	stdout.Reset()
+	if code := run(args, nil, &stdout, &stderr); code != 0 {
+		t.Fatalf("expected exit code 0 but got %d: %s", code, stderr.String())
+	}
+	if !strings.HasPrefix(stdout.String(), "copied 0 vertices and 1 edges") {
+		t.Fatalf("unexpected summary %q", stdout.String())
+	}
+	if actual := evalGraph(t, g, "g.E().count()"); actual != "1" {
+		t.Fatalf("expected 1 edge but got %s", actual)
+	}
+}
+
+func TestCopyPreserveIDs(t *testing.T) {
+	source := grmlntest.NewServer(newExportGraph(t).Handler())
+	defer source.Close()
+
+	g := grmlntest.NewGraph()
+	target := grmlntest.NewServer(g.Handler())
+	defer target.Close()
+
+	var stdout, stderr bytes.Buffer
+	args := []string{"copy", "-from-addr", source.URL, "-to-addr", target.URL, "-ids", "preserve", "-partitions", "2", "-progress", "0"}
+	if code := run(args, nil, &stdout, &stderr); code != 0 {
+		t.Fatalf("expected exit code 0 but got %d: %s", code, stderr.String())
+	}
+
+	checks := map[string]string{
+		"g.V().order().by(T.id).id()":         "1,4,7",
+		"g.V(1).outE().order().by(T.id).id()": "9,10",
+		"g.V(1).out('knows').values('name')":  "vadas",
+		"g.V().has('sourceId').count()":       "0",
+		"g.E(10).values('weight')":            "0.4",
+	}
+	for gremlin, expected := range checks {
+		if actual := evalGraph(t, g, gremlin); actual != expected {
+			t.Fatalf("expected %s to return %q but got %q", gremlin, expected, actual)
+		}
+	}
+}
+
+func TestCopyRulesSalt(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"rules.json": `{"vertices": {"person": {"hash": ["email"]}}}`,
+	})
+
+	var stdout, stderr bytes.Buffer
+	args := []string{"copy", "-from-addr", "ws://127.0.0.1:1/gremlin", "-to-addr", "ws://127.0.0.1:1/gremlin", "-rules", filepath.Join(dir, "rules.json")}
+	if code := run(args, nil, &stdout, &stderr); code == 0 || !strings.Contains(stderr.String(), `hash rules for "person" require a salt`) {
+		t.Fatalf("expected a missing salt error but got exit code %d: %s", code, stderr.String())
+	}
+}
@@ -0,0 +1,497 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/evandigby/grmln"
+)
+
+// schemaKey is a property key and the GraphML type of its values
+type schemaKey struct {
+	name string
+	typ  string
+}
+
+// exportSchema is the property keys in the exported graph
+type exportSchema struct {
+	vertexKeys []schemaKey
+	edgeKeys   []schemaKey
+}
+
+// exportWriter writes pages of exported elements. Elements are decoded results: maps with a type of vertex or edge
+type exportWriter interface {
+	// Begin is called before any elements are written
+	Begin(schema exportSchema) error
+
+	Vertices(page []map[string]interface{}) error
+	Edges(page []map[string]interface{}) error
+
+	// End is called after every element is written
+	End() error
+}
+
+// adjacencyWriter is implemented by writers that want each vertex with its out edges instead of separate edges
+type adjacencyWriter interface {
+	adjacency()
+}
+
+// schemaWriter is implemented by writers that need the property keys before writing
+type schemaWriter interface {
+	needsSchema()
+}
+
+// pager fetches a traversal's results a page at a time
+type pager struct {
+	op       *grmln.Operator
+	base     string
+	paging   string
+	pageSize int
+}
+
+func (p *pager) query(ctx context.Context, gremlin string, bindings grmln.Bindings) ([]interface{}, error) {
+	var results []interface{}
+	var decodeErr error
+	err := p.op.EvalDefault(ctx, gremlin, bindings, func(resp *grmln.Response) {
+		r, err := decodeResults(resp.Result.Data)
+		if err != nil {
+			decodeErr = err
+			return
+		}
+		results = append(results, r...)
+	})
+	if err == nil {
+		err = decodeErr
+	}
+	return results, err
+}
+
+// partitions splits the scan into n partitions. Range paging interleaves pages between partitions, id paging
+// splits the id space, which only works for numeric ids. Other ids are scanned in a single partition
+func (p *pager) partitions(ctx context.Context, n int) ([]func(ctx context.Context, page func([]interface{}) error) error, error) {
+	var scans []func(ctx context.Context, page func([]interface{}) error) error
+
+	if p.paging == "range" {
+		for i := 0; i < n; i++ {
+			i := i
+			scans = append(scans, func(ctx context.Context, page func([]interface{}) error) error {
+				return p.scanRange(ctx, i, n, page)
+			})
+		}
+		return scans, nil
+	}
+
+	if n > 1 {
+		smallest, err := p.query(ctx, p.base+".id().min()", nil)
+		if err != nil {
+			return nil, err
+		}
+		largest, err := p.query(ctx, p.base+".id().max()", nil)
+		if err != nil {
+			return nil, err
+		}
+
+		lo, hi, ok := int64(0), int64(0), len(smallest) == 1 && len(largest) == 1
+		if ok {
+			lo, hi, ok = numericBounds(smallest[0], largest[0])
+		}
+		if ok {
+			span := (hi - lo + int64(n)) / int64(n)
+			for i := 0; i < n; i++ {
+				from, to := lo+int64(i)*span, lo+int64(i+1)*span
+				if i == n-1 {
+					to = hi + 1
+				}
+				filter := fmt.Sprintf(".has(T.id, gte(%dL)).has(T.id, lt(%dL))", from, to)
+				scans = append(scans, func(ctx context.Context, page func([]interface{}) error) error {
+					return p.scanIDs(ctx, filter, page)
+				})
+			}
+			return scans, nil
+		}
+	}
+
+	return append(scans, func(ctx context.Context, page func([]interface{}) error) error {
+		return p.scanIDs(ctx, "", page)
+	}), nil
+}
+
+func numericBounds(a, b interface{}) (int64, int64, bool) {
+	lo, ok1 := plainValue(a).(int64)
+	hi, ok2 := plainValue(b).(int64)
+	return lo, hi, ok1 && ok2 && lo <= hi
+}
+
+// scanRange fetches every nth page starting at page i. Elements are ordered by id so pages are stable
+func (p *pager) scanRange(ctx context.Context, i, n int, page func([]interface{}) error) error {
+	for ; ; i += n {
+		results, err := p.query(ctx, fmt.Sprintf("%s.order().by(T.id).range(lo, hi)", p.base), grmln.Bindings{
+			"lo": i * p.pageSize,
+			"hi": (i + 1) * p.pageSize,
+		})
+		if err != nil {
+			return err
+		}
+		if len(results) > 0 {
+			if err := page(results); err != nil {
+				return err
+			}
+		}
+		if len(results) < p.pageSize {
+			return nil
+		}
+	}
+}
+
+// scanIDs fetches pages in id order, starting each page after the last id of the previous one
+func (p *pager) scanIDs(ctx context.Context, filter string, page func([]interface{}) error) error {
+	var last interface{}
+	for {
+		gremlin := p.base + filter
+		bindings := grmln.Bindings{"n": p.pageSize}
+		if last != nil {
+			gremlin += ".has(T.id, gt(last))"
+			bindings["last"] = last
+		}
+
+		results, err := p.query(ctx, gremlin+".order().by(T.id).limit(n)", bindings)
+		if err != nil {
+			return err
+		}
+		if len(results) > 0 {
+			if err := page(results); err != nil {
+				return err
+			}
+
+			e, _ := results[len(results)-1].(map[string]interface{})
+			if e == nil || e["id"] == nil {
+				return fmt.Errorf("id paging requires elements with ids")
+			}
+			last = plainValue(e["id"])
+		}
+		if len(results) < p.pageSize {
+			return nil
+		}
+	}
+}
+
+// exporter scans vertices and then edges and writes them
+type exporter struct {
+	op           *grmln.Operator
+	vertexFilter string
+	edgeFilter   string
+	paging       string
+	pageSize     int
+	partitions   int
+
+	mu sync.Mutex
+	w  exportWriter
+
+	vertices int64
+	edges    int64
+}
+
+func (e *exporter) vertexBase() string {
+	return "g.V()" + e.vertexFilter
+}
+
+// edgeBase scans edges matching the edge filter. With a vertex filter only edges between the
+// filtered vertices are scanned
+func (e *exporter) edgeBase() string {
+	if e.vertexFilter != "" {
+		return e.vertexBase() + ".outE()" + e.inVFilter() + e.edgeFilter
+	}
+	return "g.E()" + e.edgeFilter
+}
+
+// inVFilter keeps edges whose target passes the vertex filter, so no edge points at a vertex that
+// wasn't exported
+func (e *exporter) inVFilter() string {
+	if e.vertexFilter == "" {
+		return ""
+	}
+	return ".where(__.inV()" + e.vertexFilter + ")"
+}
+
+func (e *exporter) run(ctx context.Context) error {
+	_, adjacency := e.w.(adjacencyWriter)
+	_, needsSchema := e.w.(schemaWriter)
+
+	var schema exportSchema
+	if needsSchema {
+		var err error
+		if schema.vertexKeys, err = e.keys(ctx, e.vertexBase()); err != nil {
+			return err
+		}
+		if schema.edgeKeys, err = e.keys(ctx, e.edgeBase()); err != nil {
+			return err
+		}
+	}
+
+	if err := e.w.Begin(schema); err != nil {
+		return err
+	}
+
+	err := e.scan(ctx, e.vertexBase(), func(page []map[string]interface{}) error {
+		if adjacency {
+			if err := e.attachOutEdges(ctx, page); err != nil {
+				return err
+			}
+		}
+
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		atomic.AddInt64(&e.vertices, int64(len(page)))
+		return e.w.Vertices(page)
+	})
+	if err != nil {
+		return err
+	}
+
+	if !adjacency {
+		err := e.scan(ctx, e.edgeBase(), func(page []map[string]interface{}) error {
+			e.mu.Lock()
+			defer e.mu.Unlock()
+			atomic.AddInt64(&e.edges, int64(len(page)))
+			return e.w.Edges(page)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return e.w.End()
+}
+
+// scan runs a partitioned scan of base, calling page for each page of elements
+func (e *exporter) scan(ctx context.Context, base string, page func([]map[string]interface{}) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	p := &pager{op: e.op, base: base, paging: e.paging, pageSize: e.pageSize}
+	scans, err := p.partitions(ctx, e.partitions)
+	if err != nil {
+		return err
+	}
+
+	errs := make(chan error, len(scans))
+	for _, scan := range scans {
+		scan := scan
+		go func() {
+			errs <- scan(ctx, func(results []interface{}) error {
+				elements := make([]map[string]interface{}, 0, len(results))
+				for _, r := range results {
+					m, ok := r.(map[string]interface{})
+					if !ok || m["type"] == nil {
+						return fmt.Errorf("expected vertices or edges but got %s", short(r))
+					}
+					elements = append(elements, m)
+				}
+				return page(elements)
+			})
+		}()
+	}
+
+	var first error
+	for range scans {
+		if err := <-errs; err != nil && first == nil {
+			first = err
+			cancel()
+		}
+	}
+	return first
+}
+
+// attachOutEdges adds each vertex's out edges to it as outE, grouped by label
+func (e *exporter) attachOutEdges(ctx context.Context, page []map[string]interface{}) error {
+	ids := make([]interface{}, len(page))
+	byID := make(map[string]map[string]interface{}, len(page))
+	for i, v := range page {
+		ids[i] = plainValue(v["id"])
+		byID[fmt.Sprint(ids[i])] = v
+	}
+
+	p := &pager{op: e.op}
+	edges, err := p.query(ctx, "g.V(ids).outE()"+e.inVFilter()+e.edgeFilter, grmln.Bindings{"ids": ids})
+	if err != nil {
+		return err
+	}
+
+	for _, r := range edges {
+		edge, ok := r.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		v := byID[fmt.Sprint(plainValue(edge["outV"]))]
+		if v == nil {
+			continue
+		}
+
+		outE, _ := v["outE"].(map[string]interface{})
+		if outE == nil {
+			outE = map[string]interface{}{}
+			v["outE"] = outE
+		}
+		label, _ := edge["label"].(string)
+		list, _ := outE[label].([]interface{})
+		outE[label] = append(list, edge)
+		atomic.AddInt64(&e.edges, 1)
+	}
+	return nil
+}
+
+// keys finds the property keys of the elements base returns, typed by a sample value
+func (e *exporter) keys(ctx context.Context, base string) ([]schemaKey, error) {
+	p := &pager{op: e.op}
+	names, err := p.query(ctx, base+".properties().key().dedup()", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]schemaKey, 0, len(names))
+	for _, n := range names {
+		name := fmt.Sprint(n)
+		samples, err := p.query(ctx, base+".properties(key).value().limit(1)", grmln.Bindings{"key": name})
+		if err != nil {
+			return nil, err
+		}
+
+		typ := "string"
+		if len(samples) > 0 {
+			typ = graphMLType(plainValue(samples[0]))
+		}
+		keys = append(keys, schemaKey{name: name, typ: typ})
+	}
+	return keys, nil
+}
+
+func graphMLType(v interface{}) string {
+	switch v.(type) {
+	case int64:
+		return "long"
+	case float64:
+		return "double"
+	case bool:
+		return "boolean"
+	}
+	return "string"
+}
+
+// progress reports the number of elements exported so far every interval until stop is closed
+func (e *exporter) progress(w io.Writer, interval time.Duration, stop <-chan struct{}) {
+	if interval <= 0 {
+		return
+	}
+
+	start := time.Now()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			v, ed := atomic.LoadInt64(&e.vertices), atomic.LoadInt64(&e.edges)
+			fmt.Fprintf(w, "exported %d vertices and %d edges (%.0f/s)\n", v, ed, float64(v+ed)/time.Since(start).Seconds())
+		case <-stop:
+			return
+		}
+	}
+}
+
+func runExport(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: grmln export [flags]")
+		fmt.Fprint(stderr, `
+Exports the graph, or the vertices matching -vertices and their out edges, a page at a time.
+Filters are traversal steps appended to g.V() or g.E(), for example -vertices "hasLabel('person')".
+Formats are graphson (adjacency list, one vertex per line), graphml, csv (vertices.csv and edges.csv
+in the -out directory) and dot.
+
+`)
+		fs.PrintDefaults()
+	}
+
+	var conn connFlags
+	conn.register(fs)
+
+	format := fs.String("format", "graphson", "output format: "+exportFormatNames())
+	out := fs.String("out", "-", "output file, or directory for csv. - writes to stdout")
+	vertexFilter := fs.String("vertices", "", "steps filtering the vertices to export. Only edges between exported vertices are exported")
+	edgeFilter := fs.String("edges", "", "steps filtering the edges to export")
+	paging := fs.String("paging", "id", "pagination: id (ordered by id, starting after the last id) or range")
+	pageSize := fs.Int("page", 1000, "elements per page")
+	partitions := fs.Int("partitions", 1, "number of partitions to scan in parallel")
+	progress := fs.Duration("progress", time.Second*5, "how often to report progress. 0 disables progress")
+
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *paging != "id" && *paging != "range" {
+		fmt.Fprintf(stderr, "unknown paging %q\n", *paging)
+		return 2
+	}
+	if *pageSize < 1 || *partitions < 1 {
+		fmt.Fprintln(stderr, "page and partitions must be at least 1")
+		return 2
+	}
+
+	w, closeWriter, err := newExportWriter(*format, *out, stdout)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+
+	c, err := conn.connect(context.Background(), stderr)
+	if err != nil {
+		closeWriter()
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	defer c.close()
+
+	e := &exporter{
+		op:           c.op,
+		vertexFilter: *vertexFilter,
+		edgeFilter:   *edgeFilter,
+		paging:       *paging,
+		pageSize:     *pageSize,
+		partitions:   *partitions,
+		w:            w,
+	}
+
+	start := time.Now()
+	stop := make(chan struct{})
+	go e.progress(stderr, *progress, stop)
+
+	err = e.run(context.Background())
+	close(stop)
+	if cerr := closeWriter(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "export failed: %v\n", err)
+		return 1
+	}
+
+	fmt.Fprintf(stderr, "exported %d vertices and %d edges in %v\n", e.vertices, e.edges, round(time.Since(start)))
+	return 0
+}
+
+func createFile(path string, stdout io.Writer) (io.Writer, func() error, error) {
+	if path == "-" {
+		return stdout, func() error { return nil }, nil
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return f, f.Close, nil
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/evandigby/grmln/grmlntest"
+)
+
+func newExportGraph(t *testing.T) *grmlntest.Graph {
+	g := grmlntest.NewGraph()
+	_, err := g.Eval(`
+g.addV('person').property('name', 'marko').property('age', 29).as('marko').
+  addV('person').property('name', 'vadas').property('age', 27).as('vadas').
+  addV('software').property('name', 'lop').as('lop').
+  addE('knows').from('marko').to('vadas').property('weight', 0.5d).
+  addE('created').from('marko').to('lop').property('weight', 0.4d)`, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return g
+}
+
+func TestExport(t *testing.T) {
+	g := newExportGraph(t)
+	s := grmlntest.NewServer(g.Handler())
+	defer s.Close()
+
+	tests := []struct {
+		args     []string
+		expected string
+	}{
+		{
+			[]string{"-format", "dot", "-page", "2"},
+			"digraph G {\n  \"1\" [label=\"person\\nmarko\"];\n  \"4\" [label=\"person\\nvadas\"];\n  \"7\" [label=\"software\\nlop\"];\n" +
+				"  \"1\" -> \"4\" [label=\"knows\"];\n  \"1\" -> \"7\" [label=\"created\"];\n}\n",
+		},
+		{
+			[]string{"-format", "graphson", "-vertices", ".hasLabel('person')", "-paging", "range", "-partitions", "2", "-page", "1"},
+			`{"id":1,"label":"person","outE":{"knows":[{"id":9,"inV":4,"properties":{"weight":0.5}}]},"properties":{"age":[{"id":3,"value":29}],"name":[{"id":2,"value":"marko"}]}}` + "\n" +
+				`{"id":4,"label":"person","properties":{"age":[{"id":6,"value":27}],"name":[{"id":5,"value":"vadas"}]}}` + "\n",
+		},
+		{
+			// The edge to lop is left out because lop isn't exported
+			[]string{"-format", "dot", "-vertices", ".hasLabel('person')", "-page", "1"},
+			"digraph G {\n  \"1\" [label=\"person\\nmarko\"];\n  \"4\" [label=\"person\\nvadas\"];\n  \"1\" -> \"4\" [label=\"knows\"];\n}\n",
+		},
+		{
+			[]string{"-format", "dot", "-vertices", ".has('name', 'vadas')", "-edges", ".hasLabel('knows')", "-paging", "range"},
+			"digraph G {\n  \"4\" [label=\"person\\nvadas\"];\n}\n",
+		},
+		{
+			[]string{"-format", "graphml", "-edges", ".hasLabel('knows')", "-partitions", "3", "-page", "1"},
+			`<?xml version="1.0" encoding="UTF-8"?>
+<graphml xmlns="http://graphml.graphdrawing.org/xmlns">
+  <key id="labelV" for="node" attr.name="labelV" attr.type="string"/>
+  <key id="v_name" for="node" attr.name="name" attr.type="string"/>
+  <key id="v_age" for="node" attr.name="age" attr.type="long"/>
+  <key id="labelE" for="edge" attr.name="labelE" attr.type="string"/>
+  <key id="e_weight" for="edge" attr.name="weight" attr.type="double"/>
+  <graph id="G" edgedefault="directed">
+    <node id="1"><data key="labelV">person</data><data key="v_name">marko</data><data key="v_age">29</data></node>
+    <node id="4"><data key="labelV">person</data><data key="v_name">vadas</data><data key="v_age">27</data></node>
+    <node id="7"><data key="labelV">software</data><data key="v_name">lop</data></node>
+    <edge id="9" source="1" target="4"><data key="labelE">knows</data><data key="e_weight">0.5</data></edge>
+  </graph>
+</graphml>
+`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.args[1], func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			args := append([]string{"export", "-addr", s.URL}, test.args...)
+			if code := run(args, nil, &stdout, &stderr); code != 0 {
+				t.Fatalf("expected exit code 0 but got %d: %s", code, stderr.String())
+			}
+
+			// Partitions finish in any order, so compare lines regardless of order
+			if sortLines(stdout.String()) != sortLines(test.expected) {
+				t.Fatalf("expected:\n%s\nbut got:\n%s", test.expected, stdout.String())
+			}
+		})
+	}
+}
+
+func sortLines(s string) string {
+	lines := strings.Split(s, "\n")
+	sort.Strings(lines)
+	return strings.Join(lines, "\n")
+}
+
+// TestExportImport ensures exported CSV and GraphML can be imported again
+func TestExportImport(t *testing.T) {
+	source := grmlntest.NewServer(newExportGraph(t).Handler())
+	defer source.Close()
+
+	dir := t.TempDir()
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"export", "-addr", source.URL, "-format", "graphml", "-out", filepath.Join(dir, "graph.graphml")}, nil, &stdout, &stderr); code != 0 {
+		t.Fatalf("expected exit code 0 but got %d: %s", code, stderr.String())
+	}
+	if code := run([]string{"export", "-addr", source.URL, "-format", "csv", "-out", filepath.Join(dir, "csv")}, nil, &stdout, &stderr); code != 0 {
+		t.Fatalf("expected exit code 0 but got %d: %s", code, stderr.String())
+	}
+
+	b, err := os.ReadFile(filepath.Join(dir, "csv", "edges.csv"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(b) != "id,label,outV,inV,weight\n9,knows,1,4,0.5\n10,created,1,7,0.4\n" {
+		t.Fatalf("unexpected edges.csv:\n%s", b)
+	}
+
+	g := grmlntest.NewGraph()
+	target := grmlntest.NewServer(g.Handler())
+	defer target.Close()
+
+	if code := run([]string{"import", "-addr", target.URL, filepath.Join(dir, "graph.graphml")}, nil, &stdout, &stderr); code != 0 {
+		t.Fatalf("expected exit code 0 but got %d: %s", code, stderr.String())
+	}
+	if actual := evalGraph(t, g, "g.V().has('name', 'marko').out().values('age')"); actual != "27" {
+		t.Fatalf("unexpected round trip %q", actual)
+	}
+}
@@ -0,0 +1,349 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+var exportFormats = map[string]func(out string, stdout io.Writer) (exportWriter, func() error, error){
+	"graphson": func(out string, stdout io.Writer) (exportWriter, func() error, error) {
+		w, closer, err := createFile(out, stdout)
+		if err != nil {
+			return nil, nil, err
+		}
+		return &graphSONWriter{w: bufio.NewWriter(w)}, closer, nil
+	},
+	"graphml": func(out string, stdout io.Writer) (exportWriter, func() error, error) {
+		w, closer, err := createFile(out, stdout)
+		if err != nil {
+			return nil, nil, err
+		}
+		return &graphMLWriter{w: bufio.NewWriter(w)}, closer, nil
+	},
+	"dot": func(out string, stdout io.Writer) (exportWriter, func() error, error) {
+		w, closer, err := createFile(out, stdout)
+		if err != nil {
+			return nil, nil, err
+		}
+		return &dotWriter{w: bufio.NewWriter(w)}, closer, nil
+	},
+	"csv": func(out string, stdout io.Writer) (exportWriter, func() error, error) {
+		if out == "-" {
+			return nil, nil, fmt.Errorf("csv writes vertices.csv and edges.csv and requires an -out directory")
+		}
+		if err := os.MkdirAll(out, 0755); err != nil {
+			return nil, nil, err
+		}
+		vertices, err := os.Create(filepath.Join(out, "vertices.csv"))
+		if err != nil {
+			return nil, nil, err
+		}
+		edges, err := os.Create(filepath.Join(out, "edges.csv"))
+		if err != nil {
+			vertices.Close()
+			return nil, nil, err
+		}
+		closer := func() error {
+			err := vertices.Close()
+			if eerr := edges.Close(); err == nil {
+				err = eerr
+			}
+			return err
+		}
+		return &csvWriter{vertices: csv.NewWriter(vertices), edges: csv.NewWriter(edges)}, closer, nil
+	},
+}
+
+func exportFormatNames() string {
+	names := make([]string, 0, len(exportFormats))
+	for name := range exportFormats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+func newExportWriter(format, out string, stdout io.Writer) (exportWriter, func() error, error) {
+	f, ok := exportFormats[format]
+	if !ok {
+		return nil, nil, fmt.Errorf("unknown format %q. Expected one of %s", format, exportFormatNames())
+	}
+	return f(out, stdout)
+}
+
+// vertexProperties returns a vertex's property values by key
+func vertexProperties(v map[string]interface{}) map[string][]interface{} {
+	props, _ := v["properties"].(map[string]interface{})
+	out := make(map[string][]interface{}, len(props))
+	for key, p := range props {
+		list, ok := p.([]interface{})
+		if !ok {
+			list = []interface{}{p}
+		}
+		for _, e := range list {
+			if vp, ok := e.(map[string]interface{}); ok {
+				if value, ok := vp["value"]; ok {
+					e = value
+				}
+			}
+			out[key] = append(out[key], e)
+		}
+	}
+	return out
+}
+
+// graphSONWriter writes a GraphSON adjacency list: one vertex per line with its out edges
+type graphSONWriter struct {
+	w *bufio.Writer
+}
+
+func (w *graphSONWriter) adjacency() {}
+
+func (w *graphSONWriter) Begin(exportSchema) error {
+	return nil
+}
+
+func (w *graphSONWriter) Vertices(page []map[string]interface{}) error {
+	for _, v := range page {
+		line := map[string]interface{}{
+			"id":    v["id"],
+			"label": v["label"],
+		}
+
+		props := map[string]interface{}{}
+		raw, _ := v["properties"].(map[string]interface{})
+		for key, list := range raw {
+			values, _ := list.([]interface{})
+			out := make([]interface{}, 0, len(values))
+			for _, p := range values {
+				vp, ok := p.(map[string]interface{})
+				if !ok {
+					vp = map[string]interface{}{"value": p}
+				}
+				out = append(out, map[string]interface{}{"id": vp["id"], "value": vp["value"]})
+			}
+			props[key] = out
+		}
+		line["properties"] = props
+
+		if outE, ok := v["outE"].(map[string]interface{}); ok {
+			edges := map[string]interface{}{}
+			for label, list := range outE {
+				var out []interface{}
+				for _, e := range list.([]interface{}) {
+					edge := e.(map[string]interface{})
+					out = append(out, map[string]interface{}{
+						"id":         edge["id"],
+						"inV":        edge["inV"],
+						"properties": edge["properties"],
+					})
+				}
+				edges[label] = out
+			}
+			line["outE"] = edges
+		}
+
+		b, err := json.Marshal(line)
+		if err != nil {
+			return err
+		}
+		w.w.Write(b)
+		if err := w.w.WriteByte('\n'); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *graphSONWriter) Edges([]map[string]interface{}) error {
+	return nil
+}
+
+func (w *graphSONWriter) End() error {
+	return w.w.Flush()
+}
+
+// graphMLWriter writes GraphML with labels in the labelV and labelE attributes TinkerPop uses.
+// GraphML has no multi-properties so only the first value of each vertex property is written
+type graphMLWriter struct {
+	w      *bufio.Writer
+	schema exportSchema
+}
+
+func (w *graphMLWriter) needsSchema() {}
+
+func escapeXML(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+func (w *graphMLWriter) Begin(schema exportSchema) error {
+	w.schema = schema
+
+	fmt.Fprintln(w.w, `<?xml version="1.0" encoding="UTF-8"?>`)
+	fmt.Fprintln(w.w, `<graphml xmlns="http://graphml.graphdrawing.org/xmlns">`)
+	fmt.Fprintln(w.w, `  <key id="labelV" for="node" attr.name="labelV" attr.type="string"/>`)
+	for _, k := range schema.vertexKeys {
+		fmt.Fprintf(w.w, "  <key id=\"v_%s\" for=\"node\" attr.name=\"%s\" attr.type=\"%s\"/>\n", escapeXML(k.name), escapeXML(k.name), k.typ)
+	}
+	fmt.Fprintln(w.w, `  <key id="labelE" for="edge" attr.name="labelE" attr.type="string"/>`)
+	for _, k := range schema.edgeKeys {
+		fmt.Fprintf(w.w, "  <key id=\"e_%s\" for=\"edge\" attr.name=\"%s\" attr.type=\"%s\"/>\n", escapeXML(k.name), escapeXML(k.name), k.typ)
+	}
+	_, err := fmt.Fprintln(w.w, `  <graph id="G" edgedefault="directed">`)
+	return err
+}
+
+func (w *graphMLWriter) Vertices(page []map[string]interface{}) error {
+	for _, v := range page {
+		fmt.Fprintf(w.w, "    <node id=\"%s\"><data key=\"labelV\">%s</data>", escapeXML(short(v["id"])), escapeXML(short(v["label"])))
+		props := vertexProperties(v)
+		for _, k := range w.schema.vertexKeys {
+			if values := props[k.name]; len(values) > 0 {
+				fmt.Fprintf(w.w, "<data key=\"v_%s\">%s</data>", escapeXML(k.name), escapeXML(short(values[0])))
+			}
+		}
+		if _, err := fmt.Fprintln(w.w, "</node>"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *graphMLWriter) Edges(page []map[string]interface{}) error {
+	for _, e := range page {
+		fmt.Fprintf(w.w, "    <edge id=\"%s\" source=\"%s\" target=\"%s\"><data key=\"labelE\">%s</data>",
+			escapeXML(short(e["id"])), escapeXML(short(e["outV"])), escapeXML(short(e["inV"])), escapeXML(short(e["label"])))
+		props, _ := e["properties"].(map[string]interface{})
+		for _, k := range w.schema.edgeKeys {
+			if value, ok := props[k.name]; ok {
+				fmt.Fprintf(w.w, "<data key=\"e_%s\">%s</data>", escapeXML(k.name), escapeXML(short(value)))
+			}
+		}
+		if _, err := fmt.Fprintln(w.w, "</edge>"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *graphMLWriter) End() error {
+	fmt.Fprintln(w.w, "  </graph>")
+	fmt.Fprintln(w.w, "</graphml>")
+	return w.w.Flush()
+}
+
+// csvWriter writes vertices and edges to separate CSV files with a column per property key
+type csvWriter struct {
+	vertices *csv.Writer
+	edges    *csv.Writer
+	schema   exportSchema
+}
+
+func (w *csvWriter) needsSchema() {}
+
+func (w *csvWriter) Begin(schema exportSchema) error {
+	w.schema = schema
+
+	header := []string{"id", "label"}
+	for _, k := range schema.vertexKeys {
+		header = append(header, k.name)
+	}
+	if err := w.vertices.Write(header); err != nil {
+		return err
+	}
+
+	header = []string{"id", "label", "outV", "inV"}
+	for _, k := range schema.edgeKeys {
+		header = append(header, k.name)
+	}
+	return w.edges.Write(header)
+}
+
+func (w *csvWriter) Vertices(page []map[string]interface{}) error {
+	for _, v := range page {
+		row := []string{short(v["id"]), short(v["label"])}
+		props := vertexProperties(v)
+		for _, k := range w.schema.vertexKeys {
+			row = append(row, cell(props[k.name]))
+		}
+		if err := w.vertices.Write(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *csvWriter) Edges(page []map[string]interface{}) error {
+	for _, e := range page {
+		row := []string{short(e["id"]), short(e["label"]), short(e["outV"]), short(e["inV"])}
+		props, _ := e["properties"].(map[string]interface{})
+		for _, k := range w.schema.edgeKeys {
+			row = append(row, short(props[k.name]))
+		}
+		if err := w.edges.Write(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *csvWriter) End() error {
+	w.vertices.Flush()
+	w.edges.Flush()
+	if err := w.vertices.Error(); err != nil {
+		return err
+	}
+	return w.edges.Error()
+}
+
+// dotWriter writes a Graphviz digraph. Vertices are labelled with their label and name, if they have one
+type dotWriter struct {
+	w *bufio.Writer
+}
+
+func dotQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+}
+
+func (w *dotWriter) Begin(exportSchema) error {
+	_, err := fmt.Fprintln(w.w, "digraph G {")
+	return err
+}
+
+func (w *dotWriter) Vertices(page []map[string]interface{}) error {
+	for _, v := range page {
+		label := short(v["label"])
+		if names := vertexProperties(v)["name"]; len(names) > 0 {
+			label += "\n" + short(names[0])
+		}
+		if _, err := fmt.Fprintf(w.w, "  %s [label=%s];\n", dotQuote(short(v["id"])), dotQuote(label)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *dotWriter) Edges(page []map[string]interface{}) error {
+	for _, e := range page {
+		_, err := fmt.Fprintf(w.w, "  %s -> %s [label=%s];\n", dotQuote(short(e["outV"])), dotQuote(short(e["inV"])), dotQuote(short(e["label"])))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *dotWriter) End() error {
+	fmt.Fprintln(w.w, "}")
+	return w.w.Flush()
+}
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// formatter writes results as each response frame arrives
+type formatter interface {
+	// Frame writes the results of a single frame
+	Frame(results []interface{}) error
+
+	// End is called after the last frame of a query
+	End() error
+}
+
+var formats = map[string]func(w io.Writer) formatter{
+	"json":   func(w io.Writer) formatter { return &jsonFormatter{w: w, indent: "  "} },
+	"ndjson": func(w io.Writer) formatter { return &jsonFormatter{w: w} },
+	"table":  func(w io.Writer) formatter { return &tableFormatter{w: w} },
+	"csv":    func(w io.Writer) formatter { return &csvFormatter{w: w} },
+	"tree":   func(w io.Writer) formatter { return &treeFormatter{w: w} },
+}
+
+func formatNames() string {
+	names := make([]string, 0, len(formats))
+	for name := range formats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+func newFormatter(name string, w io.Writer) (formatter, error) {
+	f, ok := formats[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown format %q. Expected one of %s", name, formatNames())
+	}
+	return f(w), nil
+}
+
+// jsonFormatter writes each result as JSON. Without an indent it writes one result per line
+type jsonFormatter struct {
+	w      io.Writer
+	indent string
+}
+
+func (f *jsonFormatter) Frame(results []interface{}) error {
+	for _, r := range results {
+		var b []byte
+		var err error
+		if f.indent == "" {
+			b, err = json.Marshal(r)
+		} else {
+			b, err = json.MarshalIndent(r, "", f.indent)
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintln(f.w, string(b)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *jsonFormatter) End() error {
+	return nil
+}
+
+// columns returns the columns for a result. Maps such as valueMap, project and select results use their keys,
+// elements use their id, label and property keys, and anything else is a single value column
+func columns(r interface{}) []string {
+	m, ok := r.(map[string]interface{})
+	if !ok {
+		return []string{"value"}
+	}
+
+	if m["type"] == "vertex" || m["type"] == "edge" {
+		cols := []string{"id", "label"}
+		props, _ := m["properties"].(map[string]interface{})
+		return append(cols, sortedKeys(props)...)
+	}
+	return sortedKeys(m)
+}
+
+// row returns the cells of a result for the given columns
+func row(r interface{}, cols []string) []string {
+	m, ok := r.(map[string]interface{})
+	if !ok {
+		return []string{cell(r)}
+	}
+
+	props := m
+	if m["type"] == "vertex" || m["type"] == "edge" {
+		props, _ = m["properties"].(map[string]interface{})
+	}
+
+	cells := make([]string, len(cols))
+	for i, col := range cols {
+		if v, ok := props[col]; ok {
+			cells[i] = cell(v)
+			continue
+		}
+		if col == "id" || col == "label" {
+			cells[i] = cell(m[col])
+		}
+	}
+	return cells
+}
+
+// cell formats a value for a table or CSV. Single value lists (as valueMap returns) are unwrapped
+// and vertex properties show their values
+func cell(v interface{}) string {
+	list, ok := v.([]interface{})
+	if !ok {
+		return short(v)
+	}
+
+	values := make([]string, len(list))
+	for i, e := range list {
+		if vp, ok := e.(map[string]interface{}); ok && vp["type"] == nil {
+			if value, ok := vp["value"]; ok {
+				e = value
+			}
+		}
+		values[i] = short(e)
+	}
+	if len(values) == 1 {
+		return values[0]
+	}
+	return "[" + strings.Join(values, ", ") + "]"
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// tableFormatter writes results as an aligned table. Columns come from the first result of a query and
+// widths are measured per frame so rows can be written as they arrive
+type tableFormatter struct {
+	w      io.Writer
+	cols   []string
+	widths []int
+}
+
+func (f *tableFormatter) Frame(results []interface{}) error {
+	if len(results) == 0 {
+		return nil
+	}
+
+	header := f.cols == nil
+	if header {
+		f.cols = columns(results[0])
+		f.widths = make([]int, len(f.cols))
+		for i, c := range f.cols {
+			f.widths[i] = len(c)
+		}
+	}
+
+	rows := make([][]string, len(results))
+	for i, r := range results {
+		rows[i] = row(r, f.cols)
+		for j, c := range rows[i] {
+			if j < len(f.widths) && len(c) > f.widths[j] {
+				f.widths[j] = len(c)
+			}
+		}
+	}
+
+	if header {
+		if err := f.writeRow(f.cols); err != nil {
+			return err
+		}
+		separator := make([]string, len(f.cols))
+		for i, w := range f.widths {
+			separator[i] = strings.Repeat("-", w)
+		}
+		if err := f.writeRow(separator); err != nil {
+			return err
+		}
+	}
+
+	for _, r := range rows {
+		if err := f.writeRow(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *tableFormatter) writeRow(cells []string) error {
+	padded := make([]string, len(cells))
+	for i, c := range cells {
+		padded[i] = c
+		if i < len(cells)-1 {
+			padded[i] += strings.Repeat(" ", f.widths[i]-len(c))
+		}
+	}
+	_, err := fmt.Fprintln(f.w, strings.TrimRight(strings.Join(padded, "  "), " "))
+	return err
+}
+
+func (f *tableFormatter) End() error {
+	f.cols, f.widths = nil, nil
+	return nil
+}
+
+// csvFormatter writes results as CSV with a header row from the first result of a query
+type csvFormatter struct {
+	w    io.Writer
+	cw   *csv.Writer
+	cols []string
+}
+
+func (f *csvFormatter) Frame(results []interface{}) error {
+	if len(results) == 0 {
+		return nil
+	}
+
+	if f.cw == nil {
+		f.cw = csv.NewWriter(f.w)
+	}
+
+	if f.cols == nil {
+		f.cols = columns(results[0])
+		if err := f.cw.Write(f.cols); err != nil {
+			return err
+		}
+	}
+
+	for _, r := range results {
+		if err := f.cw.Write(row(r, f.cols)); err != nil {
+			return err
+		}
+	}
+
+	f.cw.Flush()
+	return f.cw.Error()
+}
+
+func (f *csvFormatter) End() error {
+	f.cols = nil
+	return nil
+}
+
+// treeFormatter writes Path and Tree results as indented trees. Consecutive paths that share a
+// prefix are merged so path results read as a tree
+type treeFormatter struct {
+	w    io.Writer
+	last []string
+}
+
+func (f *treeFormatter) Frame(results []interface{}) error {
+	for _, r := range results {
+		if objects, ok := isPath(r); ok {
+			if err := f.writePath(objects); err != nil {
+				return err
+			}
+			continue
+		}
+
+		f.last = nil
+		if nodes, ok := r.([]treeNode); ok {
+			if err := f.writeTree(nodes, 0); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := f.writeLine(0, short(r)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *treeFormatter) writePath(objects []interface{}) error {
+	names := make([]string, len(objects))
+	for i, o := range objects {
+		names[i] = short(o)
+	}
+
+	shared := 0
+	for shared < len(names) && shared < len(f.last) && names[shared] == f.last[shared] {
+		shared++
+	}
+
+	for depth := shared; depth < len(names); depth++ {
+		if err := f.writeLine(depth, names[depth]); err != nil {
+			return err
+		}
+	}
+	f.last = names
+	return nil
+}
+
+func (f *treeFormatter) writeTree(nodes []treeNode, depth int) error {
+	for _, n := range nodes {
+		if err := f.writeLine(depth, short(n.key)); err != nil {
+			return err
+		}
+		if err := f.writeTree(n.children, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *treeFormatter) writeLine(depth int, s string) error {
+	prefix := ""
+	if depth > 0 {
+		prefix = strings.Repeat("   ", depth-1) + "└─ "
+	}
+	_, err := fmt.Fprintln(f.w, prefix+s)
+	return err
+}
+
+func (f *treeFormatter) End() error {
+	f.last = nil
+	return nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestFormats(t *testing.T) {
+	valueMaps := []string{
+		`[{"name":["marko"],"age":[29]},{"name":["vadas"],"age":[27]}]`,
+		`{"@type":"g:List","@value":[{"@type":"g:Map","@value":["name",{"@type":"g:List","@value":["josh"]},"age",{"@type":"g:List","@value":[{"@type":"g:Int32","@value":32}]}]}]}`,
+	}
+	paths := []string{
+		`[{"labels":[[],[],[]],"objects":[{"id":1,"label":"person","type":"vertex"},{"id":2,"label":"person","type":"vertex"},"vadas"]}]`,
+		`[{"labels":[[],[],[]],"objects":[{"id":1,"label":"person","type":"vertex"},{"id":4,"label":"person","type":"vertex"},"josh"]}]`,
+	}
+	tree := []string{
+		`{"@type":"g:List","@value":[{"@type":"g:Tree","@value":[{"key":{"@type":"g:Vertex","@value":{"id":{"@type":"g:Int64","@value":1},"label":"person"}},"value":{"@type":"g:Tree","@value":[{"key":"marko","value":{"@type":"g:Tree","@value":[]}}]}}]}]}`,
+	}
+
+	tests := []struct {
+		format   string
+		frames   []string
+		expected string
+	}{
+		{"ndjson", valueMaps, "{\"age\":[29],\"name\":[\"marko\"]}\n{\"age\":[27],\"name\":[\"vadas\"]}\n{\"age\":[32],\"name\":[\"josh\"]}\n"},
+		{"table", valueMaps, "age  name\n---  -----\n29   marko\n27   vadas\n32   josh\n"},
+		{"csv", valueMaps, "age,name\n29,marko\n27,vadas\n32,josh\n"},
+		{"tree", paths, "v[1]\n└─ v[2]\n   └─ vadas\n└─ v[4]\n   └─ josh\n"},
+		{"tree", tree, "v[1]\n└─ marko\n"},
+		{"table", []string{`[{"id":1,"label":"person","type":"vertex","properties":{"name":[{"id":2,"label":"name","value":"marko"}]}}]`}, "id  label   name\n--  ------  -----\n1   person  marko\n"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.format, func(t *testing.T) {
+			var out bytes.Buffer
+			f, err := newFormatter(test.format, &out)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			for _, frame := range test.frames {
+				results, err := decodeResults([]byte(frame))
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if err := f.Frame(results); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			}
+			f.End()
+
+			if out.String() != test.expected {
+				t.Fatalf("expected:\n%s\nbut got:\n%s", test.expected, out.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// treeNode is a node of a Tree result
+type treeNode struct {
+	key      interface{}
+	children []treeNode
+}
+
+// decodeResults splits a frame's data into its results and converts GraphSON 2 and 3 typed values into
+// the plain values GraphSON 1 uses. Vertices and edges have a type of "vertex" or "edge"
+func decodeResults(data json.RawMessage) ([]interface{}, error) {
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil, nil
+	}
+
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+
+	var v interface{}
+	if err := d.Decode(&v); err != nil {
+		return nil, err
+	}
+
+	switch results := simplify(v).(type) {
+	case nil:
+		return nil, nil
+	case []interface{}:
+		return results, nil
+	default:
+		return []interface{}{results}, nil
+	}
+}
+
+func simplify(v interface{}) interface{} {
+	switch value := v.(type) {
+	case []interface{}:
+		out := make([]interface{}, len(value))
+		for i, e := range value {
+			out[i] = simplify(e)
+		}
+		return out
+	case map[string]interface{}:
+		typ, ok := value["@type"].(string)
+		if !ok {
+			out := make(map[string]interface{}, len(value))
+			for k, e := range value {
+				out[k] = simplify(e)
+			}
+			if t, ok := v1Tree(out); ok {
+				return t
+			}
+			return out
+		}
+		return simplifyTyped(typ, value["@value"])
+	}
+	return v
+}
+
+func simplifyTyped(typ string, raw interface{}) interface{} {
+	switch typ {
+	case "g:List", "g:Set":
+		return simplify(raw)
+	case "g:Map":
+		flat, _ := raw.([]interface{})
+		m := make(map[string]interface{}, len(flat)/2)
+		for i := 0; i+1 < len(flat); i += 2 {
+			m[mapKey(simplify(flat[i]))] = simplify(flat[i+1])
+		}
+		return m
+	case "g:Vertex", "g:Edge":
+		m, _ := simplify(raw).(map[string]interface{})
+		if m == nil {
+			return nil
+		}
+		m["type"] = strings.ToLower(strings.TrimPrefix(typ, "g:"))
+
+		// GraphSON 2 and 3 wrap edge properties as g:Property, GraphSON 1 maps the key directly to the value
+		if props, ok := m["properties"].(map[string]interface{}); ok && typ == "g:Edge" {
+			for k, p := range props {
+				if pm, ok := p.(map[string]interface{}); ok {
+					if value, ok := pm["value"]; ok {
+						props[k] = value
+					}
+				}
+			}
+		}
+		return m
+	case "g:Tree":
+		entries, _ := raw.([]interface{})
+		return simplifyTree(entries)
+	case "g:T", "g:Direction", "g:UUID", "g:Date", "g:Timestamp":
+		return simplify(raw)
+	}
+	// Numbers and anything else with a simple value (g:Int64, g:Double, etc.) lose their type
+	return simplify(raw)
+}
+
+func simplifyTree(entries []interface{}) []treeNode {
+	var nodes []treeNode
+	for _, e := range entries {
+		m, _ := e.(map[string]interface{})
+		node := treeNode{key: simplify(m["key"])}
+		if child, ok := m["value"].(map[string]interface{}); ok {
+			if children, ok := simplify(child).([]treeNode); ok {
+				node.children = children
+			}
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes
+}
+
+// v1Tree converts a GraphSON 1 tree, which maps ids to {key, value} pairs, into tree nodes
+func v1Tree(m map[string]interface{}) ([]treeNode, bool) {
+	if len(m) == 0 {
+		return nil, false
+	}
+
+	keys := make([]string, 0, len(m))
+	for k, e := range m {
+		entry, ok := e.(map[string]interface{})
+		if !ok || len(entry) != 2 {
+			return nil, false
+		}
+		if _, ok := entry["key"]; !ok {
+			return nil, false
+		}
+		if _, ok := entry["value"]; !ok {
+			return nil, false
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var nodes []treeNode
+	for _, k := range keys {
+		entry := m[k].(map[string]interface{})
+		node := treeNode{key: entry["key"]}
+		switch children := entry["value"].(type) {
+		case []treeNode:
+			node.children = children
+		case map[string]interface{}:
+			// An empty map is a leaf
+		default:
+			return nil, false
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes, true
+}
+
+// isPath reports whether v is a Path result and returns its objects
+func isPath(v interface{}) ([]interface{}, bool) {
+	m, ok := v.(map[string]interface{})
+	if !ok || len(m) != 2 {
+		return nil, false
+	}
+	if _, ok := m["labels"]; !ok {
+		return nil, false
+	}
+	objects, ok := m["objects"].([]interface{})
+	return objects, ok
+}
+
+// mapKey formats a map key. GraphSON 3 map keys can be any value
+func mapKey(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	return short(v)
+}
+
+// short formats a value on a single line. Elements are shown the way the Gremlin Console shows them
+func short(v interface{}) string {
+	switch value := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case json.Number:
+		return value.String()
+	case map[string]interface{}:
+		switch value["type"] {
+		case "vertex":
+			return fmt.Sprintf("v[%s]", short(value["id"]))
+		case "edge":
+			return fmt.Sprintf("e[%s][%s-%s->%s]", short(value["id"]), short(value["outV"]), short(value["label"]), short(value["inV"]))
+		}
+		if _, ok := value["value"]; ok && len(value) == 3 && value["id"] != nil && value["label"] != nil {
+			return fmt.Sprintf("vp[%s->%s]", short(value["label"]), short(value["value"]))
+		}
+		if objects, ok := isPath(value); ok {
+			names := make([]string, len(objects))
+			for i, o := range objects {
+				names[i] = short(o)
+			}
+			return "path[" + strings.Join(names, ", ") + "]"
+		}
+	case []treeNode:
+		var names []string
+		for _, n := range value {
+			names = append(names, short(n.key))
+		}
+		return "tree[" + strings.Join(names, ", ") + "]"
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
+
+func (n treeNode) MarshalJSON() ([]byte, error) {
+	children := n.children
+	if children == nil {
+		children = []treeNode{}
+	}
+	return json.Marshal(struct {
+		Key      interface{} `json:"key"`
+		Children []treeNode  `json:"children"`
+	}{n.key, children})
+}
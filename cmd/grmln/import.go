@@ -0,0 +1,509 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/evandigby/grmln"
+)
+
+// importCheckpoint records how many records of each source have been imported. It is saved after
+// every batch so an interrupted import can resume where it stopped
+type importCheckpoint struct {
+	path string
+
+	mu      sync.Mutex
+	Sources map[string]int `json:"sources"`
+}
+
+func loadCheckpoint(path string) (*importCheckpoint, error) {
+	c := &importCheckpoint{path: path, Sources: map[string]int{}}
+	if path == "" {
+		return c, nil
+	}
+
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, c); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if c.Sources == nil {
+		c.Sources = map[string]int{}
+	}
+	return c, nil
+}
+
+func (c *importCheckpoint) done(source string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.Sources[source]
+}
+
+// set records that the first n records of source are imported and saves the checkpoint
+func (c *importCheckpoint) set(source string, n int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.Sources[source] = n
+	if c.path == "" {
+		return nil
+	}
+
+	b, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write then rename so an interrupted save never leaves a truncated checkpoint
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.path)
+}
+
+// rejectLog writes records that couldn't be imported as JSON Lines
+type rejectLog struct {
+	mu    sync.Mutex
+	w     io.Writer
+	count int
+}
+
+func (l *rejectLog) reject(source string, rec *importRecord, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.count++
+	if l.w == nil {
+		return
+	}
+
+	b, jerr := json.Marshal(struct {
+		Source string      `json:"source"`
+		Line   int         `json:"line"`
+		Record interface{} `json:"record"`
+		Error  string      `json:"error"`
+	}{source, rec.line, rec.raw, err.Error()})
+	if jerr != nil {
+		return
+	}
+	l.w.Write(append(b, '\n'))
+}
+
+// watermark tracks batches finishing out of order and reports how many records from the start are done
+type watermark struct {
+	mu        sync.Mutex
+	next      int
+	completed map[int]int
+}
+
+// complete marks records [start, end) done and returns the new low watermark
+func (w *watermark) complete(start, end int) int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.completed[start] = end
+	for {
+		end, ok := w.completed[w.next]
+		if !ok {
+			return w.next
+		}
+		delete(w.completed, w.next)
+		w.next = end
+	}
+}
+
+type importBatch struct {
+	start   int
+	records []*importRecord
+}
+
+// importer upserts records in batches. Vertices and edges are matched on an import id property so
+// batches can be re-run safely after an interrupted import
+type importer struct {
+	op          *grmln.Operator
+	idKey       string
+	batchSize   int
+	concurrency int
+	checkpoint  *importCheckpoint
+	rejects     *rejectLog
+
+	mu       sync.Mutex
+	imported map[bool]int
+}
+
+// importSource imports every record in src after those already recorded in the checkpoint
+func (im *importer) importSource(ctx context.Context, src importSource) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	name := src.Name()
+	skip := im.checkpoint.done(name)
+	mark := &watermark{next: skip, completed: map[int]int{}}
+
+	batches := make(chan importBatch)
+	var fatal error
+	var fatalOnce sync.Once
+	fail := func(err error) {
+		fatalOnce.Do(func() {
+			fatal = err
+			cancel()
+		})
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < im.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for b := range batches {
+				if err := im.importBatch(ctx, name, b.records); err != nil {
+					fail(err)
+					continue
+				}
+				if err := im.checkpoint.set(name, mark.complete(b.start, b.start+len(b.records))); err != nil {
+					fail(err)
+				}
+			}
+		}()
+	}
+
+	n := 0
+	batch := importBatch{start: skip}
+	send := func() bool {
+		if len(batch.records) == 0 {
+			return true
+		}
+		select {
+		case batches <- batch:
+		case <-ctx.Done():
+			return false
+		}
+		batch = importBatch{start: n}
+		return true
+	}
+
+	var readErr error
+	for {
+		rec, err := src.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			readErr = fmt.Errorf("%s: %v", name, err)
+			break
+		}
+
+		n++
+		if n <= skip {
+			continue
+		}
+
+		batch.records = append(batch.records, rec)
+		if len(batch.records) == im.batchSize && !send() {
+			break
+		}
+	}
+	if readErr == nil {
+		send()
+	}
+	close(batches)
+	wg.Wait()
+
+	if fatal != nil {
+		return fatal
+	}
+	return readErr
+}
+
+// importBatch upserts records as a single script. If the script fails each record is retried on its own
+// so only the records at fault are rejected. Errors that aren't caused by the records stop the import
+func (im *importer) importBatch(ctx context.Context, source string, records []*importRecord) error {
+	var valid []*importRecord
+	for _, rec := range records {
+		if rec.err != nil {
+			im.rejects.reject(source, rec, rec.err)
+			continue
+		}
+		valid = append(valid, rec)
+	}
+	if len(valid) == 0 {
+		return nil
+	}
+
+	results, err := im.upsert(ctx, valid)
+	if err == nil && len(results) == len(valid) {
+		im.finish(source, valid, results)
+		return nil
+	}
+	if err != nil && !isResponseError(err) {
+		return err
+	}
+
+	for _, rec := range valid {
+		results, err := im.upsert(ctx, []*importRecord{rec})
+		switch {
+		case err != nil && !isResponseError(err):
+			return err
+		case err != nil:
+			im.rejects.reject(source, rec, err)
+		case len(results) != 1:
+			im.rejects.reject(source, rec, fmt.Errorf("expected 1 result but got %d", len(results)))
+		default:
+			im.finish(source, []*importRecord{rec}, results)
+		}
+	}
+	return nil
+}
+
+func isResponseError(err error) bool {
+	_, ok := err.(interface{ Response() grmln.Response })
+	return ok
+}
+
+// finish counts imported records. A record whose upsert matched nothing is an edge whose vertices don't exist
+func (im *importer) finish(source string, records []*importRecord, results []interface{}) {
+	for i, rec := range records {
+		if fmt.Sprint(results[i]) == "0" {
+			im.rejects.reject(source, rec, errors.New("vertex not found"))
+			continue
+		}
+
+		im.mu.Lock()
+		im.imported[rec.edge]++
+		im.mu.Unlock()
+	}
+}
+
+// upsert sends records as a list of upsert traversals so there is one result per record:
+// the number of elements written
+func (im *importer) upsert(ctx context.Context, records []*importRecord) ([]interface{}, error) {
+	gremlin, bindings := im.script(records)
+
+	var results []interface{}
+	err := im.op.EvalDefault(ctx, gremlin, bindings, func(resp *grmln.Response) {
+		r, err := decodeResults(resp.Result.Data)
+		if err == nil {
+			results = append(results, r...)
+		}
+	})
+	return results, err
+}
+
+func (im *importer) script(records []*importRecord) (string, grmln.Bindings) {
+	bindings := grmln.Bindings{"k": im.idKey}
+	statements := make([]string, len(records))
+
+	bind := func(name string, i int, v interface{}) string {
+		key := fmt.Sprintf("%s%d", name, i)
+		bindings[key] = v
+		return key
+	}
+
+	has := func(name string, i int, e endpoint) string {
+		if e.label == "" {
+			return fmt.Sprintf("has(k, %s)", bind(name, i, e.id))
+		}
+		return fmt.Sprintf("has(%s, k, %s)", bind(name+"l", i, e.label), bind(name, i, e.id))
+	}
+
+	for i, rec := range records {
+		var b strings.Builder
+		label := bind("l", i, rec.label)
+		id := bind("i", i, rec.id)
+
+		if rec.edge {
+			fmt.Fprintf(&b, "g.V().%s.as('a').V().%s.coalesce(__.inE(%s).has(k, %s), __.addE(%s).from('a').property(k, %s))",
+				has("f", i, rec.from), has("t", i, rec.to), label, id, label, id)
+		} else {
+			fmt.Fprintf(&b, "g.V().has(%s, k, %s).fold().coalesce(__.unfold(), __.addV(%s).property(k, %s))",
+				label, id, label, id)
+		}
+
+		for j, p := range rec.props {
+			key := bind(fmt.Sprintf("pk%d_", i), j, p.key)
+			value := bind(fmt.Sprintf("pv%d_", i), j, p.value)
+			if rec.edge {
+				fmt.Fprintf(&b, ".property(%s, %s)", key, value)
+			} else {
+				fmt.Fprintf(&b, ".property(single, %s, %s)", key, value)
+			}
+		}
+
+		b.WriteString(".count().next()")
+		statements[i] = b.String()
+	}
+
+	return "[" + strings.Join(statements, ",\n") + "]", bindings
+}
+
+func runImport(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: grmln import [flags] -mapping mapping.json")
+		fmt.Fprintln(stderr, "       grmln import [flags] file.graphml|file.json...")
+		fmt.Fprint(stderr, `
+Imports vertices and then edges from CSV files described by a mapping file, GraphML files, or GraphSON
+adjacency lists (one vertex per line with its outE edges). Elements are upserted on an import id
+property so an interrupted import can be resumed from its checkpoint. A CSV mapping looks like:
+
+  {"vertices": [{"file": "people.csv", "label": "person", "id": {"column": "id", "type": "int"},
+                 "properties": {"name": "name", "age": {"column": "age", "type": "int"}}}],
+   "edges":    [{"file": "knows.csv", "label": "knows",
+                 "from": {"column": "src", "type": "int", "label": "person"},
+                 "to": {"column": "dst", "type": "int", "label": "person"},
+                 "properties": {"weight": {"column": "weight", "type": "float"}}}]}
+
+`)
+		fs.PrintDefaults()
+	}
+
+	var conn connFlags
+	conn.register(fs)
+
+	mappingFile := fs.String("mapping", "", "CSV mapping file")
+	format := fs.String("input", "", "input format for files: graphml or graphson. Defaults to the file extension")
+	idKey := fs.String("id-key", "importId", "property holding each element's import id")
+	batchSize := fs.Int("rows", 100, "records per upsert script")
+	concurrency := fs.Int("concurrency", 4, "number of scripts to run at once")
+	checkpointFile := fs.String("checkpoint", "", "checkpoint file to resume from and update")
+	rejectsFile := fs.String("rejects", "", "file to append rejected records to as JSON Lines")
+
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if (*mappingFile == "") == (fs.NArg() == 0) {
+		fs.Usage()
+		return 2
+	}
+	if *batchSize < 1 || *concurrency < 1 {
+		fmt.Fprintln(stderr, "rows and concurrency must be at least 1")
+		return 2
+	}
+
+	opens, err := importSources(*mappingFile, *format, fs.Args())
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+
+	checkpoint, err := loadCheckpoint(*checkpointFile)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	rejects := &rejectLog{}
+	if *rejectsFile != "" {
+		f, err := os.OpenFile(*rejectsFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		defer f.Close()
+		rejects.w = f
+	}
+
+	c, err := conn.connect(context.Background(), stderr)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	defer c.close()
+
+	im := &importer{
+		op:          c.op,
+		idKey:       *idKey,
+		batchSize:   *batchSize,
+		concurrency: *concurrency,
+		checkpoint:  checkpoint,
+		rejects:     rejects,
+		imported:    map[bool]int{},
+	}
+
+	start := time.Now()
+	for _, open := range opens {
+		src, err := open()
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+
+		fmt.Fprintf(stderr, "importing %s\n", src.Name())
+		err = im.importSource(context.Background(), src)
+		src.Close()
+		if err != nil {
+			fmt.Fprintf(stderr, "import stopped: %v\n", err)
+			return 1
+		}
+	}
+
+	fmt.Fprintf(stdout, "imported %d vertices and %d edges in %v. %d rejected\n",
+		im.imported[false], im.imported[true], round(time.Since(start)), rejects.count)
+	if rejects.count > 0 {
+		return 1
+	}
+	return 0
+}
+
+// importSources returns functions that open every source in order: all vertex sources, then all edge sources
+func importSources(mappingFile, format string, files []string) ([]func() (importSource, error), error) {
+	var vertices, edges []func() (importSource, error)
+
+	if mappingFile != "" {
+		m, err := loadCSVMapping(mappingFile)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range m.Vertices {
+			e := e
+			vertices = append(vertices, func() (importSource, error) { return openCSVSource(e, false) })
+		}
+		for _, e := range m.Edges {
+			e := e
+			edges = append(edges, func() (importSource, error) { return openCSVSource(e, true) })
+		}
+		return append(vertices, edges...), nil
+	}
+
+	for _, file := range files {
+		file := file
+
+		f := format
+		if f == "" {
+			switch strings.ToLower(filepath.Ext(file)) {
+			case ".graphml", ".xml":
+				f = "graphml"
+			case ".json", ".jsonl", ".graphson":
+				f = "graphson"
+			}
+		}
+
+		switch f {
+		case "graphml":
+			vertices = append(vertices, func() (importSource, error) { return openGraphMLSource(file, false) })
+			edges = append(edges, func() (importSource, error) { return openGraphMLSource(file, true) })
+		case "graphson":
+			vertices = append(vertices, func() (importSource, error) { return openGraphSONSource(file, false) })
+			edges = append(edges, func() (importSource, error) { return openGraphSONSource(file, true) })
+		default:
+			return nil, fmt.Errorf("%s: unknown input format. Use -input graphml or -input graphson", file)
+		}
+	}
+	return append(vertices, edges...), nil
+}
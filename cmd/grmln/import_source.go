@@ -0,0 +1,689 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// property is a single property of an imported element
+type property struct {
+	key   string
+	value interface{}
+}
+
+// endpoint identifies an edge's vertex by import id. label is empty if the source doesn't know it
+type endpoint struct {
+	label string
+	id    interface{}
+}
+
+// importRecord is a vertex or edge read from an import source
+type importRecord struct {
+	edge  bool
+	label string
+	id    interface{}
+	props []property
+	from  endpoint
+	to    endpoint
+
+	// line is where the record starts in its file, raw is the record as read for the rejected rows log
+	line int
+	raw  interface{}
+
+	// err is set if the record couldn't be read. It is rejected without being sent
+	err error
+}
+
+// importSource reads vertices or edges from a file
+type importSource interface {
+	// Name identifies the source in checkpoints and logs
+	Name() string
+
+	// Next returns the next record, or io.EOF at the end of the source
+	Next() (*importRecord, error)
+
+	Close() error
+}
+
+func sourceName(edges bool, file string) string {
+	if edges {
+		return "edges:" + file
+	}
+	return "vertices:" + file
+}
+
+// plainValue converts JSON numbers to int64 or float64
+func plainValue(v interface{}) interface{} {
+	switch value := v.(type) {
+	case json.Number:
+		if n, err := value.Int64(); err == nil {
+			return n
+		}
+		f, _ := value.Float64()
+		return f
+	case []interface{}:
+		out := make([]interface{}, len(value))
+		for i, e := range value {
+			out[i] = plainValue(e)
+		}
+		return out
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(value))
+		for k, e := range value {
+			out[k] = plainValue(e)
+		}
+		return out
+	}
+	return v
+}
+
+// csvMapping maps CSV files to vertices and edges
+type csvMapping struct {
+	Vertices []*csvElementMapping `json:"vertices"`
+	Edges    []*csvElementMapping `json:"edges"`
+}
+
+// csvElementMapping maps the columns of one CSV file to vertices or edges
+type csvElementMapping struct {
+	// File is relative to the mapping file
+	File string `json:"file"`
+
+	// Label is the label of every element, unless LabelColumn names a column that holds it
+	Label       string `json:"label"`
+	LabelColumn string `json:"labelColumn"`
+
+	// ID is the column holding the element's import id. Required for vertices. Edges default to "from-label->to"
+	ID *csvColumn `json:"id"`
+
+	// From and To are the columns holding an edge's vertex import ids
+	From *csvEndpoint `json:"from"`
+	To   *csvEndpoint `json:"to"`
+
+	// Properties maps property keys to columns
+	Properties map[string]*csvColumn `json:"properties"`
+
+	// Delimiter is the field delimiter. Defaults to a comma
+	Delimiter string `json:"delimiter"`
+}
+
+// csvColumn is a column and the type of its values: string (the default), int, float or bool.
+// A plain string is the column name
+type csvColumn struct {
+	Column string `json:"column"`
+	Type   string `json:"type"`
+}
+
+func (c *csvColumn) UnmarshalJSON(b []byte) error {
+	if err := json.Unmarshal(b, &c.Column); err == nil {
+		return nil
+	}
+
+	type column csvColumn
+	return json.Unmarshal(b, (*column)(c))
+}
+
+// csvEndpoint is the column holding an edge's vertex import id and that vertex's label
+type csvEndpoint struct {
+	Column string `json:"column"`
+	Type   string `json:"type"`
+	Label  string `json:"label"`
+}
+
+func loadCSVMapping(path string) (*csvMapping, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var m csvMapping
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.DisallowUnknownFields()
+	if err := d.Decode(&m); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	dir := filepath.Dir(path)
+	check := func(kind string, i int, e *csvElementMapping) error {
+		prefix := fmt.Sprintf("%s[%d]", kind, i)
+		switch {
+		case e.File == "":
+			return fmt.Errorf("%s.file is required", prefix)
+		case e.Label == "" && e.LabelColumn == "":
+			return fmt.Errorf("%s.label or %s.labelColumn is required", prefix, prefix)
+		case kind == "vertices" && (e.ID == nil || e.ID.Column == ""):
+			return fmt.Errorf("%s.id is required", prefix)
+		case kind == "edges" && (e.From == nil || e.From.Column == ""):
+			return fmt.Errorf("%s.from is required", prefix)
+		case kind == "edges" && (e.To == nil || e.To.Column == ""):
+			return fmt.Errorf("%s.to is required", prefix)
+		case len([]rune(e.Delimiter)) > 1:
+			return fmt.Errorf("%s.delimiter must be a single character", prefix)
+		}
+		for key, col := range e.Properties {
+			if col == nil || col.Column == "" {
+				return fmt.Errorf("%s.properties.%s has no column", prefix, key)
+			}
+			if !cellTypes[col.Type] {
+				return fmt.Errorf("%s.properties.%s has unknown type %q", prefix, key, col.Type)
+			}
+		}
+		for name, typ := range map[string]string{"id": typeOf(e.ID), "from": typeOf(e.From), "to": typeOf(e.To)} {
+			if !cellTypes[typ] {
+				return fmt.Errorf("%s.%s has unknown type %q", prefix, name, typ)
+			}
+		}
+		if !filepath.IsAbs(e.File) {
+			e.File = filepath.Join(dir, e.File)
+		}
+		return nil
+	}
+
+	for i, e := range m.Vertices {
+		if err := check("vertices", i, e); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+	}
+	for i, e := range m.Edges {
+		if err := check("edges", i, e); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+	}
+	if len(m.Vertices) == 0 && len(m.Edges) == 0 {
+		return nil, fmt.Errorf("%s: no vertices or edges", path)
+	}
+	return &m, nil
+}
+
+// cellTypes are the types CSV cells can be converted to
+var cellTypes = map[string]bool{"": true, "string": true, "int": true, "float": true, "bool": true}
+
+func typeOf(column interface{}) string {
+	switch c := column.(type) {
+	case *csvColumn:
+		if c != nil {
+			return c.Type
+		}
+	case *csvEndpoint:
+		if c != nil {
+			return c.Type
+		}
+	}
+	return ""
+}
+
+// convertCell converts a CSV cell to the given type
+func convertCell(cell, typ string) (interface{}, error) {
+	switch typ {
+	case "", "string":
+		return cell, nil
+	case "int":
+		n, err := strconv.ParseInt(strings.TrimSpace(cell), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid int %q", cell)
+		}
+		return n, nil
+	case "float":
+		f, err := strconv.ParseFloat(strings.TrimSpace(cell), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid float %q", cell)
+		}
+		return f, nil
+	case "bool":
+		b, err := strconv.ParseBool(strings.TrimSpace(cell))
+		if err != nil {
+			return nil, fmt.Errorf("invalid bool %q", cell)
+		}
+		return b, nil
+	}
+	return nil, fmt.Errorf("unknown type %q", typ)
+}
+
+type csvSource struct {
+	mapping *csvElementMapping
+	edges   bool
+	f       *os.File
+	r       *csv.Reader
+	header  []string
+	columns map[string]int
+}
+
+func openCSVSource(m *csvElementMapping, edges bool) (*csvSource, error) {
+	f, err := os.Open(m.File)
+	if err != nil {
+		return nil, err
+	}
+
+	r := csv.NewReader(bufio.NewReader(f))
+	r.ReuseRecord = false
+	if m.Delimiter != "" {
+		r.Comma = []rune(m.Delimiter)[0]
+	}
+
+	header, err := r.Read()
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: reading header: %v", m.File, err)
+	}
+
+	s := &csvSource{mapping: m, edges: edges, f: f, r: r, header: header, columns: map[string]int{}}
+	for i, h := range header {
+		s.columns[strings.TrimSpace(h)] = i
+	}
+
+	// Check every mapped column exists up front rather than rejecting every row
+	var needed []string
+	if m.LabelColumn != "" {
+		needed = append(needed, m.LabelColumn)
+	}
+	if m.ID != nil {
+		needed = append(needed, m.ID.Column)
+	}
+	if m.From != nil {
+		needed = append(needed, m.From.Column)
+	}
+	if m.To != nil {
+		needed = append(needed, m.To.Column)
+	}
+	for _, col := range m.Properties {
+		needed = append(needed, col.Column)
+	}
+	for _, col := range needed {
+		if _, ok := s.columns[col]; !ok {
+			f.Close()
+			return nil, fmt.Errorf("%s: no column %q", m.File, col)
+		}
+	}
+
+	return s, nil
+}
+
+func (s *csvSource) Name() string {
+	return sourceName(s.edges, s.mapping.File)
+}
+
+func (s *csvSource) Close() error {
+	return s.f.Close()
+}
+
+func (s *csvSource) Next() (*importRecord, error) {
+	row, err := s.r.Read()
+	if err == io.EOF {
+		return nil, err
+	}
+
+	if err != nil {
+		// A malformed row is rejected, the rest of the file can still be read
+		if perr, ok := err.(*csv.ParseError); ok {
+			return &importRecord{edge: s.edges, line: perr.StartLine, raw: strings.Join(row, ","), err: err}, nil
+		}
+		return nil, err
+	}
+
+	line := 0
+	if len(row) > 0 {
+		line, _ = s.r.FieldPos(0)
+	}
+
+	raw := map[string]string{}
+	for i, h := range s.header {
+		if i < len(row) {
+			raw[h] = row[i]
+		}
+	}
+
+	rec := &importRecord{edge: s.edges, line: line, raw: raw, label: s.mapping.Label}
+	rec.err = s.fill(rec, row)
+	return rec, nil
+}
+
+func (s *csvSource) cell(row []string, column string) string {
+	if i, ok := s.columns[column]; ok && i < len(row) {
+		return row[i]
+	}
+	return ""
+}
+
+func (s *csvSource) fill(rec *importRecord, row []string) error {
+	m := s.mapping
+
+	if m.LabelColumn != "" {
+		rec.label = s.cell(row, m.LabelColumn)
+		if rec.label == "" {
+			return fmt.Errorf("empty label in column %q", m.LabelColumn)
+		}
+	}
+
+	value := func(column, typ string) (interface{}, error) {
+		cell := s.cell(row, column)
+		if cell == "" {
+			return nil, fmt.Errorf("empty %q", column)
+		}
+		v, err := convertCell(cell, typ)
+		if err != nil {
+			return nil, fmt.Errorf("column %q: %v", column, err)
+		}
+		return v, nil
+	}
+
+	var err error
+	if s.edges {
+		if rec.from.id, err = value(m.From.Column, m.From.Type); err != nil {
+			return err
+		}
+		if rec.to.id, err = value(m.To.Column, m.To.Type); err != nil {
+			return err
+		}
+		rec.from.label, rec.to.label = m.From.Label, m.To.Label
+	}
+
+	if m.ID != nil {
+		if rec.id, err = value(m.ID.Column, m.ID.Type); err != nil {
+			return err
+		}
+	} else {
+		rec.id = fmt.Sprintf("%v-%s->%v", rec.from.id, rec.label, rec.to.id)
+	}
+
+	keys := make([]string, 0, len(m.Properties))
+	for k := range m.Properties {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		col := m.Properties[k]
+		if s.cell(row, col.Column) == "" {
+			continue
+		}
+		v, err := value(col.Column, col.Type)
+		if err != nil {
+			return err
+		}
+		rec.props = append(rec.props, property{key: k, value: v})
+	}
+	return nil
+}
+
+// graphMLKey is a GraphML attribute declaration
+type graphMLKey struct {
+	ID   string `xml:"id,attr"`
+	For  string `xml:"for,attr"`
+	Name string `xml:"attr.name,attr"`
+	Type string `xml:"attr.type,attr"`
+}
+
+type graphMLData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+type graphMLElement struct {
+	ID     string        `xml:"id,attr"`
+	Source string        `xml:"source,attr"`
+	Target string        `xml:"target,attr"`
+	Label  string        `xml:"label,attr"`
+	Data   []graphMLData `xml:"data"`
+}
+
+// graphMLSource reads the nodes or edges of a GraphML file. Labels are read from the labelV and labelE
+// attributes TinkerPop writes, or an edge's label attribute
+type graphMLSource struct {
+	file  string
+	edges bool
+	f     *os.File
+	d     *xml.Decoder
+	keys  map[string]graphMLKey
+}
+
+func openGraphMLSource(file string, edges bool) (*graphMLSource, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	return &graphMLSource{
+		file:  file,
+		edges: edges,
+		f:     f,
+		d:     xml.NewDecoder(bufio.NewReader(f)),
+		keys:  map[string]graphMLKey{},
+	}, nil
+}
+
+func (s *graphMLSource) Name() string {
+	return sourceName(s.edges, s.file)
+}
+
+func (s *graphMLSource) Close() error {
+	return s.f.Close()
+}
+
+func (s *graphMLSource) Next() (*importRecord, error) {
+	for {
+		tok, err := s.d.Token()
+		if err != nil {
+			return nil, err
+		}
+
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		line, _ := s.d.InputPos()
+
+		switch {
+		case start.Name.Local == "key":
+			var k graphMLKey
+			if err := s.d.DecodeElement(&k, &start); err != nil {
+				return nil, err
+			}
+			s.keys[k.ID] = k
+		case start.Name.Local == "node" && !s.edges, start.Name.Local == "edge" && s.edges:
+			var e graphMLElement
+			if err := s.d.DecodeElement(&e, &start); err != nil {
+				return nil, err
+			}
+			return s.record(e, line), nil
+		case start.Name.Local == "node" || start.Name.Local == "edge":
+			if err := s.d.Skip(); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// graphMLID converts GraphML ids, which are always strings, to integers when they are numeric
+func graphMLID(id string) interface{} {
+	if n, err := strconv.ParseInt(id, 10, 64); err == nil {
+		return n
+	}
+	return id
+}
+
+func (s *graphMLSource) record(e graphMLElement, line int) *importRecord {
+	rec := &importRecord{edge: s.edges, line: line, raw: e, label: e.Label}
+
+	if s.edges {
+		rec.from.id, rec.to.id = graphMLID(e.Source), graphMLID(e.Target)
+		if e.Source == "" || e.Target == "" {
+			rec.err = fmt.Errorf("edge requires a source and target")
+			return rec
+		}
+	} else if e.ID == "" {
+		rec.err = fmt.Errorf("node requires an id")
+		return rec
+	}
+
+	for _, d := range e.Data {
+		k, ok := s.keys[d.Key]
+		name := d.Key
+		if ok && k.Name != "" {
+			name = k.Name
+		}
+
+		if name == "labelV" || name == "labelE" {
+			rec.label = d.Value
+			continue
+		}
+
+		typ := ""
+		switch k.Type {
+		case "int", "long":
+			typ = "int"
+		case "float", "double":
+			typ = "float"
+		case "boolean":
+			typ = "bool"
+		}
+		v, err := convertCell(d.Value, typ)
+		if err != nil {
+			rec.err = fmt.Errorf("%s: %v", name, err)
+			return rec
+		}
+		rec.props = append(rec.props, property{key: name, value: v})
+	}
+
+	if rec.label == "" {
+		rec.label = "vertex"
+		if s.edges {
+			rec.label = "edge"
+		}
+	}
+
+	rec.id = graphMLID(e.ID)
+	if s.edges && e.ID == "" {
+		rec.id = fmt.Sprintf("%v-%s->%v", rec.from.id, rec.label, rec.to.id)
+	}
+	return rec
+}
+
+// graphSONSource reads a GraphSON adjacency list: one vertex per line with its out edges
+type graphSONSource struct {
+	file    string
+	edges   bool
+	f       *os.File
+	s       *bufio.Scanner
+	line    int
+	pending []*importRecord
+}
+
+func openGraphSONSource(file string, edges bool) (*graphSONSource, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+
+	s := bufio.NewScanner(f)
+	s.Buffer(nil, 64*1024*1024)
+	return &graphSONSource{file: file, edges: edges, f: f, s: s}, nil
+}
+
+func (s *graphSONSource) Name() string {
+	return sourceName(s.edges, s.file)
+}
+
+func (s *graphSONSource) Close() error {
+	return s.f.Close()
+}
+
+func (s *graphSONSource) Next() (*importRecord, error) {
+	for len(s.pending) == 0 {
+		if !s.s.Scan() {
+			if err := s.s.Err(); err != nil {
+				return nil, err
+			}
+			return nil, io.EOF
+		}
+		s.line++
+
+		line := bytes.TrimSpace(s.s.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		s.pending = s.records(line)
+	}
+
+	rec := s.pending[0]
+	s.pending = s.pending[1:]
+	return rec, nil
+}
+
+func (s *graphSONSource) records(line []byte) []*importRecord {
+	results, err := decodeResults(line)
+	if err == nil && len(results) != 1 {
+		err = fmt.Errorf("expected a single vertex")
+	}
+	if err != nil {
+		return []*importRecord{{edge: s.edges, line: s.line, raw: string(line), err: err}}
+	}
+
+	v, ok := plainValue(results[0]).(map[string]interface{})
+	if !ok || v["id"] == nil {
+		return []*importRecord{{edge: s.edges, line: s.line, raw: string(line), err: fmt.Errorf("expected a vertex")}}
+	}
+	label, _ := v["label"].(string)
+
+	if !s.edges {
+		rec := &importRecord{line: s.line, raw: v, id: v["id"], label: label}
+		props, _ := v["properties"].(map[string]interface{})
+		for _, key := range sortedKeys(props) {
+			values, _ := props[key].([]interface{})
+			for _, p := range values {
+				if pm, ok := p.(map[string]interface{}); ok {
+					p = pm["value"]
+				}
+				rec.props = append(rec.props, property{key: key, value: p})
+			}
+		}
+		return []*importRecord{rec}
+	}
+
+	var records []*importRecord
+	outE, _ := v["outE"].(map[string]interface{})
+	for _, edgeLabel := range sortedKeys(outE) {
+		edges, _ := outE[edgeLabel].([]interface{})
+		for _, raw := range edges {
+			e, ok := raw.(map[string]interface{})
+			if !ok || e["inV"] == nil {
+				records = append(records, &importRecord{edge: true, line: s.line, raw: raw, err: fmt.Errorf("invalid edge")})
+				continue
+			}
+
+			rec := &importRecord{
+				edge:  true,
+				line:  s.line,
+				raw:   e,
+				label: edgeLabel,
+				id:    e["id"],
+				from:  endpoint{label: label, id: v["id"]},
+				to:    endpoint{id: e["inV"]},
+			}
+			if l, ok := e["inVLabel"].(string); ok {
+				rec.to.label = l
+			}
+			if rec.id == nil {
+				rec.id = fmt.Sprintf("%v-%s->%v", rec.from.id, rec.label, rec.to.id)
+			}
+
+			props, _ := e["properties"].(map[string]interface{})
+			for _, key := range sortedKeys(props) {
+				p := props[key]
+				if pm, ok := p.(map[string]interface{}); ok {
+					p = pm["value"]
+				}
+				rec.props = append(rec.props, property{key: key, value: p})
+			}
+			records = append(records, rec)
+		}
+	}
+	return records
+}
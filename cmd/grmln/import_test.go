@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/evandigby/grmln/grmlntest"
+)
+
+func writeFiles(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	return dir
+}
+
+func evalGraph(t *testing.T, g *grmlntest.Graph, gremlin string) string {
+	results, err := g.Eval(gremlin, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var out []string
+	for _, r := range results {
+		out = append(out, short(r))
+	}
+	return strings.Join(out, ",")
+}
+
+func TestImportCSV(t *testing.T) {
+	g := grmlntest.NewGraph()
+	s := grmlntest.NewServer(g.Handler())
+	defer s.Close()
+
+	dir := writeFiles(t, map[string]string{
+		"people.csv": "id,name,age\n1,marko,29\n2,vadas,27\n3,josh,not a number\n4,peter,\n5,ri\"pple,31\n\"6,unterminated,1\n",
+		"knows.csv":  "src,dst,weight\n1,2,0.5\n1,4,1.0\n1,99,0.1\n",
+		"mapping.json": `{
+			"vertices": [{"file": "people.csv", "label": "person", "id": {"column": "id", "type": "int"},
+				"properties": {"name": "name", "age": {"column": "age", "type": "int"}}}],
+			"edges": [{"file": "knows.csv", "label": "knows",
+				"from": {"column": "src", "type": "int", "label": "person"},
+				"to": {"column": "dst", "type": "int", "label": "person"},
+				"properties": {"weight": {"column": "weight", "type": "float"}}}]
+		}`,
+	})
+
+	checkpoint := filepath.Join(dir, "checkpoint")
+	rejects := filepath.Join(dir, "rejects.jsonl")
+	args := []string{"import", "-addr", s.URL, "-rows", "2", "-mapping", filepath.Join(dir, "mapping.json"), "-checkpoint", checkpoint, "-rejects", rejects}
+
+	var stdout, stderr bytes.Buffer
+	if code := run(args, nil, &stdout, &stderr); code != 1 {
+		t.Fatalf("expected exit code 1 for rejected rows but got %d: %s", code, stderr.String())
+	}
+	if !strings.Contains(stdout.String(), "imported 3 vertices and 2 edges") || !strings.Contains(stdout.String(), "4 rejected") {
+		t.Fatalf("unexpected summary %q", stdout.String())
+	}
+
+	if actual := evalGraph(t, g, "g.V().has('person', 'importId', 1).out('knows').values('name').order()"); actual != "peter,vadas" {
+		t.Fatalf("unexpected neighbours %q", actual)
+	}
+	if actual := evalGraph(t, g, "g.V().has('importId', 4).values('age').count()"); actual != "0" {
+		t.Fatalf("expected empty cells to be skipped but got %q", actual)
+	}
+
+	b, err := os.ReadFile(rejects)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// Vertex batches finish in any order, so the rejected rows are found regardless of order
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if len(lines) != 4 || !strings.Contains(lines[3], "vertex not found") {
+		t.Fatalf("unexpected rejects:\n%s", b)
+	}
+	vertexRejects := strings.Join(lines[:3], "\n")
+	for _, expected := range []string{`"line":4`, "invalid int", `"line":6`, "bare \\\" in non-quoted-field", `"line":7`, "extraneous or missing"} {
+		if !strings.Contains(vertexRejects, expected) {
+			t.Fatalf("expected rejects to contain %q but got:\n%s", expected, b)
+		}
+	}
+
+	b, err = os.ReadFile(checkpoint)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(string(b), "people.csv\": 6") || !strings.Contains(string(b), "knows.csv\": 3") {
+		t.Fatalf("unexpected checkpoint:\n%s", b)
+	}
+
+	// Resuming from a checkpoint part way through re-runs the remaining rows without duplicating anything
+	os.WriteFile(checkpoint, []byte(`{"sources": {"vertices:`+filepath.Join(dir, "people.csv")+`": 1}}`), 0600)
+	stdout.Reset()
+	run(args, nil, &stdout, &stderr)
+	if !strings.Contains(stdout.String(), "imported 2 vertices and 2 edges") {
+		t.Fatalf("unexpected summary %q", stdout.String())
+	}
+	if actual := evalGraph(t, g, "g.V().count()"); actual != "3" {
+		t.Fatalf("expected 3 vertices but got %s", actual)
+	}
+	if actual := evalGraph(t, g, "g.E().count()"); actual != "2" {
+		t.Fatalf("expected 2 edges but got %s", actual)
+	}
+}
+
+func TestImportGraphMLAndGraphSON(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"graph.graphml": `<?xml version="1.0" ?>
+<graphml xmlns="http://graphml.graphdrawing.org/xmlns">
+  <key id="labelV" for="node" attr.name="labelV" attr.type="string"/>
+  <key id="name" for="node" attr.name="name" attr.type="string"/>
+  <key id="age" for="node" attr.name="age" attr.type="int"/>
+  <key id="labelE" for="edge" attr.name="labelE" attr.type="string"/>
+  <key id="weight" for="edge" attr.name="weight" attr.type="double"/>
+  <graph id="G" edgedefault="directed">
+    <node id="1"><data key="labelV">person</data><data key="name">marko</data><data key="age">29</data></node>
+    <edge id="7" source="1" target="2"><data key="labelE">knows</data><data key="weight">0.5</data></edge>
+    <node id="2"><data key="labelV">person</data><data key="name">vadas</data></node>
+  </graph>
+</graphml>`,
+		"graph.json": `{"id":1,"label":"person","outE":{"knows":[{"id":7,"inV":2,"properties":{"weight":0.5}}]},"properties":{"name":[{"id":0,"value":"marko"}],"age":[{"id":1,"value":29}]}}
+{"@type":"g:Vertex","@value":{"id":{"@type":"g:Int64","@value":2},"label":"person","properties":{"name":[{"@type":"g:VertexProperty","@value":{"id":{"@type":"g:Int64","@value":3},"value":"vadas","label":"name"}}]}}}
+`,
+	})
+
+	for _, file := range []string{"graph.graphml", "graph.json"} {
+		t.Run(file, func(t *testing.T) {
+			g := grmlntest.NewGraph()
+			s := grmlntest.NewServer(g.Handler())
+			defer s.Close()
+
+			var stdout, stderr bytes.Buffer
+			if code := run([]string{"import", "-addr", s.URL, filepath.Join(dir, file)}, nil, &stdout, &stderr); code != 0 {
+				t.Fatalf("expected exit code 0 but got %d: %s%s", code, stdout.String(), stderr.String())
+			}
+
+			if actual := evalGraph(t, g, "g.V().has('name', 'marko').outE('knows').as('e').inV().values('name')"); actual != "vadas" {
+				t.Fatalf("unexpected neighbours %q", actual)
+			}
+			if actual := evalGraph(t, g, "g.E().values('weight', 'importId')"); actual != "0.5,7" {
+				t.Fatalf("unexpected edge properties %q", actual)
+			}
+			if actual := evalGraph(t, g, "g.V().has('name', 'marko').values('age')"); actual != "29" {
+				t.Fatalf("unexpected age %q", actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+// Command grmln is a command line client for Gremlin Server
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// command is a grmln subcommand. run returns the process exit code
+type command struct {
+	usage string
+	run   func(args []string, stdin io.Reader, stdout, stderr io.Writer) int
+}
+
+var commands = map[string]command{
+	"console": {"interactive gremlin console", runConsole},
+	"run":     {"run statements from a file or stdin", runRun},
+	"bench":   {"benchmark a weighted query workload", runBench},
+	"import":  {"import vertices and edges from CSV, GraphML or GraphSON", runImport},
+	"export":  {"export the graph as GraphSON, GraphML, CSV or DOT", runExport},
+	"copy":    {"copy the graph between servers, transforming properties", runCopy},
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		usage(stderr)
+		return 2
+	}
+
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(stderr, "grmln: unknown command %q\n", args[0])
+		usage(stderr)
+		return 2
+	}
+
+	return cmd.run(args[1:], stdin, stdout, stderr)
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "usage: grmln <command> [flags]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "commands:")
+
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		fmt.Fprintf(w, "  %-10s %s\n", name, commands[name].usage)
+	}
+}
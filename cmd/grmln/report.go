@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/evandigby/grmln"
+)
+
+// errorKind describes an error for reports. Server errors are named by status code
+func errorKind(err error) string {
+	if resp, ok := err.(interface{ Response() grmln.Response }); ok {
+		code := resp.Response().Status.Code
+		return fmt.Sprintf("%d %s", code, grmln.StatusString(code))
+	}
+
+	var netErr net.Error
+	switch {
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case grmln.IsNoHostsAvailable(err):
+		return "no hosts available"
+	case grmln.IsClusterClosed(err):
+		return "cluster closed"
+	}
+	return "client error"
+}
+
+// report collects the outcome of requests
+type report struct {
+	mu        sync.Mutex
+	latencies []time.Duration
+	succeeded int
+	failed    int
+	skipped   int
+	errors    map[string]int
+}
+
+func newReport() *report {
+	return &report{errors: map[string]int{}}
+}
+
+func (r *report) record(latency time.Duration, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.latencies = append(r.latencies, latency)
+	if err != nil {
+		r.failed++
+		r.errors[errorKind(err)]++
+		return
+	}
+	r.succeeded++
+}
+
+func (r *report) skip(n int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.skipped += n
+}
+
+// percentile returns the latency at p (0-100). latencies must be sorted
+func percentile(latencies []time.Duration, p float64) time.Duration {
+	if len(latencies) == 0 {
+		return 0
+	}
+	i := int(float64(len(latencies))*p/100+0.5) - 1
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(latencies) {
+		i = len(latencies) - 1
+	}
+	return latencies[i]
+}
+
+func (r *report) sortedLatencies() []time.Duration {
+	sorted := append([]time.Duration{}, r.latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted
+}
+
+// writeErrors writes the error breakdown, most frequent first
+func (r *report) writeErrors(w io.Writer) {
+	kinds := make([]string, 0, len(r.errors))
+	for k := range r.errors {
+		kinds = append(kinds, k)
+	}
+	sort.Slice(kinds, func(i, j int) bool {
+		if r.errors[kinds[i]] != r.errors[kinds[j]] {
+			return r.errors[kinds[i]] > r.errors[kinds[j]]
+		}
+		return kinds[i] < kinds[j]
+	})
+
+	for _, k := range kinds {
+		fmt.Fprintf(w, "  %-40s %d\n", k, r.errors[k])
+	}
+}
+
+func (r *report) writeLatencies(w io.Writer) {
+	sorted := r.sortedLatencies()
+	if len(sorted) == 0 {
+		return
+	}
+
+	var parts []string
+	for _, p := range []float64{50, 90, 99} {
+		parts = append(parts, fmt.Sprintf("p%v %v", p, round(percentile(sorted, p))))
+	}
+	parts = append(parts, fmt.Sprintf("max %v", round(sorted[len(sorted)-1])))
+	fmt.Fprintf(w, "latency: %s\n", strings.Join(parts, ", "))
+}
+
+func round(d time.Duration) time.Duration {
+	return d.Round(time.Microsecond)
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/evandigby/grmln"
+)
+
+// statement is a single statement to run. JSON Lines input uses the same fields
+type statement struct {
+	Gremlin  string         `json:"gremlin"`
+	Bindings grmln.Bindings `json:"bindings"`
+
+	// line is the line the statement starts on, for error messages
+	line int
+}
+
+func runRun(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("run", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: grmln run [flags] [file]")
+		fmt.Fprintln(stderr, "\nRuns statements from file, or stdin if file is - or missing.")
+		fmt.Fprintln(stderr, "Statements end when their brackets and strings close, unless the next line starts with a dot.")
+		fmt.Fprintln(stderr, "Files ending in .jsonl (or with -jsonl) contain one {\"gremlin\", \"bindings\"} record per line.")
+		fmt.Fprintln(stderr)
+		fs.PrintDefaults()
+	}
+
+	var conn connFlags
+	conn.register(fs)
+
+	jsonLines := fs.Bool("jsonl", false, "input is JSON Lines of {\"gremlin\", \"bindings\"} records")
+	concurrency := fs.Int("concurrency", 1, "number of statements to run at once")
+	statementTimeout := fs.Duration("statement-timeout", 0, "timeout for each statement. 0 means no timeout")
+	continueOnError := fs.Bool("continue", false, "continue after a statement fails instead of stopping")
+	format := fs.String("format", "ndjson", "output format: "+formatNames())
+	quiet := fs.Bool("quiet", false, "don't write results")
+
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if _, err := newFormatter(*format, stdout); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+	if *concurrency < 1 {
+		fmt.Fprintln(stderr, "concurrency must be at least 1")
+		return 2
+	}
+
+	in := stdin
+	name := "-"
+	if fs.NArg() > 0 && fs.Arg(0) != "-" {
+		name = fs.Arg(0)
+		f, err := os.Open(name)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		defer f.Close()
+		in = f
+	}
+
+	var statements []statement
+	var err error
+	if *jsonLines || strings.HasSuffix(name, ".jsonl") {
+		statements, err = readJSONLines(in)
+	} else {
+		statements, err = readStatements(in)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "%s: %v\n", name, err)
+		return 1
+	}
+
+	c, err := conn.connect(context.Background(), stderr)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	defer c.close()
+
+	r := &runner{
+		op:               c.op,
+		concurrency:      *concurrency,
+		statementTimeout: *statementTimeout,
+		continueOnError:  *continueOnError,
+		format:           *format,
+		quiet:            *quiet,
+		out:              stdout,
+		errOut:           stderr,
+	}
+
+	rep := r.run(context.Background(), statements)
+	if rep.failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// readStatements splits gremlin script input into statements
+func readStatements(r io.Reader) ([]statement, error) {
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 16*1024*1024)
+
+	var statements []statement
+	var lines []string
+	start := 0
+
+	flush := func() {
+		gremlin := strings.TrimSpace(strings.Join(lines, "\n"))
+		gremlin = strings.TrimSpace(strings.TrimSuffix(gremlin, ";"))
+		if gremlin != "" {
+			statements = append(statements, statement{Gremlin: gremlin, line: start})
+		}
+		lines = nil
+	}
+
+	for n := 1; s.Scan(); n++ {
+		line := s.Text()
+		trimmed := strings.TrimSpace(line)
+
+		if len(lines) == 0 && (trimmed == "" || strings.HasPrefix(trimmed, "//")) {
+			continue
+		}
+
+		// A line starting with a dot continues the previous statement
+		if len(lines) > 0 && !strings.HasPrefix(trimmed, ".") && !incomplete(strings.Join(lines, "\n")) {
+			flush()
+			if trimmed == "" || strings.HasPrefix(trimmed, "//") {
+				continue
+			}
+		}
+
+		if len(lines) == 0 {
+			start = n
+		}
+		lines = append(lines, line)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(lines) > 0 {
+		if incomplete(strings.Join(lines, "\n")) {
+			return nil, fmt.Errorf("line %d: incomplete statement", start)
+		}
+		flush()
+	}
+
+	return statements, nil
+}
+
+func readJSONLines(r io.Reader) ([]statement, error) {
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 16*1024*1024)
+
+	var statements []statement
+	for n := 1; s.Scan(); n++ {
+		line := bytes.TrimSpace(s.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		st := statement{line: n}
+		if err := json.Unmarshal(line, &st); err != nil {
+			return nil, fmt.Errorf("line %d: %v", n, err)
+		}
+		if strings.TrimSpace(st.Gremlin) == "" {
+			return nil, fmt.Errorf("line %d: missing gremlin", n)
+		}
+		statements = append(statements, st)
+	}
+	return statements, s.Err()
+}
+
+// runner runs statements concurrently and reports on them
+type runner struct {
+	op               *grmln.Operator
+	concurrency      int
+	statementTimeout time.Duration
+	continueOnError  bool
+	format           string
+	quiet            bool
+
+	mu     sync.Mutex
+	out    io.Writer
+	errOut io.Writer
+}
+
+func (r *runner) run(ctx context.Context, statements []statement) *report {
+	// Stopping on an error stops starting statements. Those already running are left to finish
+	// since they may be writes
+	dispatch, stop := context.WithCancel(ctx)
+	defer stop()
+
+	rep := newReport()
+	start := time.Now()
+
+	work := make(chan statement)
+	var wg sync.WaitGroup
+	for i := 0; i < r.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for st := range work {
+				if dispatch.Err() != nil {
+					rep.skip(1)
+					continue
+				}
+
+				latency, err := r.runStatement(ctx, st)
+				rep.record(latency, err)
+
+				if err != nil {
+					r.mu.Lock()
+					fmt.Fprintf(r.errOut, "line %d: %v\n", st.line, err)
+					r.mu.Unlock()
+
+					if !r.continueOnError {
+						stop()
+					}
+				}
+			}
+		}()
+	}
+
+	for i, st := range statements {
+		select {
+		case work <- st:
+			continue
+		case <-dispatch.Done():
+			rep.skip(len(statements) - i)
+		}
+		break
+	}
+	close(work)
+	wg.Wait()
+
+	r.writeSummary(rep, time.Since(start))
+	return rep
+}
+
+func (r *runner) runStatement(ctx context.Context, st statement) (time.Duration, error) {
+	if r.statementTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.statementTimeout)
+		defer cancel()
+	}
+
+	// Results stream straight out when statements run one at a time, otherwise each statement's
+	// results are written together once it finishes so they don't interleave
+	var buf bytes.Buffer
+	var w io.Writer = &buf
+	if r.concurrency == 1 {
+		w = r.out
+	}
+	f, _ := newFormatter(r.format, w)
+
+	start := time.Now()
+	err := r.op.EvalDefault(ctx, st.Gremlin, st.Bindings, func(resp *grmln.Response) {
+		if r.quiet {
+			return
+		}
+		results, err := decodeResults(resp.Result.Data)
+		if err != nil {
+			fmt.Fprintln(w, string(resp.Result.Data))
+			return
+		}
+		f.Frame(results)
+	})
+	latency := time.Since(start)
+	f.End()
+
+	// A statement that ran out of time fails with whatever the connection saw, such as a read timeout.
+	// Reporting the context's error names it as a timeout
+	if ctx.Err() != nil && (err == nil || !isResponseError(err)) {
+		err = ctx.Err()
+	}
+
+	if buf.Len() > 0 {
+		r.mu.Lock()
+		r.out.Write(buf.Bytes())
+		r.mu.Unlock()
+	}
+	return latency, err
+}
+
+func (r *runner) writeSummary(rep *report, elapsed time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	fmt.Fprintf(r.errOut, "%d statements in %v: %d succeeded, %d failed, %d skipped\n",
+		rep.succeeded+rep.failed+rep.skipped, round(elapsed), rep.succeeded, rep.failed, rep.skipped)
+	if rep.failed > 0 {
+		fmt.Fprintln(r.errOut, "failures:")
+		rep.writeErrors(r.errOut)
+	}
+	rep.writeLatencies(r.errOut)
+}
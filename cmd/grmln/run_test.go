@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/evandigby/grmln"
+	"github.com/evandigby/grmln/grmlntest"
+)
+
+func TestReadStatements(t *testing.T) {
+	input := `
+// people
+g.addV('person').property('name', 'marko');
+g.V().
+  has('name', 'marko')
+g.V()
+  .count()
+
+g.inject([1,
+  2])
+`
+	statements, err := readStatements(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []string{
+		"g.addV('person').property('name', 'marko')",
+		"g.V().\n  has('name', 'marko')",
+		"g.V()\n  .count()",
+		"g.inject([1,\n  2])",
+	}
+	if len(statements) != len(expected) {
+		t.Fatalf("expected %d statements but got %+v", len(expected), statements)
+	}
+	for i, e := range expected {
+		if statements[i].Gremlin != e {
+			t.Fatalf("expected %q but got %q", e, statements[i].Gremlin)
+		}
+	}
+	if statements[1].line != 4 {
+		t.Fatalf("expected statement to start on line 4 but got %d", statements[1].line)
+	}
+
+	if _, err := readStatements(strings.NewReader("g.V().has(")); err == nil {
+		t.Fatal("expected incomplete statement error")
+	}
+}
+
+func TestRun(t *testing.T) {
+	s := grmlntest.NewServer(grmlntest.NewGraph().Handler())
+	defer s.Close()
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "statements.jsonl")
+	err := os.WriteFile(file, []byte(`{"gremlin": "g.addV('person').property('name', name).count()", "bindings": {"name": "marko"}}
+{"gremlin": "g.V().bogus()"}
+{"gremlin": "g.V().values('name')"}
+`), 0600)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	code := run([]string{"run", "-addr", s.URL, "-continue", file}, nil, &stdout, &stderr)
+	if code != 1 {
+		t.Fatalf("expected exit code 1 for a failed statement but got %d", code)
+	}
+	if stdout.String() != "1\n\"marko\"\n" {
+		t.Fatalf("unexpected output %q", stdout.String())
+	}
+
+	summary := stderr.String()
+	for _, expected := range []string{"line 2:", "3 statements", "2 succeeded, 1 failed, 0 skipped", "597 ", "latency: p50"} {
+		if !strings.Contains(summary, expected) {
+			t.Fatalf("expected summary to contain %q but got:\n%s", expected, summary)
+		}
+	}
+
+	// Without -continue the remaining statements are skipped
+	stdout.Reset()
+	stderr.Reset()
+	code = run([]string{"run", "-addr", s.URL, "-quiet"}, strings.NewReader("g.V().bogus()\ng.V()\ng.V()\n"), &stdout, &stderr)
+	if code != 1 || !strings.Contains(stderr.String(), "0 succeeded, 1 failed, 2 skipped") {
+		t.Fatalf("expected remaining statements to be skipped but got exit code %d:\n%s", code, stderr.String())
+	}
+}
+
+func TestRunInFlight(t *testing.T) {
+	s := grmlntest.NewServer(grmlntest.NewScriptMux().
+		Handle("slow", grmlntest.Delay(time.Millisecond*200, grmlntest.Results([]int{1}))).
+		Handle("write", grmlntest.Delay(time.Millisecond*50, grmlntest.Results([]int{1}))).
+		Handle("bad", grmlntest.Error(grmln.StatusScriptEvaluationError, "bad")))
+	defer s.Close()
+
+	// A statement that runs out of time is reported as a timeout
+	var stdout, stderr bytes.Buffer
+	code := run([]string{"run", "-addr", s.URL, "-statement-timeout", "20ms"}, strings.NewReader("slow\n"), &stdout, &stderr)
+	if code != 1 || !strings.Contains(stderr.String(), "  timeout ") || strings.Contains(stderr.String(), "client error") {
+		t.Fatalf("expected a timeout but got exit code %d:\n%s", code, stderr.String())
+	}
+
+	// Statements already running when another fails finish and are counted, later ones are skipped
+	stderr.Reset()
+	code = run([]string{"run", "-addr", s.URL, "-pool", "2", "-concurrency", "2", "-quiet"}, strings.NewReader("write\nbad\nslow\nslow\n"), &stdout, &stderr)
+	if code != 1 || !strings.Contains(stderr.String(), "1 succeeded, 1 failed, 2 skipped") {
+		t.Fatalf("expected the running statement to succeed but got exit code %d:\n%s", code, stderr.String())
+	}
+}
+
+func TestRunProfile(t *testing.T) {
+	s := grmlntest.NewServer(grmlntest.NewGraph().Handler())
+	defer s.Close()
+
+	config := filepath.Join(t.TempDir(), "profiles.json")
+	err := os.WriteFile(config, []byte(`{"profiles": {"test": {"addrs": ["`+s.URL+`"], "mime": "graphson3", "batch": 1}}}`), 0600)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	code := run([]string{"run", "-config", config, "-profile", "test", "-quiet"}, strings.NewReader("g.inject(1, 2)\n"), &stdout, &stderr)
+	if code != 0 {
+		t.Fatalf("expected exit code 0 but got %d: %s", code, stderr.String())
+	}
+
+	// Flags override the profile
+	code = run([]string{"run", "-config", config, "-profile", "test", "-addr", "ws://127.0.0.1:1/gremlin", "-single"}, strings.NewReader("g.V()\n"), &stdout, &stderr)
+	if code == 0 {
+		t.Fatal("expected the -addr flag to override the profile")
+	}
+
+	dsn := "gremlin+" + s.URL + "?batch=1&mime=graphson2"
+	if code := run([]string{"run", "-dsn", dsn, "-quiet"}, strings.NewReader("g.inject(1, 2)\n"), &stdout, &stderr); code != 0 {
+		t.Fatalf("expected exit code 0 but got %d: %s", code, stderr.String())
+	}
+
+	// A profile without a timeout uses the same default as the flag
+	var timeouts []time.Duration
+	for _, args := range [][]string{nil, {"-dsn", dsn}} {
+		var f connFlags
+		fs := flag.NewFlagSet("run", flag.ContinueOnError)
+		f.register(fs)
+		if err := fs.Parse(args); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		_, _, op, err := f.settings()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		timeouts = append(timeouts, op.DefaultScriptEvaluationTimeout)
+	}
+	if timeouts[0] != timeouts[1] {
+		t.Fatalf("expected the same default timeout with and without a profile but got %v", timeouts)
+	}
+
+	stderr.Reset()
+	code = run([]string{"run", "-config", config, "-profile", "prod"}, strings.NewReader("g.V()\n"), &stdout, &stderr)
+	if code == 0 || !strings.Contains(stderr.String(), `profile "prod" not found`) {
+		t.Fatalf("expected missing profile error but got exit code %d: %s", code, stderr.String())
+	}
+}
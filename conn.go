@@ -6,15 +6,27 @@ import (
 	"encoding/json"
 	"net/http"
 	"sync"
+	"time"
 
 	"github.com/gorilla/websocket"
 )
 
+// closeFrameTimeout is how long we wait to write a close frame when the context has no deadline
+const closeFrameTimeout = time.Second
+
 // OnResponse callback when a partial or complete response is received
 type OnResponse func(resp *Response)
 
 var noopOnResponse = func(resp *Response) {}
 
+// withOnResponse returns a new slice of callbacks ending with or. Appending to onResponse directly
+// could write into the spare capacity of the caller's slice
+func withOnResponse(onResponse []OnResponse, or OnResponse) []OnResponse {
+	ors := make([]OnResponse, len(onResponse), len(onResponse)+1)
+	copy(ors, onResponse)
+	return append(ors, or)
+}
+
 // Conn is a gremlin server connection
 type Conn struct {
 	mimeType string
@@ -28,6 +40,12 @@ type Conn struct {
 	requestMutex sync.Mutex
 
 	sendBufferPool *sendBufferPool
+
+	// pool is the cluster pool the connection belongs to, if any
+	pool *connPool
+
+	metrics Metrics
+	logger  Logger
 }
 
 // SASL calculates sasl authentication args
@@ -61,20 +79,111 @@ func Dial(ctx context.Context, addr, mimeType, userName, password string, header
 		authArgs:       SASL(userName, password),
 		ws:             ws,
 		sendBufferPool: newSendBufferPool(mimeType),
+		metrics:        noopMetrics{},
+		logger:         noopLogger{},
 	}, nil
 }
 
+// SetMetrics sets the metrics collector for the connection
+func (c *Conn) SetMetrics(m Metrics) {
+	c.requestMutex.Lock()
+	defer c.requestMutex.Unlock()
+
+	c.metrics = m
+}
+
 // ProcessRequest can process a raw gremlin request
 func (c *Conn) ProcessRequest(ctx context.Context, r Request, onResponse ...OnResponse) error {
 	c.requestMutex.Lock()
 	defer c.requestMutex.Unlock()
 
+	setRequestHost(ctx, c.addr)
+
+	return c.roundTrip(ctx, r, onResponse...)
+}
+
+// SetLogger sets the logger for the connection
+func (c *Conn) SetLogger(l Logger) {
+	c.requestMutex.Lock()
+	defer c.requestMutex.Unlock()
+
+	c.logger = l
+}
+
+// roundTrip sends r, reads its response, and reports metrics about the request
+func (c *Conn) roundTrip(ctx context.Context, r Request, onResponse ...OnResponse) error {
+	start := time.Now()
+	frames := 0
+	var status StatusCode
+
+	// Clear deadlines left by an earlier request; they are only set below when ctx has one
+	c.ws.SetReadDeadline(time.Time{})
+	c.ws.SetWriteDeadline(time.Time{})
+
+	// Reads and writes only honour deadlines, so cancelling ctx expires them. The connection's
+	// response stream is then out of step so it is discarded when the request returns the error
+	defer c.expireOnDone(ctx)()
+
 	err := c.sendRequest(ctx, r)
-	if err != nil {
-		return err
+	if err == nil {
+		err = c.readResponse(ctx, withOnResponse(onResponse, func(resp *Response) {
+			frames++
+			status = resp.Status.Code
+		})...)
 	}
 
-	return c.readResponse(ctx, onResponse...)
+	if re, ok := err.(responseError); ok {
+		status = re.response.Status.Code
+	} else if err != nil {
+		status = 0
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+	}
+
+	c.metrics.RequestCompleted(c.addr, r.Operation, status, time.Since(start))
+	c.metrics.ResponseFrames(r.Operation, frames)
+
+	return err
+}
+
+// expireOnDone expires the connection's deadlines when ctx is done. The returned func stops watching ctx
+// and must be called before the connection is used again
+func (c *Conn) expireOnDone(ctx context.Context) func() {
+	if ctx.Done() == nil {
+		return func() {}
+	}
+
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		select {
+		case <-ctx.Done():
+			now := time.Now()
+			c.ws.SetReadDeadline(now)
+			c.ws.SetWriteDeadline(now)
+		case <-stop:
+		}
+	}()
+
+	return func() {
+		close(stop)
+		<-stopped
+	}
+}
+
+// sendError is an error writing a request. A request that failed to send was never processed by the server
+type sendError struct {
+	err error
+}
+
+func (e sendError) Error() string {
+	return e.err.Error()
+}
+
+func (e sendError) Unwrap() error {
+	return e.err
 }
 
 func (c *Conn) sendRequest(ctx context.Context, r Request) error {
@@ -86,23 +195,40 @@ func (c *Conn) sendRequest(ctx context.Context, r Request) error {
 		return err
 	}
 
-	dl, ok := ctx.Deadline()
-	if ok {
+	if dl, ok := ctx.Deadline(); ok {
 		c.ws.SetWriteDeadline(dl)
 	}
+	// Setting the deadline undoes an expiry from a cancellation that came first
+	if err := ctx.Err(); err != nil {
+		return sendError{err}
+	}
 
-	return c.ws.WriteMessage(websocket.BinaryMessage, buf.Bytes())
+	err = c.ws.WriteMessage(websocket.BinaryMessage, buf.Bytes())
+	if err != nil {
+		return sendError{err}
+	}
+
+	c.metrics.BytesSent(c.addr, buf.Len())
+	return nil
 }
 
 func (c *Conn) readResponse(ctx context.Context, onResponse ...OnResponse) error {
-	dl, ok := ctx.Deadline()
-	if ok {
+	if dl, ok := ctx.Deadline(); ok {
 		c.ws.SetReadDeadline(dl)
 	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	for {
 		var resp Response
 
-		err := c.ws.ReadJSON(&resp)
+		_, data, err := c.ws.ReadMessage()
+		if err != nil {
+			return err
+		}
+		c.metrics.BytesReceived(c.addr, len(data))
+
+		err = json.Unmarshal(data, &resp)
 		if err != nil {
 			return err
 		}
@@ -112,7 +238,7 @@ func (c *Conn) readResponse(ctx context.Context, onResponse ...OnResponse) error
 				return err
 			}
 
-			return c.ProcessRequest(ctx, NewRequest(resp.RequestID, processorDefault, opAuthentication, c.authArgs), onResponse...)
+			return c.authenticate(ctx, resp.RequestID, onResponse...)
 		}
 
 		for _, or := range onResponse {
@@ -125,9 +251,51 @@ func (c *Conn) readResponse(ctx context.Context, onResponse ...OnResponse) error
 	}
 }
 
+// authenticate answers an authentication challenge. The response to the original request follows
+func (c *Conn) authenticate(ctx context.Context, requestID string, onResponse ...OnResponse) error {
+	start := time.Now()
+	reported := false
+	report := func(err error) {
+		if !reported {
+			reported = true
+			c.metrics.AuthRoundTrip(c.addr, time.Since(start), err)
+			if err != nil {
+				c.logger.Log(LogWarn, "authentication failed", "addr", c.addr, "request_id", requestID, "error", err)
+			} else {
+				c.logger.Log(LogDebug, "authenticated", "addr", c.addr, "request_id", requestID, "duration", time.Since(start))
+			}
+		}
+	}
+
+	err := c.sendRequest(ctx, NewRequest(requestID, processorDefault, opAuthentication, c.authArgs))
+	if err == nil {
+		err = c.readResponse(ctx, append([]OnResponse{func(*Response) { report(nil) }}, onResponse...)...)
+	}
+	report(err)
+
+	return err
+}
+
 // Close closes the connection (including the underlying websocket)
 func (c *Conn) Close() error {
 	c.requestMutex.Lock()
 	defer c.requestMutex.Unlock()
 	return c.ws.Close()
 }
+
+// Shutdown sends a websocket close frame and then closes the connection
+func (c *Conn) Shutdown(ctx context.Context) error {
+	c.requestMutex.Lock()
+	defer c.requestMutex.Unlock()
+
+	dl, ok := ctx.Deadline()
+	if !ok {
+		dl = time.Now().Add(closeFrameTimeout)
+	}
+
+	err := c.ws.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), dl)
+	if cerr := c.ws.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
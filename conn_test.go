@@ -0,0 +1,103 @@
+package grmln
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestWithOnResponse(t *testing.T) {
+	var calls []string
+	record := func(name string) OnResponse {
+		return func(*Response) { calls = append(calls, name) }
+	}
+
+	// Spare capacity in the caller's slice must not be shared between requests
+	onResponse := make([]OnResponse, 1, 4)
+	onResponse[0] = record("caller")
+
+	first := withOnResponse(onResponse, record("first"))
+	withOnResponse(onResponse, record("second"))
+
+	for _, or := range first {
+		or(nil)
+	}
+	if len(calls) != 2 || calls[0] != "caller" || calls[1] != "first" {
+		t.Fatalf("expected the caller's and first callbacks but got %v", calls)
+	}
+}
+
+// TestConnCancel ensures a context without a deadline interrupts a request whether it was cancelled before
+// or during the request, even when the cancellation expired the connection's deadlines before they were set
+func TestConnCancel(t *testing.T) {
+	// The server reads requests but never responds
+	upgrader := websocket.Upgrader{}
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer ws.Close()
+
+		for {
+			if _, _, err := ws.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+	defer s.Close()
+
+	r := NewRequest("", processorDefault, opEval, EvalArgs{Gremlin: "g.V()"})
+
+	tests := []struct {
+		name  string
+		run   func(c *Conn, ctx context.Context) error
+		delay time.Duration
+	}{
+		{"before", func(c *Conn, ctx context.Context) error { return c.roundTrip(ctx, r) }, 0},
+		{"during", func(c *Conn, ctx context.Context) error { return c.roundTrip(ctx, r) }, time.Millisecond * 50},
+		{"expired before send", func(c *Conn, ctx context.Context) error {
+			c.ws.SetWriteDeadline(time.Now())
+			return c.sendRequest(ctx, r)
+		}, 0},
+		{"expired before read", func(c *Conn, ctx context.Context) error {
+			c.ws.SetReadDeadline(time.Now())
+			return c.readResponse(ctx)
+		}, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c, err := Dial(context.Background(), "ws"+strings.TrimPrefix(s.URL, "http"), DefaultMimeType, "", "", http.Header{})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			defer c.Close()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			if test.delay == 0 {
+				cancel()
+			} else {
+				time.AfterFunc(test.delay, cancel)
+			}
+
+			done := make(chan error, 1)
+			go func() { done <- test.run(c, ctx) }()
+
+			select {
+			case err := <-done:
+				if !errors.Is(err, context.Canceled) {
+					t.Fatalf("expected context canceled but got %v", err)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("expected cancellation to interrupt the request")
+			}
+		})
+	}
+}
@@ -0,0 +1,20 @@
+package grmln
+
+type (
+	// OnEvent is called when a cluster event occurs
+	OnEvent func(e Event)
+)
+
+// Event is a cluster lifecycle event. Use a type switch to inspect it
+type Event interface {
+	isEvent()
+}
+
+// HostGaveUpEvent is emitted when the cluster stops trying to connect to a host
+type HostGaveUpEvent struct {
+	Addr     string
+	Err      error
+	Attempts int
+}
+
+func (HostGaveUpEvent) isEvent() {}
@@ -0,0 +1,201 @@
+package grmln
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Failover defaults
+const (
+	DefaultFailoverRecoveryPeriod = time.Second * 30
+	DefaultFailoverCheckInterval  = time.Second
+)
+
+// FailoverConfig configures a FailoverProcessor
+type FailoverConfig struct {
+	// RecoveryPeriod is how long a higher priority cluster must be continuously healthy before failing back to it. Defaults to 30s
+	RecoveryPeriod time.Duration
+
+	// CheckInterval is how often cluster health is checked in the background. Defaults to 1s
+	CheckInterval time.Duration
+
+	// OnEvent is called with a FailoverEvent whenever the active cluster changes
+	OnEvent OnEvent
+
+	// Clock is used for health check timers. Defaults to the system clock
+	Clock Clock
+
+	// Logger logs every failover. Defaults to no logging
+	Logger Logger
+}
+
+// FailoverEvent is emitted when a FailoverProcessor switches clusters. From and To are indexes into its clusters
+type FailoverEvent struct {
+	From int
+	To   int
+}
+
+func (FailoverEvent) isEvent() {}
+
+// failoverTarget is satisfied by *Cluster
+type failoverTarget interface {
+	RequestProcessor
+	Healthy() bool
+}
+
+// FailoverProcessor sends every request to the highest priority healthy cluster. It fails
+// over when the active cluster has no healthy hosts and fails back once a higher priority
+// cluster has been healthy for the recovery period. A cluster that has never been unhealthy,
+// such as one still connecting at startup, is failed back to as soon as it's healthy.
+type FailoverProcessor struct {
+	targets []failoverTarget
+	config  FailoverConfig
+
+	// active is the index of the active cluster. It's maintained by the monitor so requests don't check health
+	active int32
+
+	mu           sync.Mutex
+	healthySince []time.Time
+	// failed records the clusters that have lost their health after being healthy
+	failed []bool
+
+	closing   chan struct{}
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+// NewFailoverProcessor creates a failover processor over clusters in priority order
+func NewFailoverProcessor(config FailoverConfig, clusters ...*Cluster) *FailoverProcessor {
+	targets := make([]failoverTarget, len(clusters))
+	for i, c := range clusters {
+		targets[i] = c
+	}
+
+	return newFailoverProcessor(config, targets)
+}
+
+func newFailoverProcessor(config FailoverConfig, targets []failoverTarget) *FailoverProcessor {
+	if len(targets) == 0 {
+		panic("grmln: NewFailoverProcessor requires at least one cluster")
+	}
+
+	if config.RecoveryPeriod == 0 {
+		config.RecoveryPeriod = DefaultFailoverRecoveryPeriod
+	}
+
+	if config.CheckInterval == 0 {
+		config.CheckInterval = DefaultFailoverCheckInterval
+	}
+
+	if config.OnEvent == nil {
+		config.OnEvent = func(e Event) {}
+	}
+
+	if config.Clock == nil {
+		config.Clock = realClock{}
+	}
+
+	if config.Logger != nil {
+		logger, onEvent := config.Logger, config.OnEvent
+		config.OnEvent = func(e Event) {
+			logEvent(logger, e)
+			onEvent(e)
+		}
+	}
+
+	p := &FailoverProcessor{
+		targets:      targets,
+		config:       config,
+		healthySince: make([]time.Time, len(targets)),
+		failed:       make([]bool, len(targets)),
+		closing:      make(chan struct{}),
+		done:         make(chan struct{}),
+	}
+
+	go p.monitor()
+
+	return p
+}
+
+func (p *FailoverProcessor) monitor() {
+	defer close(p.done)
+
+	for {
+		p.check()
+
+		select {
+		case <-p.closing:
+			return
+		case <-p.config.Clock.After(p.config.CheckInterval):
+		}
+	}
+}
+
+// check updates the health of every cluster and returns the index of the active cluster
+func (p *FailoverProcessor) check() int {
+	p.mu.Lock()
+
+	now := p.config.Clock.Now()
+	healthy := make([]bool, len(p.targets))
+	for i, t := range p.targets {
+		healthy[i] = t.Healthy()
+		if !healthy[i] {
+			if !p.healthySince[i].IsZero() {
+				p.failed[i] = true
+			}
+			p.healthySince[i] = time.Time{}
+		} else if p.healthySince[i].IsZero() {
+			p.healthySince[i] = now
+		}
+	}
+
+	from := int(atomic.LoadInt32(&p.active))
+	to := from
+	if !healthy[from] {
+		// Fail over to the highest priority healthy cluster, if there is one
+		for i := range p.targets {
+			if healthy[i] {
+				to = i
+				break
+			}
+		}
+	} else {
+		// Fail back once a higher priority cluster has been stable for long enough
+		for i := 0; i < from; i++ {
+			if healthy[i] && (!p.failed[i] || now.Sub(p.healthySince[i]) >= p.config.RecoveryPeriod) {
+				to = i
+				break
+			}
+		}
+	}
+
+	atomic.StoreInt32(&p.active, int32(to))
+	p.mu.Unlock()
+
+	if to != from {
+		p.config.OnEvent(FailoverEvent{From: from, To: to})
+	}
+
+	return to
+}
+
+// Active returns the index of the cluster currently receiving requests
+func (p *FailoverProcessor) Active() int {
+	return int(atomic.LoadInt32(&p.active))
+}
+
+// ProcessRequest sends the request to the active cluster
+func (p *FailoverProcessor) ProcessRequest(ctx context.Context, r Request, onResponse ...OnResponse) error {
+	return p.targets[p.Active()].ProcessRequest(ctx, r, onResponse...)
+}
+
+// Close stops the background health checks. The clusters are not closed
+func (p *FailoverProcessor) Close() error {
+	p.closeOnce.Do(func() {
+		close(p.closing)
+	})
+	<-p.done
+	return nil
+}
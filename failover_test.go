@@ -0,0 +1,133 @@
+package grmln
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeTarget struct {
+	mu       sync.Mutex
+	healthy  bool
+	requests int
+}
+
+func (t *fakeTarget) ProcessRequest(ctx context.Context, r Request, onResponse ...OnResponse) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.requests++
+	return nil
+}
+
+func (t *fakeTarget) Healthy() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.healthy
+}
+
+func (t *fakeTarget) setHealthy(healthy bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.healthy = healthy
+}
+
+func TestFailover(t *testing.T) {
+	primary, secondary := &fakeTarget{healthy: true}, &fakeTarget{healthy: true}
+	// Checks only happen when the test runs them
+	clock := newFakeClock()
+	clock.block = true
+
+	var mu sync.Mutex
+	var events []FailoverEvent
+
+	p := newFailoverProcessor(FailoverConfig{
+		RecoveryPeriod: time.Minute,
+		CheckInterval:  time.Hour,
+		Clock:          clock,
+		OnEvent: func(e Event) {
+			mu.Lock()
+			defer mu.Unlock()
+			events = append(events, e.(FailoverEvent))
+		},
+	}, []failoverTarget{primary, secondary})
+	defer p.Close()
+
+	ctx := context.Background()
+
+	// Health checks run in the monitor. Calling check stands in for its timer firing
+	p.check()
+	p.ProcessRequest(ctx, Request{})
+	if primary.requests != 1 {
+		t.Fatal("expected request to be sent to primary")
+	}
+
+	primary.setHealthy(false)
+	p.ProcessRequest(ctx, Request{})
+	if primary.requests != 2 {
+		t.Fatal("expected requests to go to the active cluster until the next health check")
+	}
+
+	p.check()
+	p.ProcessRequest(ctx, Request{})
+	if secondary.requests != 1 || p.Active() != 1 {
+		t.Fatal("expected failover to secondary")
+	}
+
+	primary.setHealthy(true)
+	p.check()
+	p.ProcessRequest(ctx, Request{})
+	if p.Active() != 1 {
+		t.Fatal("expected to stay on secondary until primary has recovered")
+	}
+
+	clock.advance(time.Minute)
+	p.check()
+	p.ProcessRequest(ctx, Request{})
+	if p.Active() != 0 || primary.requests != 3 {
+		t.Fatal("expected failback to primary")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	expected := []FailoverEvent{{From: 0, To: 1}, {From: 1, To: 0}}
+	if len(events) != len(expected) || events[0] != expected[0] || events[1] != expected[1] {
+		t.Fatalf("expected %v but got %v", expected, events)
+	}
+}
+
+// TestFailoverStartup ensures a primary that is still connecting at startup is used as soon as it's healthy
+func TestFailoverStartup(t *testing.T) {
+	primary, secondary := &fakeTarget{}, &fakeTarget{healthy: true}
+	// Checks only happen when the test runs them
+	clock := newFakeClock()
+	clock.block = true
+
+	p := newFailoverProcessor(FailoverConfig{
+		RecoveryPeriod: time.Minute,
+		CheckInterval:  time.Hour,
+		Clock:          clock,
+	}, []failoverTarget{primary, secondary})
+	defer p.Close()
+
+	p.check()
+	if p.Active() != 1 {
+		t.Fatal("expected secondary while primary is connecting")
+	}
+
+	primary.setHealthy(true)
+	p.check()
+	if p.Active() != 0 {
+		t.Fatal("expected primary as soon as it's healthy for the first time")
+	}
+}
+
+func TestFailoverNoClusters(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected panic")
+		}
+	}()
+	NewFailoverProcessor(FailoverConfig{})
+}
@@ -1,6 +1,9 @@
 module github.com/evandigby/grmln
 
+go 1.27
+
 require (
 	github.com/google/uuid v1.0.0
 	github.com/gorilla/websocket v1.4.0
+	gopkg.in/yaml.v3 v3.0.1
 )
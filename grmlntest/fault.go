@@ -0,0 +1,224 @@
+package grmlntest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/evandigby/grmln"
+)
+
+// ErrInjectedDrop is returned by a FaultInjector processor when it simulates a dropped connection
+var ErrInjectedDrop = errors.New("grmlntest: injected connection drop")
+
+// malformedFrame is sent in place of a real frame to simulate a corrupt response
+var malformedFrame = []byte(`{"requestId":`)
+
+// Fault is a kind of injected failure
+type Fault int
+
+// Faults
+const (
+	// FaultLatency delays the request by Latency
+	FaultLatency Fault = iota
+	// FaultDrop drops the connection after AfterFrames frames. Wrap can't reach a connection so it
+	// only simulates the drop: the rest of the response is read and discarded, ErrInjectedDrop is
+	// returned and the connection stays open. Use Handler to drop real connections
+	FaultDrop
+	// FaultStatus responds with an error Status after AfterFrames frames
+	FaultStatus
+	// FaultTruncate stops responding after AfterFrames frames, without a final frame
+	FaultTruncate
+	// FaultMalformed replaces frame AfterFrames+1 with invalid JSON
+	FaultMalformed
+)
+
+// FaultRule injects a fault into matching requests
+type FaultRule struct {
+	// Fault is the kind of fault to inject
+	Fault Fault
+
+	// Match limits the rule to matching requests. nil matches every request
+	Match func(r *Request) bool
+
+	// Probability (0-1] is the chance the fault is injected into a matching request. 0 injects into every match
+	Probability float64
+
+	// Every, when set, injects the fault into every nth matching request instead of randomly
+	Every int
+
+	// Latency is the delay for FaultLatency
+	Latency time.Duration
+
+	// Status and Message are the error response for FaultStatus. Status defaults to StatusServerError
+	Status  grmln.StatusCode
+	Message string
+
+	// AfterFrames is the number of frames passed through before a drop, status, truncate or malformed fault.
+	// A response with no more than AfterFrames frames is passed through as is and the fault isn't injected
+	AfterFrames int
+}
+
+// FaultInjector injects faults into requests, either by wrapping a RequestProcessor or a server Handler.
+// Rules are checked in order and the first that applies is injected.
+type FaultInjector struct {
+	rules []FaultRule
+
+	mu      sync.Mutex
+	rand    *rand.Rand
+	matches []int
+}
+
+// NewFaultInjector creates a fault injector. seed makes probabilistic faults reproducible
+func NewFaultInjector(seed int64, rules ...FaultRule) *FaultInjector {
+	return &FaultInjector{
+		rules:   rules,
+		rand:    rand.New(rand.NewSource(seed)),
+		matches: make([]int, len(rules)),
+	}
+}
+
+// pick returns the fault to inject into r, if any
+func (f *FaultInjector) pick(r *Request) (FaultRule, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for i, rule := range f.rules {
+		if rule.Match != nil && !rule.Match(r) {
+			continue
+		}
+
+		f.matches[i]++
+
+		switch {
+		case rule.Every > 0:
+			if f.matches[i]%rule.Every != 0 {
+				continue
+			}
+		case rule.Probability > 0:
+			if f.rand.Float64() >= rule.Probability {
+				continue
+			}
+		}
+
+		if rule.Status == 0 {
+			rule.Status = grmln.StatusServerError
+		}
+		return rule, true
+	}
+
+	return FaultRule{}, false
+}
+
+// Wrap returns a RequestProcessor that injects faults into requests sent to p. Faults are simulated
+// on top of the real response, which is always read in full, so the connection is never affected
+func (f *FaultInjector) Wrap(p grmln.RequestProcessor) grmln.RequestProcessor {
+	return grmln.RequestProcessorFunc(func(ctx context.Context, r grmln.Request, onResponse ...grmln.OnResponse) error {
+		req, err := toRequest(r)
+		if err != nil {
+			return err
+		}
+
+		rule, ok := f.pick(&req)
+		if !ok {
+			return p.ProcessRequest(ctx, r, onResponse...)
+		}
+
+		if rule.Fault == FaultLatency {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(rule.Latency):
+			}
+			return p.ProcessRequest(ctx, r, onResponse...)
+		}
+
+		// Pass through the first frames, then fail the way the rule says
+		frames := 0
+		err = p.ProcessRequest(ctx, r, func(resp *grmln.Response) {
+			frames++
+			if frames > rule.AfterFrames {
+				return
+			}
+			for _, or := range onResponse {
+				or(resp)
+			}
+		})
+		if frames <= rule.AfterFrames {
+			// The response ended, or the real request failed, before the fault would have been injected
+			return err
+		}
+
+		switch rule.Fault {
+		case FaultDrop:
+			return ErrInjectedDrop
+		case FaultStatus:
+			return grmln.Response{
+				RequestID: r.RequestID,
+				Status:    grmln.ResponseStatus{Code: rule.Status, Message: rule.Message},
+			}.Err()
+		case FaultMalformed:
+			var resp grmln.Response
+			return json.Unmarshal(malformedFrame, &resp)
+		}
+
+		// FaultTruncate: the stream just stops
+		return nil
+	})
+}
+
+// Handler returns a server Handler that injects faults into responses written by h
+func (f *FaultInjector) Handler(h Handler) Handler {
+	return HandlerFunc(func(w *ResponseWriter, r *Request) {
+		rule, ok := f.pick(r)
+		if !ok {
+			h.ServeGremlin(w, r)
+			return
+		}
+
+		if rule.Fault == FaultLatency {
+			time.Sleep(rule.Latency)
+			h.ServeGremlin(w, r)
+			return
+		}
+
+		if rule.AfterFrames == 0 {
+			injectFault(w, rule)
+			return
+		}
+
+		swallow := func(*ResponseWriter, []byte) ([]byte, bool) { return nil, false }
+		w.filter = func(w *ResponseWriter, data []byte) ([]byte, bool) {
+			if w.frames < rule.AfterFrames {
+				return data, true
+			}
+
+			if rule.Fault == FaultMalformed {
+				w.filter = swallow
+				return malformedFrame, true
+			}
+
+			w.filter = nil
+			injectFault(w, rule)
+			w.filter = swallow
+			return nil, false
+		}
+
+		h.ServeGremlin(w, r)
+	})
+}
+
+func injectFault(w *ResponseWriter, rule FaultRule) {
+	switch rule.Fault {
+	case FaultDrop:
+		w.Drop()
+	case FaultStatus:
+		w.Error(rule.Status, rule.Message)
+	case FaultMalformed:
+		w.WriteFrame(malformedFrame)
+	}
+	// FaultTruncate: write nothing
+}
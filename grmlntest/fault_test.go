@@ -0,0 +1,130 @@
+package grmlntest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/evandigby/grmln"
+)
+
+func TestFaultInjectorProcessor(t *testing.T) {
+	s := NewServer(Results([]int{1}, []int{2}, []int{3}))
+	defer s.Close()
+
+	c := dial(t, s, "", "")
+	defer c.Close()
+
+	f := NewFaultInjector(1,
+		FaultRule{
+			Fault:       FaultDrop,
+			Match:       func(r *Request) bool { return r.Gremlin() == "drop" },
+			AfterFrames: 1,
+		},
+		FaultRule{
+			Fault:  FaultStatus,
+			Every:  2,
+			Status: grmln.StatusServerTimeout,
+		},
+	)
+	op := grmln.NewOperator(f.Wrap(c))
+	ctx := context.Background()
+
+	var data []int
+	if err := op.EvalDefault(ctx, "drop", nil, collect(t, &data)); err != ErrInjectedDrop {
+		t.Fatalf("expected injected drop but got %v", err)
+	}
+	if len(data) != 1 {
+		t.Fatalf("expected 1 frame before the drop but got %v", data)
+	}
+
+	if err := op.EvalDefault(ctx, "g.V()", nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := op.EvalDefault(ctx, "g.V()", nil); !grmln.IsServerTimeout(err) {
+		t.Fatalf("expected injected server timeout but got %v", err)
+	}
+}
+
+// TestFaultInjectorShortResponse ensures faults are only injected into responses long enough to reach them
+func TestFaultInjectorShortResponse(t *testing.T) {
+	s := NewServer(Results([]int{1}, []int{2}))
+	defer s.Close()
+
+	c := dial(t, s, "", "")
+	defer c.Close()
+
+	tests := []struct {
+		name        string
+		fault       Fault
+		afterFrames int
+		injected    bool
+	}{
+		{"drop", FaultDrop, 2, false},
+		{"status", FaultStatus, 2, false},
+		{"truncate", FaultTruncate, 2, false},
+		{"malformed", FaultMalformed, 2, false},
+		{"drop longer than response", FaultDrop, 5, false},
+		{"drop before last frame", FaultDrop, 1, true},
+		{"status before last frame", FaultStatus, 1, true},
+		{"truncate before last frame", FaultTruncate, 1, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f := NewFaultInjector(1, FaultRule{Fault: test.fault, AfterFrames: test.afterFrames})
+
+			var data []int
+			err := grmln.NewOperator(f.Wrap(c)).EvalDefault(context.Background(), "g.V()", nil, collect(t, &data))
+
+			expected := 2
+			if test.injected {
+				expected = test.afterFrames
+			}
+			if len(data) != expected {
+				t.Fatalf("expected %d frames but got %v", expected, data)
+			}
+
+			switch {
+			case test.injected && test.fault != FaultTruncate && err == nil:
+				t.Fatal("expected the fault to be injected")
+			case !test.injected && err != nil:
+				t.Fatalf("expected the real response but got %v", err)
+			}
+		})
+	}
+}
+
+func TestFaultInjectorHandler(t *testing.T) {
+	f := NewFaultInjector(1, FaultRule{
+		Fault:       FaultDrop,
+		Every:       2,
+		AfterFrames: 2,
+	})
+
+	s := NewServer(f.Handler(Results([]int{1}, []int{2}, []int{3})))
+	defer s.Close()
+
+	c := grmln.NewCluster(grmln.ClusterConfig{BackoffBase: time.Millisecond, BackoffMax: time.Millisecond}, s.URL)
+	defer c.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	op := grmln.NewOperator(c)
+	for i := 1; i <= 4; i++ {
+		var data []int
+		err := op.EvalDefault(ctx, "g.V()", nil, collect(t, &data))
+
+		if i%2 == 0 {
+			if err == nil || len(data) != 2 {
+				t.Fatalf("request %d: expected a drop after 2 frames but got %v with %v", i, err, data)
+			}
+			continue
+		}
+
+		if err != nil || len(data) != 3 {
+			t.Fatalf("request %d: expected 3 results after reconnecting but got %v with %v", i, err, data)
+		}
+	}
+}
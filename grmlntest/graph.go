@@ -0,0 +1,336 @@
+package grmlntest
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/evandigby/grmln"
+)
+
+// defaultGraphBatchSize is the batch size used when a request doesn't set one, matching Gremlin Server
+const defaultGraphBatchSize = 64
+
+// Vertex is a vertex in an in-memory Graph
+type Vertex struct {
+	ID         int64
+	Label      string
+	Properties map[string][]*VertexProperty
+
+	// keys keeps property keys in insertion order
+	keys []string
+	out  []*Edge
+	in   []*Edge
+}
+
+// VertexProperty is a single value of a vertex property. Vertices can have many values per key
+type VertexProperty struct {
+	ID    int64
+	Key   string
+	Value interface{}
+}
+
+// Edge is an edge in an in-memory Graph
+type Edge struct {
+	ID         int64
+	Label      string
+	OutV       *Vertex
+	InV        *Vertex
+	Properties map[string]interface{}
+
+	// keys keeps property keys in insertion order
+	keys []string
+}
+
+// Graph is an in-memory property graph that evaluates a practical subset of Gremlin.
+// Scripts are single traversals (or several separated by semicolons) built from steps such as
+// V, E, has, out, in, both, addV, addE, property, values, valueMap, count, limit, order and drop.
+// Traversal bytecode is also supported.
+type Graph struct {
+	mu       sync.Mutex
+	nextID   int64
+	vertices []*Vertex
+	edges    []*Edge
+}
+
+// NewGraph creates an empty graph
+func NewGraph() *Graph {
+	return &Graph{
+		nextID: 1,
+	}
+}
+
+func (g *Graph) newID() int64 {
+	id := g.nextID
+	g.nextID++
+	return id
+}
+
+// Eval evaluates a gremlin script against the graph and returns the results as Go values
+// (*Vertex, *Edge, maps, slices, and primitives)
+func (g *Graph) Eval(gremlin string, bindings map[string]interface{}) ([]interface{}, error) {
+	t, err := parseScript(gremlin, bindings)
+	if err != nil {
+		return nil, err
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return g.evaluateScript(t)
+}
+
+// Processor returns a RequestProcessor that evaluates requests against the graph and
+// responds in the GraphSON version of mimeType
+func (g *Graph) Processor(mimeType string) grmln.RequestProcessor {
+	return grmln.RequestProcessorFunc(func(ctx context.Context, r grmln.Request, onResponse ...grmln.OnResponse) error {
+		req, err := toRequest(r)
+		if err != nil {
+			return err
+		}
+		req.MimeType = mimeType
+
+		for _, resp := range g.respond(req) {
+			if err := resp.Err(); err != nil {
+				return err
+			}
+			for _, or := range onResponse {
+				resp := resp
+				or(&resp)
+			}
+		}
+		return nil
+	})
+}
+
+// Handler returns a server Handler that evaluates requests against the graph and
+// responds in the GraphSON version of each request's mime type
+func (g *Graph) Handler() Handler {
+	return HandlerFunc(func(w *ResponseWriter, r *Request) {
+		for _, resp := range g.respond(*r) {
+			if w.WriteResponse(resp) != nil {
+				return
+			}
+		}
+	})
+}
+
+// respond evaluates req and returns every response frame
+func (g *Graph) respond(req Request) []grmln.Response {
+	errorResponse := func(code grmln.StatusCode, err error) []grmln.Response {
+		return []grmln.Response{{
+			RequestID: req.RequestID,
+			Status: grmln.ResponseStatus{
+				Code:       code,
+				Message:    err.Error(),
+				Attributes: map[string]interface{}{},
+			},
+		}}
+	}
+
+	var t *script
+	var err error
+
+	switch req.Operation {
+	case "eval":
+		t, err = parseScript(req.Gremlin(), normalizeBindings(req.Bindings()))
+	case "bytecode":
+		t, err = parseBytecode(req.Arguments["gremlin"])
+	case "close", "authentication":
+		return []grmln.Response{{RequestID: req.RequestID, Status: grmln.ResponseStatus{Code: grmln.StatusNoContent}}}
+	default:
+		return errorResponse(grmln.StatusMalformedRequest, fmt.Errorf("unsupported op %q", req.Operation))
+	}
+	if err != nil {
+		return errorResponse(grmln.StatusScriptEvaluationError, err)
+	}
+
+	g.mu.Lock()
+	results, err := g.evaluateScript(t)
+	var batches [][]byte
+	if err == nil {
+		batchSize := defaultGraphBatchSize
+		if size, ok := req.Arguments["batchSize"].(float64); ok && size > 0 {
+			batchSize = int(size)
+		}
+		// Serialize while locked so results reflect the graph at evaluation time
+		batches, err = serializeBatches(graphSONVersion(req.MimeType), results, batchSize)
+	}
+	g.mu.Unlock()
+
+	if err != nil {
+		return errorResponse(grmln.StatusScriptEvaluationError, err)
+	}
+
+	if len(batches) == 0 {
+		return []grmln.Response{{
+			RequestID: req.RequestID,
+			Status:    grmln.ResponseStatus{Code: grmln.StatusNoContent, Attributes: map[string]interface{}{}},
+			Result:    grmln.ResponseResult{Data: []byte("null"), Meta: map[string]interface{}{}},
+		}}
+	}
+
+	responses := make([]grmln.Response, len(batches))
+	for i, batch := range batches {
+		code := grmln.StatusPartialContent
+		if i == len(batches)-1 {
+			code = grmln.StatusSuccess
+		}
+
+		responses[i] = grmln.Response{
+			RequestID: req.RequestID,
+			Status:    grmln.ResponseStatus{Code: code, Attributes: map[string]interface{}{}},
+			Result:    grmln.ResponseResult{Data: batch, Meta: map[string]interface{}{}},
+		}
+	}
+	return responses
+}
+
+// setID gives an element a user supplied id, as property(T.id, id) does
+func (g *Graph) setID(element interface{}, value interface{}) error {
+	id, ok := value.(int64)
+	if !ok {
+		return fmt.Errorf("ids must be integers but got %v", value)
+	}
+
+	for _, v := range g.vertices {
+		if v.ID == id && v != element {
+			return fmt.Errorf("id %d is already in use", id)
+		}
+	}
+	for _, e := range g.edges {
+		if e.ID == id && e != element {
+			return fmt.Errorf("id %d is already in use", id)
+		}
+	}
+
+	switch e := element.(type) {
+	case *Vertex:
+		e.ID = id
+	case *Edge:
+		e.ID = id
+	default:
+		return fmt.Errorf("expected element but got %T", element)
+	}
+
+	if id >= g.nextID {
+		g.nextID = id + 1
+	}
+	return nil
+}
+
+func (g *Graph) addVertex(label string) *Vertex {
+	if label == "" {
+		label = "vertex"
+	}
+
+	v := &Vertex{
+		ID:         g.newID(),
+		Label:      label,
+		Properties: map[string][]*VertexProperty{},
+	}
+	g.vertices = append(g.vertices, v)
+	return v
+}
+
+func (g *Graph) addEdge(label string, out, in *Vertex) *Edge {
+	if label == "" {
+		label = "edge"
+	}
+
+	e := &Edge{
+		ID:         g.newID(),
+		Label:      label,
+		OutV:       out,
+		InV:        in,
+		Properties: map[string]interface{}{},
+	}
+	g.edges = append(g.edges, e)
+	out.out = append(out.out, e)
+	in.in = append(in.in, e)
+	return e
+}
+
+func (g *Graph) setVertexProperty(v *Vertex, cardinality, key string, value interface{}) {
+	if _, ok := v.Properties[key]; !ok {
+		v.keys = append(v.keys, key)
+	}
+
+	p := &VertexProperty{ID: g.newID(), Key: key, Value: value}
+	if cardinality == "list" {
+		v.Properties[key] = append(v.Properties[key], p)
+		return
+	}
+
+	if cardinality == "set" {
+		for _, existing := range v.Properties[key] {
+			if valuesEqual(existing.Value, value) {
+				return
+			}
+		}
+		v.Properties[key] = append(v.Properties[key], p)
+		return
+	}
+
+	v.Properties[key] = []*VertexProperty{p}
+}
+
+func (g *Graph) setEdgeProperty(e *Edge, key string, value interface{}) {
+	if _, ok := e.Properties[key]; !ok {
+		e.keys = append(e.keys, key)
+	}
+	e.Properties[key] = value
+}
+
+func (g *Graph) removeVertex(v *Vertex) {
+	for _, e := range append(append([]*Edge{}, v.out...), v.in...) {
+		g.removeEdge(e)
+	}
+
+	for i, existing := range g.vertices {
+		if existing == v {
+			g.vertices = append(g.vertices[:i], g.vertices[i+1:]...)
+			return
+		}
+	}
+}
+
+func (g *Graph) removeEdge(e *Edge) {
+	e.OutV.out = removeEdgeFrom(e.OutV.out, e)
+	e.InV.in = removeEdgeFrom(e.InV.in, e)
+	g.edges = removeEdgeFrom(g.edges, e)
+}
+
+func removeEdgeFrom(edges []*Edge, e *Edge) []*Edge {
+	for i, existing := range edges {
+		if existing == e {
+			return append(edges[:i], edges[i+1:]...)
+		}
+	}
+	return edges
+}
+
+// normalizeBindings converts integral JSON numbers to int64 so they behave like script literals
+func normalizeBindings(bindings map[string]interface{}) map[string]interface{} {
+	normalized := make(map[string]interface{}, len(bindings))
+	for k, v := range bindings {
+		normalized[k] = normalizeNumber(v)
+	}
+	return normalized
+}
+
+func normalizeNumber(v interface{}) interface{} {
+	switch n := v.(type) {
+	case float64:
+		if n == float64(int64(n)) {
+			return int64(n)
+		}
+	case []interface{}:
+		out := make([]interface{}, len(n))
+		for i, e := range n {
+			out[i] = normalizeNumber(e)
+		}
+		return out
+	}
+	return v
+}
@@ -0,0 +1,243 @@
+package grmlntest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/evandigby/grmln"
+)
+
+const modernGraph = `
+g.addV('person').property('name', 'marko').property('age', 29).as('marko').
+  addV('person').property('name', 'vadas').property('age', 27).as('vadas').
+  addV('software').property('name', 'lop').property('lang', 'java').as('lop').
+  addV('person').property('name', 'josh').property('age', 32).as('josh').
+  addE('knows').from('marko').to('vadas').property('weight', 0.5d).
+  addE('knows').from('marko').to('josh').property('weight', 1.0d).
+  addE('created').from('marko').to('lop').property('weight', 0.4d).
+  addE('created').from('josh').to('lop').property('weight', 0.4d)
+`
+
+func newModernGraph(t *testing.T) *Graph {
+	g := NewGraph()
+	if _, err := g.Eval(modernGraph, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return g
+}
+
+func TestGraphEval(t *testing.T) {
+	g := newModernGraph(t)
+
+	tests := []struct {
+		gremlin  string
+		bindings map[string]interface{}
+		expected string
+	}{
+		{"g.V().count()", nil, "[4]"},
+		{"g.E().hasLabel('knows').count()", nil, "[2]"},
+		{"g.V().has('person', 'name', 'marko').out('knows').values('name').order()", nil, `["josh","vadas"]`},
+		{"g.V().has('name', name).in().values('name')", map[string]interface{}{"name": "lop"}, `["marko","josh"]`},
+		{"g.V().has('age', gt(27)).order().by('age', desc).values('name')", nil, `["josh","marko"]`},
+		{"g.V().has('age', P.within(27, 32)).values('name').fold()", nil, `[["vadas","josh"]]`},
+		{"g.V().hasLabel('person').values('age').sum()", nil, "[88]"},
+		{"g.V().has('name', 'josh').outE('created').values('weight')", nil, "[0.4]"},
+		{"g.V().has('name', 'lop').both().dedup().count()", nil, "[2]"},
+		{"g.V().has('name', 'marko').valueMap('name')", nil, `[{"name":["marko"]}]`},
+		{"g.V().has('name', 'vadas').valueMap(true, 'age')", nil, `[{"age":[27],"id":4,"label":"person"}]`},
+		{"g.V().hasNot('age').label()", nil, `["software"]`},
+		{"g.V().order().by('name').limit(2).values('name')", nil, `["josh","lop"]`},
+		{"g.V().range(1, 3).id()", nil, "[4,7]"},
+		{"g.V().has('name', 'nobody')", nil, "[]"},
+		{"g.V().properties().key().dedup()", nil, `["name","age","lang"]`},
+		{"g.E().properties('weight').value().max()", nil, "[1]"},
+		{"[g.V().has('name', 'josh').count().next(), g.V().has('name', 'nobody').count().next()]", nil, "[1,0]"},
+		{"g.V().has('name', 'josh').fold().coalesce(__.unfold(), __.addV('person')).values('age')", nil, "[32]"},
+		{"g.V().has('name', 'marko').outE().where(__.inV().hasLabel('software')).label()", nil, `["created"]`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.gremlin, func(t *testing.T) {
+			results, err := g.Eval(test.gremlin, test.bindings)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			actual, err := json.Marshal(nonNil(results))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if string(actual) != test.expected {
+				t.Fatalf("expected %s but got %s", test.expected, actual)
+			}
+		})
+	}
+}
+
+func nonNil(results []interface{}) []interface{} {
+	if results == nil {
+		return []interface{}{}
+	}
+	return results
+}
+
+func TestGraphMutations(t *testing.T) {
+	g := newModernGraph(t)
+
+	steps := []string{
+		"g.V().has('name', 'marko').property(list, 'nick', 'm').property(list, 'nick', 'mk')",
+		"g.V().has('name', 'marko').property(set, 'nick', 'm')",
+		"g.V().has('name', 'marko').property('age', 30)",
+		"g.V().has('name', 'vadas').drop()",
+		"g.E().has('weight', lt(0.45)).drop()",
+		"g.addV('person').property(T.id, 100L).property('name', 'peter')",
+	}
+	for _, s := range steps {
+		if _, err := g.Eval(s, nil); err != nil {
+			t.Fatalf("%s: unexpected error: %v", s, err)
+		}
+	}
+
+	results, err := g.Eval("g.V().has('name', 'marko').values('nick', 'age')", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fmt.Sprint(results) != "[m mk 30]" {
+		t.Fatalf("unexpected properties %v", results)
+	}
+
+	if _, err := g.Eval("g.addV('person').property(T.id, 100L)", nil); err == nil {
+		t.Fatal("expected duplicate id error")
+	}
+
+	results, err = g.Eval("g.V(100).values('name')", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fmt.Sprint(results) != "[peter]" {
+		t.Fatalf("expected the vertex with the given id but got %v", results)
+	}
+
+	results, err = g.Eval("g.V().count(); g.E().count()", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fmt.Sprint(results) != "[1]" {
+		t.Fatalf("expected dropped vertex and edges to be removed but got %v edges", results)
+	}
+}
+
+func TestGraphErrors(t *testing.T) {
+	g := NewGraph()
+
+	for _, s := range []string{"g.V(", "g.V().bogus()", "out()", "g.V().has('name', missing)"} {
+		if _, err := g.Eval(s, nil); err == nil {
+			t.Fatalf("%s: expected error", s)
+		}
+	}
+}
+
+func TestGraphBytecode(t *testing.T) {
+	g := newModernGraph(t)
+
+	var bytecode map[string]interface{}
+	err := json.Unmarshal([]byte(`{
+		"@type": "g:Bytecode",
+		"@value": {
+			"step": [
+				["V"],
+				["has", "age", {"@type": "g:P", "@value": {"predicate": "gte", "value": {"@type": "g:Int32", "@value": 29}}}],
+				["order"],
+				["by", {"@type": "g:T", "@value": "id"}, {"@type": "g:Order", "@value": "desc"}],
+				["values", "name"]
+			]
+		}
+	}`), &bytecode)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	p := g.Processor("application/vnd.gremlin-v2.0+json")
+	r := grmln.NewRequest("", "traversal", "bytecode", map[string]interface{}{"gremlin": bytecode})
+
+	var names []string
+	err = p.ProcessRequest(context.Background(), r, func(resp *grmln.Response) {
+		var batch []string
+		if err := json.Unmarshal(resp.Result.Data, &batch); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		names = append(names, batch...)
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fmt.Sprint(names) != "[josh marko]" {
+		t.Fatalf("unexpected results %v", names)
+	}
+}
+
+func TestGraphGraphSON(t *testing.T) {
+	tests := []struct {
+		mimeType string
+		expected string
+	}{
+		{
+			grmln.DefaultMimeType,
+			`[{"id":1,"label":"person","properties":{"age":[{"id":3,"label":"age","value":29}],"name":[{"id":2,"label":"name","value":"marko"}]},"type":"vertex"}]`,
+		},
+		{
+			"application/vnd.gremlin-v2.0+json",
+			`[{"@type":"g:Vertex","@value":{"id":{"@type":"g:Int64","@value":1},"label":"person","properties":{"age":[{"@type":"g:VertexProperty","@value":{"id":{"@type":"g:Int64","@value":3},"label":"age","value":{"@type":"g:Int64","@value":29}}}],"name":[{"@type":"g:VertexProperty","@value":{"id":{"@type":"g:Int64","@value":2},"label":"name","value":"marko"}}]}}}]`,
+		},
+		{
+			"application/vnd.gremlin-v3.0+json",
+			`{"@type":"g:List","@value":[{"@type":"g:Vertex","@value":{"id":{"@type":"g:Int64","@value":1},"label":"person","properties":{"age":[{"@type":"g:VertexProperty","@value":{"id":{"@type":"g:Int64","@value":3},"label":"age","value":{"@type":"g:Int64","@value":29}}}],"name":[{"@type":"g:VertexProperty","@value":{"id":{"@type":"g:Int64","@value":2},"label":"name","value":"marko"}}]}}}]}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.mimeType, func(t *testing.T) {
+			g := NewGraph()
+			g.Eval("g.addV('person').property('name', 'marko').property('age', 29)", nil)
+
+			s := NewServer(g.Handler())
+			defer s.Close()
+
+			c, err := grmln.Dial(context.Background(), s.URL, test.mimeType, "", "", http.Header{})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			defer c.Close()
+
+			var data []string
+			err = grmln.NewOperator(c).EvalDefault(context.Background(), "g.V()", nil, func(resp *grmln.Response) {
+				data = append(data, string(resp.Result.Data))
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(data) != 1 || data[0] != test.expected {
+				t.Fatalf("expected %s but got %v", test.expected, data)
+			}
+		})
+	}
+}
+
+func TestGraphBatches(t *testing.T) {
+	g := NewGraph()
+	op := grmln.NewOperator(g.Processor(grmln.DefaultMimeType))
+
+	var frames, results []int
+	err := op.Eval(context.Background(), grmln.EvalArgs{Gremlin: "g.inject(1, 2, 3, 4, 5)", BatchSize: 2}, func(resp *grmln.Response) {
+		frames = append(frames, int(resp.Status.Code))
+	}, collect(t, &results))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fmt.Sprint(frames) != "[206 206 200]" || fmt.Sprint(results) != "[1 2 3 4 5]" {
+		t.Fatalf("unexpected frames %v with results %v", frames, results)
+	}
+}
@@ -0,0 +1,207 @@
+package grmlntest
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// graphSONVersion returns the GraphSON version for a mime type, defaulting to version 1
+func graphSONVersion(mimeType string) int {
+	switch {
+	case strings.Contains(mimeType, "v3.0"):
+		return 3
+	case strings.Contains(mimeType, "v2.0"):
+		return 2
+	}
+	return 1
+}
+
+// serializeBatches serializes results into batches of at most batchSize results each
+func serializeBatches(version int, results []interface{}, batchSize int) ([][]byte, error) {
+	var batches [][]byte
+	for start := 0; start < len(results); start += batchSize {
+		end := start + batchSize
+		if end > len(results) {
+			end = len(results)
+		}
+
+		batch := make([]interface{}, end-start)
+		for i, r := range results[start:end] {
+			v, err := toGraphSON(version, r)
+			if err != nil {
+				return nil, err
+			}
+			batch[i] = v
+		}
+
+		// GraphSON 3 types the result list like every other list
+		var data interface{} = batch
+		if version == 3 {
+			data = typed("g:List", batch)
+		}
+
+		b, err := json.Marshal(data)
+		if err != nil {
+			return nil, err
+		}
+		batches = append(batches, b)
+	}
+	return batches, nil
+}
+
+func typed(typ string, value interface{}) map[string]interface{} {
+	return map[string]interface{}{"@type": typ, "@value": value}
+}
+
+// toGraphSON converts a result into a value that marshals to the given GraphSON version
+func toGraphSON(version int, v interface{}) (interface{}, error) {
+	switch value := v.(type) {
+	case nil, string, bool:
+		return value, nil
+	case int64:
+		if version == 1 {
+			return value, nil
+		}
+		return typed("g:Int64", value), nil
+	case float64:
+		if version == 1 {
+			return value, nil
+		}
+		return typed("g:Double", value), nil
+	case []interface{}:
+		list := make([]interface{}, len(value))
+		for i, e := range value {
+			converted, err := toGraphSON(version, e)
+			if err != nil {
+				return nil, err
+			}
+			list[i] = converted
+		}
+		if version == 3 {
+			return typed("g:List", list), nil
+		}
+		return list, nil
+	case map[string]interface{}:
+		if version == 3 {
+			var flat []interface{}
+			for _, k := range sortedKeys(value) {
+				converted, err := toGraphSON(version, value[k])
+				if err != nil {
+					return nil, err
+				}
+				flat = append(flat, k, converted)
+			}
+			if flat == nil {
+				flat = []interface{}{}
+			}
+			return typed("g:Map", flat), nil
+		}
+
+		m := make(map[string]interface{}, len(value))
+		for k, e := range value {
+			converted, err := toGraphSON(version, e)
+			if err != nil {
+				return nil, err
+			}
+			m[k] = converted
+		}
+		return m, nil
+	case *Vertex:
+		return vertexGraphSON(version, value)
+	case *Edge:
+		return edgeGraphSON(version, value)
+	case *VertexProperty:
+		return vertexPropertyGraphSON(version, value)
+	case *edgeProperty:
+		converted, err := toGraphSON(version, value.Value)
+		if err != nil {
+			return nil, err
+		}
+		p := map[string]interface{}{"key": value.Key, "value": converted}
+		if version == 1 {
+			return p, nil
+		}
+		return typed("g:Property", p), nil
+	}
+
+	return nil, fmt.Errorf("can't serialize %T", v)
+}
+
+func vertexGraphSON(version int, v *Vertex) (interface{}, error) {
+	properties := map[string]interface{}{}
+	for _, key := range v.keys {
+		values := make([]interface{}, len(v.Properties[key]))
+		for i, p := range v.Properties[key] {
+			converted, err := vertexPropertyGraphSON(version, p)
+			if err != nil {
+				return nil, err
+			}
+			values[i] = converted
+		}
+		properties[key] = values
+	}
+
+	id, _ := toGraphSON(version, v.ID)
+	vertex := map[string]interface{}{
+		"id":         id,
+		"label":      v.Label,
+		"properties": properties,
+	}
+	if version == 1 {
+		vertex["type"] = "vertex"
+		return vertex, nil
+	}
+	return typed("g:Vertex", vertex), nil
+}
+
+func vertexPropertyGraphSON(version int, p *VertexProperty) (interface{}, error) {
+	value, err := toGraphSON(version, p.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	id, _ := toGraphSON(version, p.ID)
+	property := map[string]interface{}{
+		"id":    id,
+		"value": value,
+		"label": p.Key,
+	}
+	if version == 1 {
+		return property, nil
+	}
+	return typed("g:VertexProperty", property), nil
+}
+
+func edgeGraphSON(version int, e *Edge) (interface{}, error) {
+	properties := map[string]interface{}{}
+	for _, key := range e.keys {
+		value, err := toGraphSON(version, e.Properties[key])
+		if err != nil {
+			return nil, err
+		}
+		if version == 1 {
+			properties[key] = value
+			continue
+		}
+		properties[key] = typed("g:Property", map[string]interface{}{"key": key, "value": value})
+	}
+
+	id, _ := toGraphSON(version, e.ID)
+	inV, _ := toGraphSON(version, e.InV.ID)
+	outV, _ := toGraphSON(version, e.OutV.ID)
+	edge := map[string]interface{}{
+		"id":         id,
+		"label":      e.Label,
+		"inV":        inV,
+		"inVLabel":   e.InV.Label,
+		"outV":       outV,
+		"outVLabel":  e.OutV.Label,
+		"properties": properties,
+	}
+	if version == 1 {
+		edge["type"] = "edge"
+		return edge, nil
+	}
+	return typed("g:Edge", edge), nil
+}
@@ -0,0 +1,561 @@
+package grmlntest
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// script is one or more statements. The results of the last statement are returned.
+// Statements are traversals or lists of traversals and values, such as [g.V(1).next(), g.V(2).next()]
+type script struct {
+	statements []interface{}
+}
+
+// traversal is a sequence of steps
+type traversal struct {
+	steps []*step
+}
+
+// step is a single traversal step along with any modulators (by, from, to) that follow it
+type step struct {
+	name       string
+	args       []interface{}
+	modulators []*step
+}
+
+// token is an enum value such as T.id, Order.desc or Cardinality.list
+type token string
+
+// predicate is a P or TextP predicate such as gt(5) or within('a', 'b')
+type predicate struct {
+	op   string
+	args []interface{}
+}
+
+var modulatorSteps = map[string]bool{
+	"by":   true,
+	"from": true,
+	"to":   true,
+}
+
+// terminalSteps end a traversal in a script and don't change its results here
+var terminalSteps = map[string]bool{
+	"next":    true,
+	"toList":  true,
+	"toSet":   true,
+	"iterate": true,
+}
+
+var predicateNames = map[string]bool{
+	"eq": true, "neq": true, "gt": true, "gte": true, "lt": true, "lte": true,
+	"between": true, "inside": true, "outside": true, "within": true, "without": true,
+	"containing": true, "notContaining": true, "startingWith": true, "notStartingWith": true,
+	"endingWith": true, "notEndingWith": true,
+}
+
+var bareTokens = map[string]bool{
+	"id": true, "label": true, "key": true, "value": true,
+	"single": true, "list": true, "set": true,
+	"asc": true, "desc": true, "incr": true, "decr": true, "shuffle": true,
+}
+
+// enumClasses are the prefixes that introduce tokens and predicates, such as T.id or P.gt
+var enumClasses = map[string]bool{
+	"T": true, "P": true, "TextP": true, "Order": true, "Cardinality": true,
+	"VertexProperty": true, "Column": true, "Direction": true,
+}
+
+func (t *traversal) add(name string, args []interface{}) error {
+	if terminalSteps[name] {
+		return nil
+	}
+
+	s := &step{name: name, args: args}
+	if modulatorSteps[name] {
+		if len(t.steps) == 0 {
+			return fmt.Errorf("%s() must follow a step", name)
+		}
+		prev := t.steps[len(t.steps)-1]
+		prev.modulators = append(prev.modulators, s)
+		return nil
+	}
+
+	t.steps = append(t.steps, s)
+	return nil
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenString
+	tokenNumber
+	tokenPunct
+)
+
+type lexToken struct {
+	kind  tokenKind
+	text  string
+	value interface{}
+	pos   int
+}
+
+func lex(src string) ([]lexToken, error) {
+	var tokens []lexToken
+	runes := []rune(src)
+
+	last := func() lexToken {
+		if len(tokens) == 0 {
+			return lexToken{}
+		}
+		return tokens[len(tokens)-1]
+	}
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+
+		switch {
+		case r == '\n':
+			// A newline ends a statement unless the next line continues the chain with a dot
+			j := i + 1
+			for j < len(runes) && unicode.IsSpace(runes[j]) {
+				j++
+			}
+			if last().text == ")" && (j >= len(runes) || runes[j] != '.') {
+				tokens = append(tokens, lexToken{kind: tokenPunct, text: ";", pos: i})
+			}
+			i++
+		case unicode.IsSpace(r):
+			i++
+		case r == '/' && i+1 < len(runes) && runes[i+1] == '/':
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+		case r == '\'' || r == '"':
+			start := i
+			i++
+			var b strings.Builder
+			for ; i < len(runes) && runes[i] != r; i++ {
+				if runes[i] == '\\' && i+1 < len(runes) {
+					i++
+					switch runes[i] {
+					case 'n':
+						b.WriteRune('\n')
+					case 't':
+						b.WriteRune('\t')
+					default:
+						b.WriteRune(runes[i])
+					}
+					continue
+				}
+				b.WriteRune(runes[i])
+			}
+			if i >= len(runes) {
+				return nil, fmt.Errorf("unterminated string at %d", start)
+			}
+			i++
+			tokens = append(tokens, lexToken{kind: tokenString, value: b.String(), pos: start})
+		case unicode.IsDigit(r) || (r == '-' && i+1 < len(runes) && unicode.IsDigit(runes[i+1])):
+			start := i
+			i++
+			isFloat := false
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || (runes[i] == '.' && !isFloat && i+1 < len(runes) && unicode.IsDigit(runes[i+1]))) {
+				if runes[i] == '.' {
+					isFloat = true
+				}
+				i++
+			}
+			text := string(runes[start:i])
+			if i < len(runes) && strings.ContainsRune("lLdDfF", runes[i]) {
+				if strings.ContainsRune("dDfF", runes[i]) {
+					isFloat = true
+				}
+				i++
+			}
+
+			var value interface{}
+			var err error
+			if isFloat {
+				value, err = strconv.ParseFloat(text, 64)
+			} else {
+				value, err = strconv.ParseInt(text, 10, 64)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("invalid number %q at %d", text, start)
+			}
+			tokens = append(tokens, lexToken{kind: tokenNumber, value: value, pos: start})
+		case unicode.IsLetter(r) || r == '_' || r == '$':
+			start := i
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == '_' || runes[i] == '$') {
+				i++
+			}
+			tokens = append(tokens, lexToken{kind: tokenIdent, text: string(runes[start:i]), pos: start})
+		case strings.ContainsRune(".(),;[]", r):
+			tokens = append(tokens, lexToken{kind: tokenPunct, text: string(r), pos: i})
+			i++
+		default:
+			return nil, fmt.Errorf("unexpected character %q at %d", r, i)
+		}
+	}
+
+	return append(tokens, lexToken{kind: tokenEOF, pos: len(runes)}), nil
+}
+
+type parser struct {
+	tokens   []lexToken
+	pos      int
+	bindings map[string]interface{}
+}
+
+// parseScript parses a gremlin script into statements
+func parseScript(src string, bindings map[string]interface{}) (*script, error) {
+	tokens, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens, bindings: bindings}
+	s := &script{}
+
+	for {
+		for p.peek().text == ";" {
+			p.next()
+		}
+		if p.peek().kind == tokenEOF {
+			break
+		}
+
+		var statement interface{}
+		if p.peek().text == "[" {
+			p.next()
+			statement, err = p.parseArgs("]")
+		} else {
+			statement, err = p.parseTraversal()
+		}
+		if err != nil {
+			return nil, err
+		}
+		s.statements = append(s.statements, statement)
+
+		if tok := p.peek(); tok.kind != tokenEOF && tok.text != ";" {
+			return nil, p.unexpected(tok)
+		}
+	}
+
+	if len(s.statements) == 0 {
+		return nil, fmt.Errorf("empty script")
+	}
+	return s, nil
+}
+
+func (p *parser) peek() lexToken {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) peekAt(n int) lexToken {
+	if p.pos+n >= len(p.tokens) {
+		return p.tokens[len(p.tokens)-1]
+	}
+	return p.tokens[p.pos+n]
+}
+
+func (p *parser) next() lexToken {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokenEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *parser) expect(text string) error {
+	if tok := p.next(); tok.text != text {
+		return p.unexpected(tok)
+	}
+	return nil
+}
+
+func (p *parser) unexpected(tok lexToken) error {
+	if tok.kind == tokenEOF {
+		return fmt.Errorf("unexpected end of script")
+	}
+	text := tok.text
+	if text == "" {
+		text = fmt.Sprint(tok.value)
+	}
+	return fmt.Errorf("unexpected %q at %d", text, tok.pos)
+}
+
+// parseTraversal parses g.step()..., __.step()... or an anonymous step()...
+func (p *parser) parseTraversal() (*traversal, error) {
+	t := &traversal{}
+
+	tok := p.peek()
+	if tok.kind != tokenIdent {
+		return nil, p.unexpected(tok)
+	}
+
+	if tok.text == "g" || tok.text == "__" {
+		p.next()
+		if err := p.expect("."); err != nil {
+			return nil, err
+		}
+	}
+
+	for {
+		name := p.next()
+		if name.kind != tokenIdent {
+			return nil, p.unexpected(name)
+		}
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+
+		args, err := p.parseArgs(")")
+		if err != nil {
+			return nil, err
+		}
+		if err := t.add(name.text, args); err != nil {
+			return nil, err
+		}
+
+		if p.peek().text != "." {
+			return t, nil
+		}
+		p.next()
+	}
+}
+
+// parseArgs parses comma separated arguments up to and including end
+func (p *parser) parseArgs(end string) ([]interface{}, error) {
+	var args []interface{}
+
+	if p.peek().text == end {
+		p.next()
+		return args, nil
+	}
+
+	for {
+		arg, err := p.parseArg()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+
+		tok := p.next()
+		if tok.text == end {
+			return args, nil
+		}
+		if tok.text != "," {
+			return nil, p.unexpected(tok)
+		}
+	}
+}
+
+func (p *parser) parseArg() (interface{}, error) {
+	tok := p.peek()
+
+	switch tok.kind {
+	case tokenString, tokenNumber:
+		p.next()
+		return tok.value, nil
+	case tokenPunct:
+		if tok.text == "[" {
+			p.next()
+			return p.parseArgs("]")
+		}
+		return nil, p.unexpected(tok)
+	case tokenIdent:
+	default:
+		return nil, p.unexpected(tok)
+	}
+
+	switch tok.text {
+	case "true", "false":
+		p.next()
+		return tok.text == "true", nil
+	case "null":
+		p.next()
+		return nil, nil
+	case "g", "__":
+		return p.parseTraversal()
+	}
+
+	if enumClasses[tok.text] && p.peekAt(1).text == "." {
+		// Skip the class chain (e.g. VertexProperty.Cardinality.) to the member name
+		for enumClasses[p.peek().text] || p.peek().text == "." {
+			p.next()
+		}
+		member := p.next()
+		if member.kind != tokenIdent {
+			return nil, p.unexpected(member)
+		}
+		if p.peek().text == "(" {
+			return p.parsePredicate(member.text)
+		}
+		return token(member.text), nil
+	}
+
+	if p.peekAt(1).text == "(" {
+		if predicateNames[tok.text] {
+			p.next()
+			return p.parsePredicate(tok.text)
+		}
+		return p.parseTraversal()
+	}
+
+	p.next()
+	if value, ok := p.bindings[tok.text]; ok {
+		return value, nil
+	}
+	if bareTokens[tok.text] {
+		return token(tok.text), nil
+	}
+	return nil, fmt.Errorf("no such property: %s", tok.text)
+}
+
+func (p *parser) parsePredicate(op string) (interface{}, error) {
+	if !predicateNames[op] {
+		return nil, fmt.Errorf("unsupported predicate %q", op)
+	}
+
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	args, err := p.parseArgs(")")
+	if err != nil {
+		return nil, err
+	}
+	return predicate{op: op, args: flatten(args)}, nil
+}
+
+// flatten expands list arguments so within(['a', 'b']) and within('a', 'b') are the same
+func flatten(args []interface{}) []interface{} {
+	var out []interface{}
+	for _, arg := range args {
+		if list, ok := arg.([]interface{}); ok {
+			out = append(out, list...)
+			continue
+		}
+		out = append(out, arg)
+	}
+	return out
+}
+
+// parseBytecode parses GraphSON traversal bytecode
+func parseBytecode(v interface{}) (*script, error) {
+	t, err := decodeBytecode(v)
+	if err != nil {
+		return nil, err
+	}
+	return &script{statements: []interface{}{t}}, nil
+}
+
+func decodeBytecode(v interface{}) (*traversal, error) {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid bytecode %v", v)
+	}
+	if typ, ok := m["@type"]; ok {
+		if typ != "g:Bytecode" {
+			return nil, fmt.Errorf("expected g:Bytecode but got %v", typ)
+		}
+		if m, ok = m["@value"].(map[string]interface{}); !ok {
+			return nil, fmt.Errorf("invalid bytecode %v", v)
+		}
+	}
+
+	steps, _ := m["step"].([]interface{})
+	t := &traversal{}
+	for _, raw := range steps {
+		instruction, ok := raw.([]interface{})
+		if !ok || len(instruction) == 0 {
+			return nil, fmt.Errorf("invalid instruction %v", raw)
+		}
+		name, ok := instruction[0].(string)
+		if !ok {
+			return nil, fmt.Errorf("invalid instruction %v", raw)
+		}
+
+		args := make([]interface{}, len(instruction)-1)
+		for i, arg := range instruction[1:] {
+			decoded, err := decodeGraphSON(arg)
+			if err != nil {
+				return nil, err
+			}
+			args[i] = decoded
+		}
+
+		if err := t.add(name, args); err != nil {
+			return nil, err
+		}
+	}
+
+	return t, nil
+}
+
+// decodeGraphSON decodes a GraphSON 2 or 3 typed value into the values used by scripts
+func decodeGraphSON(v interface{}) (interface{}, error) {
+	switch value := v.(type) {
+	case float64:
+		return normalizeNumber(value), nil
+	case []interface{}:
+		out := make([]interface{}, len(value))
+		for i, e := range value {
+			decoded, err := decodeGraphSON(e)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = decoded
+		}
+		return out, nil
+	case map[string]interface{}:
+	default:
+		return v, nil
+	}
+
+	m := v.(map[string]interface{})
+	typ, ok := m["@type"].(string)
+	if !ok {
+		return m, nil
+	}
+	raw := m["@value"]
+
+	switch typ {
+	case "g:Int32", "g:Int64":
+		n, _ := raw.(float64)
+		return int64(n), nil
+	case "g:Float", "g:Double":
+		n, _ := raw.(float64)
+		return n, nil
+	case "g:Bytecode":
+		return decodeBytecode(m)
+	case "g:T", "g:Order", "g:Cardinality", "g:Direction", "g:Column", "g:Scope":
+		s, _ := raw.(string)
+		return token(s), nil
+	case "g:List", "g:Set":
+		return decodeGraphSON(raw)
+	case "g:P", "g:TextP":
+		pm, ok := raw.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("invalid predicate %v", raw)
+		}
+		op, _ := pm["predicate"].(string)
+		value, err := decodeGraphSON(pm["value"])
+		if err != nil {
+			return nil, err
+		}
+		if !predicateNames[op] {
+			return nil, fmt.Errorf("unsupported predicate %q", op)
+		}
+		args := []interface{}{value}
+		if list, ok := value.([]interface{}); ok {
+			args = list
+		}
+		return predicate{op: op, args: args}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported GraphSON type %q", typ)
+}
@@ -0,0 +1,191 @@
+package grmlntest
+
+import (
+	"encoding/base64"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/evandigby/grmln"
+)
+
+// Results responds with each batch in its own frame. Every frame but the last is partial content
+func Results(batches ...interface{}) Handler {
+	return HandlerFunc(func(w *ResponseWriter, r *Request) {
+		if len(batches) == 0 {
+			w.NoContent()
+			return
+		}
+
+		for _, batch := range batches[:len(batches)-1] {
+			if w.Partial(batch) != nil {
+				return
+			}
+		}
+		w.Success(batches[len(batches)-1])
+	})
+}
+
+// NoContent responds with no content
+func NoContent() Handler {
+	return HandlerFunc(func(w *ResponseWriter, r *Request) {
+		w.NoContent()
+	})
+}
+
+// Error responds with an error status
+func Error(code grmln.StatusCode, message string) Handler {
+	return HandlerFunc(func(w *ResponseWriter, r *Request) {
+		w.Error(code, message)
+	})
+}
+
+// Delay waits for d before calling h
+func Delay(d time.Duration, h Handler) Handler {
+	return HandlerFunc(func(w *ResponseWriter, r *Request) {
+		time.Sleep(d)
+		h.ServeGremlin(w, r)
+	})
+}
+
+// Drop closes the connection without responding
+func Drop() Handler {
+	return HandlerFunc(func(w *ResponseWriter, r *Request) {
+		w.Drop()
+	})
+}
+
+// DropAfter sends the first n batches as partial content and then closes the connection
+func DropAfter(n int, batches ...interface{}) Handler {
+	return HandlerFunc(func(w *ResponseWriter, r *Request) {
+		for i := 0; i < n && i < len(batches); i++ {
+			if w.Partial(batches[i]) != nil {
+				return
+			}
+		}
+		w.Drop()
+	})
+}
+
+// RequireAuth challenges every request and calls h if the SASL PLAIN credentials match, otherwise responds unauthorized
+func RequireAuth(userName, password string, h Handler) Handler {
+	return HandlerFunc(func(w *ResponseWriter, r *Request) {
+		auth, err := w.Challenge()
+		if err != nil {
+			return
+		}
+
+		sasl, _ := auth.Arguments["sasl"].(string)
+		u, p, ok := SASLCredentials(sasl)
+		if auth.Operation != "authentication" || !ok || u != userName || p != password {
+			w.Error(grmln.StatusUnauthorized, "invalid credentials")
+			return
+		}
+
+		h.ServeGremlin(w, r)
+	})
+}
+
+// SASLCredentials decodes SASL PLAIN authentication arguments
+func SASLCredentials(sasl string) (userName, password string, ok bool) {
+	data, err := base64.StdEncoding.DecodeString(sasl)
+	if err != nil {
+		return "", "", false
+	}
+
+	var parts [][]byte
+	start := 0
+	for i, b := range data {
+		if b == 0 {
+			parts = append(parts, data[start:i])
+			start = i + 1
+		}
+	}
+	parts = append(parts, data[start:])
+
+	if len(parts) != 3 {
+		return "", "", false
+	}
+	return string(parts[1]), string(parts[2]), true
+}
+
+// Sequence responds to the nth request with the nth handler, repeating the last handler once they run out
+func Sequence(handlers ...Handler) Handler {
+	var mu sync.Mutex
+	next := 0
+
+	return HandlerFunc(func(w *ResponseWriter, r *Request) {
+		mu.Lock()
+		h := handlers[next]
+		if next < len(handlers)-1 {
+			next++
+		}
+		mu.Unlock()
+
+		h.ServeGremlin(w, r)
+	})
+}
+
+type route struct {
+	exact   string
+	pattern *regexp.Regexp
+	handler Handler
+}
+
+// ScriptMux routes eval requests to handlers by gremlin script
+type ScriptMux struct {
+	mu       sync.Mutex
+	routes   []route
+	fallback Handler
+}
+
+// NewScriptMux creates a script mux that responds to unmatched requests with a script evaluation error
+func NewScriptMux() *ScriptMux {
+	return &ScriptMux{
+		fallback: Error(grmln.StatusScriptEvaluationError, "grmlntest: no handler for script"),
+	}
+}
+
+// Handle routes requests whose script is exactly gremlin to h
+func (m *ScriptMux) Handle(gremlin string, h Handler) *ScriptMux {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.routes = append(m.routes, route{exact: gremlin, handler: h})
+	return m
+}
+
+// HandleRegexp routes requests whose script matches pattern to h
+func (m *ScriptMux) HandleRegexp(pattern string, h Handler) *ScriptMux {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.routes = append(m.routes, route{pattern: regexp.MustCompile(pattern), handler: h})
+	return m
+}
+
+// Fallback sets the handler for requests that match no route
+func (m *ScriptMux) Fallback(h Handler) *ScriptMux {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.fallback = h
+	return m
+}
+
+// ServeGremlin implements Handler
+func (m *ScriptMux) ServeGremlin(w *ResponseWriter, r *Request) {
+	gremlin := r.Gremlin()
+
+	m.mu.Lock()
+	h := m.fallback
+	for _, rt := range m.routes {
+		if (rt.pattern == nil && rt.exact == gremlin) || (rt.pattern != nil && rt.pattern.MatchString(gremlin)) {
+			h = rt.handler
+			break
+		}
+	}
+	m.mu.Unlock()
+
+	h.ServeGremlin(w, r)
+}
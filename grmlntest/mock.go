@@ -0,0 +1,251 @@
+package grmlntest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/evandigby/grmln"
+)
+
+// Mock is a RequestProcessor that responds to requests from a list of expectations
+type Mock struct {
+	mu           sync.Mutex
+	expectations []*Expectation
+	unexpected   []string
+}
+
+// NewMock creates a mock with no expectations
+func NewMock() *Mock {
+	return &Mock{}
+}
+
+// Expect adds an expectation. Requests are matched against expectations in the order they were added
+func (m *Mock) Expect() *Expectation {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e := &Expectation{times: 1}
+	m.expectations = append(m.expectations, e)
+	return e
+}
+
+// ExpectEval adds an expectation for an eval request with the exact script gremlin
+func (m *Mock) ExpectEval(gremlin string) *Expectation {
+	return m.Expect().Op("eval").Script(gremlin)
+}
+
+// ProcessRequest implements grmln.RequestProcessor
+func (m *Mock) ProcessRequest(ctx context.Context, r grmln.Request, onResponse ...grmln.OnResponse) error {
+	req, err := toRequest(r)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	var match *Expectation
+	for _, e := range m.expectations {
+		if (e.times < 0 || e.calls < e.times) && e.matches(&req) {
+			match = e
+			match.calls++
+			break
+		}
+	}
+	if match == nil {
+		desc := describe(&req)
+		m.unexpected = append(m.unexpected, desc)
+		m.mu.Unlock()
+		return fmt.Errorf("grmlntest: unexpected request %s", desc)
+	}
+	m.mu.Unlock()
+
+	for _, resp := range match.responses {
+		resp.RequestID = r.RequestID
+		for _, or := range onResponse {
+			or(&resp)
+		}
+	}
+
+	return match.err
+}
+
+// AssertExpectations reports unexpected requests and unmet expectations as test errors
+func (m *Mock) AssertExpectations(t testing.TB) {
+	t.Helper()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, desc := range m.unexpected {
+		t.Errorf("grmlntest: unexpected request %s", desc)
+	}
+
+	for _, e := range m.expectations {
+		if e.times > 0 && e.calls < e.times {
+			t.Errorf("grmlntest: expected %s %d time(s) but it was requested %d time(s)", e, e.times, e.calls)
+		}
+	}
+}
+
+func describe(r *Request) string {
+	return fmt.Sprintf("%s/%s %q bindings %v", r.Processor, r.Operation, r.Gremlin(), r.Bindings())
+}
+
+// Expectation is an expected request and the response to send to it
+type Expectation struct {
+	processor     *string
+	op            *string
+	script        *string
+	scriptPattern *regexp.Regexp
+	bindings      map[string]interface{}
+	hasBindings   bool
+
+	responses []grmln.Response
+	err       error
+
+	// times is the number of times the expectation can be matched. Negative means unlimited
+	times int
+	calls int
+}
+
+// Processor matches requests to processor ("" for the default processor, "session" for sessions)
+func (e *Expectation) Processor(processor string) *Expectation {
+	e.processor = &processor
+	return e
+}
+
+// Op matches requests with op
+func (e *Expectation) Op(op string) *Expectation {
+	e.op = &op
+	return e
+}
+
+// Script matches requests whose script is exactly gremlin
+func (e *Expectation) Script(gremlin string) *Expectation {
+	e.script = &gremlin
+	return e
+}
+
+// ScriptRegexp matches requests whose script matches pattern
+func (e *Expectation) ScriptRegexp(pattern string) *Expectation {
+	e.scriptPattern = regexp.MustCompile(pattern)
+	return e
+}
+
+// Bindings matches requests with exactly these bindings
+func (e *Expectation) Bindings(bindings grmln.Bindings) *Expectation {
+	// Compare bindings the way they look on the wire so numbers match regardless of their Go type
+	data, err := json.Marshal(bindings)
+	if err != nil {
+		panic(err)
+	}
+	e.bindings = nil
+	if err := json.Unmarshal(data, &e.bindings); err != nil {
+		panic(err)
+	}
+	e.hasBindings = true
+	return e
+}
+
+// Times sets how many times the expectation must be matched. Defaults to 1
+func (e *Expectation) Times(n int) *Expectation {
+	e.times = n
+	return e
+}
+
+// AnyTimes allows the expectation to be matched any number of times, including never
+func (e *Expectation) AnyTimes() *Expectation {
+	e.times = -1
+	return e
+}
+
+// Respond responds with each batch in its own frame. Every frame but the last is partial content
+func (e *Expectation) Respond(batches ...interface{}) *Expectation {
+	e.responses = nil
+	if len(batches) == 0 {
+		e.responses = append(e.responses, grmln.Response{Status: grmln.ResponseStatus{Code: grmln.StatusNoContent}})
+		return e
+	}
+
+	for i, batch := range batches {
+		data, err := json.Marshal(batch)
+		if err != nil {
+			panic(err)
+		}
+
+		code := grmln.StatusPartialContent
+		if i == len(batches)-1 {
+			code = grmln.StatusSuccess
+		}
+
+		e.responses = append(e.responses, grmln.Response{
+			Status: grmln.ResponseStatus{Code: code},
+			Result: grmln.ResponseResult{Data: data},
+		})
+	}
+	return e
+}
+
+// RespondFrames responds with raw response frames
+func (e *Expectation) RespondFrames(responses ...grmln.Response) *Expectation {
+	e.responses = responses
+	return e
+}
+
+// ReturnError returns err after sending any responses
+func (e *Expectation) ReturnError(err error) *Expectation {
+	e.err = err
+	return e
+}
+
+// ReturnStatus returns an error response with code and message, as a real server would
+func (e *Expectation) ReturnStatus(code grmln.StatusCode, message string) *Expectation {
+	return e.ReturnError(grmln.Response{Status: grmln.ResponseStatus{Code: code, Message: message}}.Err())
+}
+
+func (e *Expectation) matches(r *Request) bool {
+	if e.processor != nil && *e.processor != r.Processor {
+		return false
+	}
+	if e.op != nil && *e.op != r.Operation {
+		return false
+	}
+	if e.script != nil && *e.script != r.Gremlin() {
+		return false
+	}
+	if e.scriptPattern != nil && !e.scriptPattern.MatchString(r.Gremlin()) {
+		return false
+	}
+	if e.hasBindings && !reflect.DeepEqual(e.bindings, r.Bindings()) && !(len(e.bindings) == 0 && len(r.Bindings()) == 0) {
+		return false
+	}
+	return true
+}
+
+func (e *Expectation) String() string {
+	var parts []string
+	if e.processor != nil {
+		parts = append(parts, fmt.Sprintf("processor %q", *e.processor))
+	}
+	if e.op != nil {
+		parts = append(parts, fmt.Sprintf("op %q", *e.op))
+	}
+	if e.script != nil {
+		parts = append(parts, fmt.Sprintf("script %q", *e.script))
+	}
+	if e.scriptPattern != nil {
+		parts = append(parts, fmt.Sprintf("script matching %q", e.scriptPattern))
+	}
+	if e.hasBindings {
+		parts = append(parts, fmt.Sprintf("bindings %v", e.bindings))
+	}
+	if len(parts) == 0 {
+		return "any request"
+	}
+	return "request with " + strings.Join(parts, ", ")
+}
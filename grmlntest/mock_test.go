@@ -0,0 +1,65 @@
+package grmlntest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/evandigby/grmln"
+)
+
+// recordingT captures errors so tests can check what a mock reports
+type recordingT struct {
+	testing.TB
+	errors []string
+}
+
+func (t *recordingT) Helper() {}
+
+func (t *recordingT) Errorf(format string, args ...interface{}) {
+	t.errors = append(t.errors, format)
+}
+
+func TestMock(t *testing.T) {
+	m := NewMock()
+	m.ExpectEval("g.V(id)").Bindings(grmln.Bindings{"id": 1}).Respond([]int{1}, []int{2})
+	m.Expect().Processor("session").ScriptRegexp(`^g\.addV`).ReturnStatus(grmln.StatusServerError, "boom")
+	m.ExpectEval("g.E()").AnyTimes().Respond()
+
+	op := grmln.NewOperator(m)
+	ctx := context.Background()
+
+	var data []int
+	if err := op.EvalDefault(ctx, "g.V(id)", grmln.Bindings{"id": 1}, collect(t, &data)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(data) != 2 {
+		t.Fatalf("expected 2 results but got %v", data)
+	}
+
+	session := op.NewSession()
+	if err := session.EvalDefault(ctx, "g.addV('person')", nil); !grmln.IsServerError(err) {
+		t.Fatalf("expected server error but got %v", err)
+	}
+
+	m.AssertExpectations(t)
+}
+
+func TestMockReportsFailures(t *testing.T) {
+	m := NewMock()
+	m.ExpectEval("g.V()").Times(2)
+
+	op := grmln.NewOperator(m)
+	ctx := context.Background()
+
+	op.EvalDefault(ctx, "g.V()", nil)
+	if err := op.EvalDefault(ctx, "g.E()", nil); err == nil {
+		t.Fatal("expected unexpected request to return an error")
+	}
+
+	rt := &recordingT{TB: t}
+	m.AssertExpectations(rt)
+
+	if len(rt.errors) != 2 {
+		t.Fatalf("expected an unexpected request and an unmet expectation to be reported but got %v", rt.errors)
+	}
+}
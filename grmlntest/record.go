@@ -0,0 +1,197 @@
+package grmlntest
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sync"
+
+	"github.com/evandigby/grmln"
+)
+
+// Recording is a request and every response frame it produced. Recordings are stored one per line (JSON Lines)
+type Recording struct {
+	Request   Request          `json:"request"`
+	Responses []grmln.Response `json:"responses"`
+
+	// ErrorResponse is the error response frame, if the request failed with one
+	ErrorResponse *grmln.Response `json:"errorResponse,omitempty"`
+
+	// Error is the error message, if the request failed without an error response
+	Error string `json:"error,omitempty"`
+}
+
+// responder is satisfied by grmln's response errors
+type responder interface {
+	Response() grmln.Response
+}
+
+// toRequest converts a grmln request to the form the server receives
+func toRequest(r grmln.Request) (Request, error) {
+	req := Request{
+		RequestID: r.RequestID,
+		Operation: r.Operation,
+		Processor: r.Processor,
+	}
+
+	data, err := json.Marshal(r.Arguments)
+	if err != nil {
+		return req, err
+	}
+
+	return req, json.Unmarshal(data, &req.Arguments)
+}
+
+// Recorder is a RequestProcessor that records every request and response passed through it
+type Recorder struct {
+	p grmln.RequestProcessor
+
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// NewRecorder creates a recorder that sends requests to p and writes recordings to w
+func NewRecorder(p grmln.RequestProcessor, w io.Writer) *Recorder {
+	return &Recorder{
+		p:   p,
+		enc: json.NewEncoder(w),
+	}
+}
+
+// ProcessRequest implements grmln.RequestProcessor
+func (rec *Recorder) ProcessRequest(ctx context.Context, r grmln.Request, onResponse ...grmln.OnResponse) error {
+	req, err := toRequest(r)
+	if err != nil {
+		return err
+	}
+
+	recording := Recording{Request: req}
+
+	// The caller's slice is copied so appending can't write into its spare capacity
+	ors := append([]grmln.OnResponse{}, onResponse...)
+	err = rec.p.ProcessRequest(ctx, r, append(ors, func(resp *grmln.Response) {
+		recording.Responses = append(recording.Responses, *resp)
+	})...)
+
+	if re, ok := err.(responder); ok {
+		resp := re.Response()
+		recording.ErrorResponse = &resp
+	} else if err != nil {
+		recording.Error = err.Error()
+	}
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	if werr := rec.enc.Encode(recording); werr != nil && err == nil {
+		return werr
+	}
+
+	return err
+}
+
+// Replayer is a RequestProcessor that serves recorded responses. Requests are matched by
+// processor, op, script and bindings. Identical requests are served in recorded order,
+// with the last recording repeated once they run out.
+type Replayer struct {
+	mu         sync.Mutex
+	recordings []*Recording
+	served     map[*Recording]bool
+}
+
+// NewReplayer reads recordings from r
+func NewReplayer(r io.Reader) (*Replayer, error) {
+	replayer := &Replayer{
+		served: map[*Recording]bool{},
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var recording Recording
+		if err := json.Unmarshal(scanner.Bytes(), &recording); err != nil {
+			return nil, err
+		}
+		replayer.recordings = append(replayer.recordings, &recording)
+	}
+
+	return replayer, scanner.Err()
+}
+
+// LoadReplayer reads recordings from the file at path
+func LoadReplayer(path string) (*Replayer, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return NewReplayer(f)
+}
+
+func matches(a, b Request) bool {
+	return a.Processor == b.Processor &&
+		a.Operation == b.Operation &&
+		a.Gremlin() == b.Gremlin() &&
+		reflect.DeepEqual(a.Bindings(), b.Bindings())
+}
+
+func (rep *Replayer) find(req Request) *Recording {
+	rep.mu.Lock()
+	defer rep.mu.Unlock()
+
+	var last *Recording
+	for _, recording := range rep.recordings {
+		if !matches(recording.Request, req) {
+			continue
+		}
+
+		if !rep.served[recording] {
+			rep.served[recording] = true
+			return recording
+		}
+		last = recording
+	}
+	return last
+}
+
+// ProcessRequest implements grmln.RequestProcessor
+func (rep *Replayer) ProcessRequest(ctx context.Context, r grmln.Request, onResponse ...grmln.OnResponse) error {
+	req, err := toRequest(r)
+	if err != nil {
+		return err
+	}
+
+	recording := rep.find(req)
+	if recording == nil {
+		return fmt.Errorf("grmlntest: no recording for %s %s request %q with bindings %v", req.Processor, req.Operation, req.Gremlin(), req.Bindings())
+	}
+
+	for _, resp := range recording.Responses {
+		resp.RequestID = r.RequestID
+		for _, or := range onResponse {
+			or(&resp)
+		}
+	}
+
+	if recording.ErrorResponse != nil {
+		resp := *recording.ErrorResponse
+		resp.RequestID = r.RequestID
+		return resp.Err()
+	}
+
+	if recording.Error != "" {
+		return errors.New(recording.Error)
+	}
+
+	return nil
+}
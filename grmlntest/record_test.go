@@ -0,0 +1,61 @@
+package grmlntest
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/evandigby/grmln"
+)
+
+func TestRecordReplay(t *testing.T) {
+	s := NewServer(NewScriptMux().
+		Handle("g.V(id)", Results([]int{1}, []int{2})).
+		Handle("g.V().count()", Sequence(Results([]int{10}), Results([]int{11}))),
+	)
+	defer s.Close()
+
+	c := dial(t, s, "", "")
+	defer c.Close()
+
+	var buf bytes.Buffer
+	op := grmln.NewOperator(NewRecorder(c, &buf))
+
+	ctx := context.Background()
+	op.EvalDefault(ctx, "g.V(id)", grmln.Bindings{"id": 1})
+	op.EvalDefault(ctx, "g.V().count()", nil)
+	op.EvalDefault(ctx, "g.V().count()", nil)
+	op.EvalDefault(ctx, "g.E()", nil)
+
+	replayer, err := NewReplayer(&buf)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	op = grmln.NewOperator(replayer)
+
+	var data []int
+	if err := op.EvalDefault(ctx, "g.V(id)", grmln.Bindings{"id": 1}, collect(t, &data)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(data) != 2 {
+		t.Fatalf("expected 2 results but got %v", data)
+	}
+
+	if err := op.EvalDefault(ctx, "g.V(id)", grmln.Bindings{"id": 2}); err == nil {
+		t.Fatal("expected error for request with different bindings")
+	}
+
+	for _, expected := range []int{10, 11, 11} {
+		data = nil
+		if err := op.EvalDefault(ctx, "g.V().count()", nil, collect(t, &data)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(data) != 1 || data[0] != expected {
+			t.Fatalf("expected [%d] but got %v", expected, data)
+		}
+	}
+
+	if err := op.EvalDefault(ctx, "g.E()", nil); !grmln.IsScriptEvaluationError(err) {
+		t.Fatalf("expected recorded script evaluation error but got %v", err)
+	}
+}
@@ -0,0 +1,302 @@
+// Package grmlntest provides utilities for testing code built on grmln without a real Gremlin Server
+package grmlntest
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	"github.com/evandigby/grmln"
+	"github.com/gorilla/websocket"
+)
+
+// ErrMalformedFrame is returned when a request frame isn't a mime type prefixed JSON message
+var ErrMalformedFrame = errors.New("grmlntest: malformed request frame")
+
+var errDropped = errors.New("grmlntest: connection dropped")
+
+// Request is a request frame received by the server
+type Request struct {
+	MimeType  string                 `json:"-"`
+	RequestID string                 `json:"requestId"`
+	Operation string                 `json:"op"`
+	Processor string                 `json:"processor"`
+	Arguments map[string]interface{} `json:"args"`
+}
+
+// Gremlin returns the gremlin script of an eval request
+func (r *Request) Gremlin() string {
+	gremlin, _ := r.Arguments["gremlin"].(string)
+	return gremlin
+}
+
+// Bindings returns the bindings of an eval request
+func (r *Request) Bindings() map[string]interface{} {
+	bindings, _ := r.Arguments["bindings"].(map[string]interface{})
+	return bindings
+}
+
+// Session returns the session of a session request
+func (r *Request) Session() string {
+	session, _ := r.Arguments["session"].(string)
+	return session
+}
+
+// ParseRequest parses a mime type prefixed request frame as sent by grmln
+func ParseRequest(frame []byte) (*Request, error) {
+	if len(frame) == 0 {
+		return nil, ErrMalformedFrame
+	}
+
+	mimeLen := int(frame[0])
+	if len(frame) < mimeLen+1 {
+		return nil, ErrMalformedFrame
+	}
+
+	r := Request{
+		MimeType: string(frame[1 : mimeLen+1]),
+	}
+
+	err := json.Unmarshal(frame[mimeLen+1:], &r)
+	if err != nil {
+		return nil, err
+	}
+
+	return &r, nil
+}
+
+// Handler responds to requests
+type Handler interface {
+	ServeGremlin(w *ResponseWriter, r *Request)
+}
+
+// HandlerFunc adapts an ordinary function to a Handler
+type HandlerFunc func(w *ResponseWriter, r *Request)
+
+// ServeGremlin calls f
+func (f HandlerFunc) ServeGremlin(w *ResponseWriter, r *Request) {
+	f(w, r)
+}
+
+// Server is an in-process Gremlin Server. Handlers are called sequentially for each
+// connection, in the order requests arrive.
+type Server struct {
+	// URL is the websocket URL of the server, suitable for grmln.Dial and grmln.NewCluster
+	URL string
+
+	handler  Handler
+	http     *httptest.Server
+	upgrader websocket.Upgrader
+
+	mu       sync.Mutex
+	conns    map[*websocket.Conn]struct{}
+	requests []*Request
+}
+
+// NewServer starts a server that responds to requests with handler
+func NewServer(handler Handler) *Server {
+	s := &Server{
+		handler: handler,
+		conns:   map[*websocket.Conn]struct{}{},
+	}
+
+	s.http = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	s.URL = "ws" + strings.TrimPrefix(s.http.URL, "http") + "/gremlin"
+
+	return s
+}
+
+// Requests returns every request received so far, including authentication requests
+func (s *Server) Requests() []*Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	requests := make([]*Request, len(s.requests))
+	copy(requests, s.requests)
+	return requests
+}
+
+// Connections returns the number of open connections
+func (s *Server) Connections() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.conns)
+}
+
+// DropConnections closes every open connection without a close frame
+func (s *Server) DropConnections() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for ws := range s.conns {
+		ws.Close()
+	}
+}
+
+// Close drops every connection and stops the server
+func (s *Server) Close() {
+	s.DropConnections()
+	s.http.Close()
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	ws, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	s.conns[ws] = struct{}{}
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, ws)
+		s.mu.Unlock()
+		ws.Close()
+	}()
+
+	rw := &ResponseWriter{server: s, ws: ws}
+	for !rw.dropped {
+		req, err := rw.readRequest()
+		if err == ErrMalformedFrame {
+			continue
+		}
+		if err != nil {
+			return
+		}
+
+		rw.requestID = req.RequestID
+		rw.frames = 0
+		rw.filter = nil
+		s.handler.ServeGremlin(rw, req)
+	}
+}
+
+func (s *Server) record(r *Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.requests = append(s.requests, r)
+}
+
+// ResponseWriter writes response frames for a single request
+type ResponseWriter struct {
+	server    *Server
+	ws        *websocket.Conn
+	requestID string
+	dropped   bool
+
+	// frames is the number of frames written for the current request
+	frames int
+	// filter, if set, can replace or suppress frames. It's used to inject faults
+	filter func(w *ResponseWriter, data []byte) ([]byte, bool)
+}
+
+func (w *ResponseWriter) readRequest() (*Request, error) {
+	_, frame, err := w.ws.ReadMessage()
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := ParseRequest(frame)
+	if err != nil {
+		w.Write(grmln.StatusMalformedRequest, err.Error(), nil)
+		return nil, ErrMalformedFrame
+	}
+
+	w.server.record(r)
+	return r, nil
+}
+
+// Write sends a response frame with the given status, message and data. data is encoded as JSON
+func (w *ResponseWriter) Write(code grmln.StatusCode, message string, data interface{}) error {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	return w.WriteResponse(grmln.Response{
+		RequestID: w.requestID,
+		Status: grmln.ResponseStatus{
+			Code:       code,
+			Message:    message,
+			Attributes: map[string]interface{}{},
+		},
+		Result: grmln.ResponseResult{
+			Data: raw,
+			Meta: map[string]interface{}{},
+		},
+	})
+}
+
+// WriteResponse sends a raw response frame
+func (w *ResponseWriter) WriteResponse(resp grmln.Response) error {
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return err
+	}
+
+	return w.WriteFrame(data)
+}
+
+// WriteFrame sends arbitrary bytes as a frame, which is useful for sending malformed frames
+func (w *ResponseWriter) WriteFrame(data []byte) error {
+	if w.dropped {
+		return errDropped
+	}
+
+	if w.filter != nil {
+		var write bool
+		data, write = w.filter(w, data)
+		if !write {
+			return nil
+		}
+		if w.dropped {
+			return errDropped
+		}
+	}
+
+	w.frames++
+	return w.ws.WriteMessage(websocket.TextMessage, data)
+}
+
+// Partial sends a partial content frame
+func (w *ResponseWriter) Partial(data interface{}) error {
+	return w.Write(grmln.StatusPartialContent, "", data)
+}
+
+// Success sends the final frame of a successful response
+func (w *ResponseWriter) Success(data interface{}) error {
+	return w.Write(grmln.StatusSuccess, "", data)
+}
+
+// NoContent sends a no content response
+func (w *ResponseWriter) NoContent() error {
+	return w.Write(grmln.StatusNoContent, "", nil)
+}
+
+// Error sends an error response
+func (w *ResponseWriter) Error(code grmln.StatusCode, message string) error {
+	return w.Write(code, message, nil)
+}
+
+// Challenge sends an authentication challenge and returns the authentication request sent in reply
+func (w *ResponseWriter) Challenge() (*Request, error) {
+	err := w.Write(grmln.StatusAuthenticate, "", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return w.readRequest()
+}
+
+// Drop closes the connection immediately without a close frame
+func (w *ResponseWriter) Drop() {
+	w.dropped = true
+	w.ws.Close()
+}
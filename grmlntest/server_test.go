@@ -0,0 +1,291 @@
+package grmlntest
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/evandigby/grmln"
+)
+
+func collect(t *testing.T, data *[]int) grmln.OnResponse {
+	return func(resp *grmln.Response) {
+		var batch []int
+		if err := json.Unmarshal(resp.Result.Data, &batch); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		*data = append(*data, batch...)
+	}
+}
+
+func dial(t *testing.T, s *Server, userName, password string) *grmln.Conn {
+	c, err := grmln.Dial(context.Background(), s.URL, grmln.DefaultMimeType, userName, password, http.Header{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return c
+}
+
+func TestServerPartialContent(t *testing.T) {
+	s := NewServer(NewScriptMux().Handle("g.V()", Results([]int{1, 2}, []int{3}, []int{4})))
+	defer s.Close()
+
+	c := dial(t, s, "", "")
+	defer c.Close()
+
+	var data []int
+	frames := 0
+	err := grmln.NewOperator(c).EvalDefault(context.Background(), "g.V()", nil, collect(t, &data), func(*grmln.Response) { frames++ })
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if frames != 3 || len(data) != 4 {
+		t.Fatalf("expected 4 results in 3 frames but got %v in %d frames", data, frames)
+	}
+
+	requests := s.Requests()
+	if len(requests) != 1 || requests[0].MimeType != grmln.DefaultMimeType || requests[0].Gremlin() != "g.V()" {
+		t.Fatalf("unexpected requests %+v", requests)
+	}
+}
+
+func TestServerErrors(t *testing.T) {
+	s := NewServer(NewScriptMux())
+	defer s.Close()
+
+	c := dial(t, s, "", "")
+	defer c.Close()
+
+	err := grmln.NewOperator(c).EvalDefault(context.Background(), "g.V()", nil)
+	if !grmln.IsScriptEvaluationError(err) {
+		t.Fatalf("expected script evaluation error but got %v", err)
+	}
+}
+
+func TestServerCancel(t *testing.T) {
+	s := NewServer(Delay(time.Second, Results([]int{1})))
+	defer s.Close()
+
+	cluster := grmln.NewCluster(grmln.ClusterConfig{}, s.URL)
+	defer cluster.Close()
+
+	// Warm the pool so the cluster has a free connection when the cancelled requests arrive
+	if err := grmln.NewOperator(cluster).EvalDefault(context.Background(), "g.V()", nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	before := dial(t, s, "", "")
+	defer before.Close()
+	during := dial(t, s, "", "")
+	defer during.Close()
+
+	// Neither context has a deadline, so only cancellation can interrupt the request
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name string
+		p    grmln.RequestProcessor
+		ctx  func() context.Context
+	}{
+		{"before", before, func() context.Context { return cancelled }},
+		{"before cluster", cluster, func() context.Context { return cancelled }},
+		{"during", during, func() context.Context {
+			ctx, cancel := context.WithCancel(context.Background())
+			time.AfterFunc(time.Millisecond*50, cancel)
+			return ctx
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			start := time.Now()
+			err := grmln.NewOperator(test.p).EvalDefault(test.ctx(), "g.V()", nil)
+			if err != context.Canceled {
+				t.Fatalf("expected context canceled but got %v", err)
+			}
+			if elapsed := time.Since(start); elapsed > time.Millisecond*500 {
+				t.Fatalf("expected cancellation to interrupt the request but it took %v", elapsed)
+			}
+		})
+	}
+}
+
+func TestServerAuthentication(t *testing.T) {
+	s := NewServer(RequireAuth("user", "pass", Results([]int{1})))
+	defer s.Close()
+
+	c := dial(t, s, "user", "pass")
+	defer c.Close()
+
+	var data []int
+	if err := grmln.NewOperator(c).EvalDefault(context.Background(), "g.V()", nil, collect(t, &data)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(data) != 1 {
+		t.Fatalf("expected 1 result but got %v", data)
+	}
+
+	bad := dial(t, s, "user", "wrong")
+	defer bad.Close()
+
+	if err := grmln.NewOperator(bad).EvalDefault(context.Background(), "g.V()", nil); !grmln.IsUnauthorized(err) {
+		t.Fatalf("expected unauthorized error but got %v", err)
+	}
+}
+
+func TestClusterReconnect(t *testing.T) {
+	s := NewServer(Sequence(DropAfter(1, []int{1}), Results([]int{2})))
+	defer s.Close()
+
+	c := grmln.NewCluster(grmln.ClusterConfig{BackoffBase: time.Millisecond, BackoffMax: time.Millisecond}, s.URL)
+	defer c.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	op := grmln.NewOperator(c)
+
+	var data []int
+	if err := op.EvalDefault(ctx, "g.V()", nil, collect(t, &data)); err == nil {
+		t.Fatal("expected dropped connection to return an error")
+	}
+
+	data = nil
+	if err := op.EvalDefault(ctx, "g.V()", nil, collect(t, &data)); err != nil {
+		t.Fatalf("unexpected error after reconnect: %v", err)
+	}
+	if len(data) != 1 || data[0] != 2 {
+		t.Fatalf("unexpected results %v", data)
+	}
+}
+
+func TestClusterShutdownWaitsForRequests(t *testing.T) {
+	s := NewServer(Delay(time.Millisecond*100, Results([]int{1})))
+	defer s.Close()
+
+	c := grmln.NewCluster(grmln.ClusterConfig{}, s.URL)
+
+	errs := make(chan error)
+	go func() {
+		errs <- grmln.NewOperator(c).EvalDefault(context.Background(), "g.V()", nil)
+	}()
+
+	// Wait for the request to reach the server
+	for len(s.Requests()) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	if err := c.Shutdown(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := <-errs; err != nil {
+		t.Fatalf("expected in-flight request to complete but got %v", err)
+	}
+}
+
+func TestClusterShutdownTimeout(t *testing.T) {
+	s := NewServer(Delay(time.Millisecond*500, Results([]int{1})))
+	defer s.Close()
+
+	c := grmln.NewCluster(grmln.ClusterConfig{ConnectionsPerAddress: 2}, s.URL)
+
+	go grmln.NewOperator(c).EvalDefault(context.Background(), "g.V()", nil)
+	for len(s.Requests()) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// The idle connection is still closed cleanly after the deadline for waiting has passed
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+
+	if err := c.Shutdown(ctx); err == nil || err.Error() != context.DeadlineExceeded.Error() {
+		t.Fatalf("expected only a deadline exceeded error but got %v", err)
+	}
+}
+
+// TestClusterMetrics ensures a cluster and its connections report to the configured Metrics
+func TestClusterMetrics(t *testing.T) {
+	s := NewServer(RequireAuth("user", "pass", Results([]int{1}, []int{2})))
+	defer s.Close()
+
+	m := grmln.NewPrometheusMetrics()
+	c := grmln.NewCluster(grmln.ClusterConfig{UserName: "user", Password: "pass", Metrics: m}, s.URL)
+	defer c.Close()
+
+	op := grmln.NewOperator(c)
+	for i := 0; i < 2; i++ {
+		if err := op.EvalDefault(context.Background(), "g.V()", nil); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	m.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	body := w.Body.String()
+
+	host := `{host="` + s.URL + `"}`
+	expected := []string{
+		`grmln_request_duration_seconds_count{host="` + s.URL + `",op="eval",status="200"} 2`,
+		`grmln_response_frames_sum{op="eval"} 4`,
+		`grmln_pool_connections` + host + ` 1`,
+		`grmln_connect_attempts_total` + host + ` 1`,
+		`grmln_auth_round_trips_total` + host + ` 2`,
+	}
+	for _, line := range expected {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("expected output to contain %q:\n%s", line, body)
+		}
+	}
+
+	// Byte counts depend on the encoding, so only check that something was counted
+	for _, name := range []string{"grmln_bytes_sent_total", "grmln_bytes_received_total"} {
+		if !regexp.MustCompile(regexp.QuoteMeta(name+host) + ` [1-9]`).MatchString(body) {
+			t.Errorf("expected %s to be counted:\n%s", name, body)
+		}
+	}
+}
+
+func TestClusterHedging(t *testing.T) {
+	slow := NewServer(Delay(time.Second*2, Results([]int{1})))
+	defer slow.Close()
+	fast := NewServer(Results([]int{2}))
+	defer fast.Close()
+
+	c := grmln.NewCluster(grmln.ClusterConfig{
+		Hedge: &grmln.HedgeConfig{Delay: time.Millisecond * 20},
+	}, slow.URL, fast.URL)
+	defer c.Close()
+
+	for slow.Connections() == 0 || fast.Connections() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	// Every request is hedged until one goes to the slow server first
+	for i := 0; len(slow.Requests()) == 0; i++ {
+		var data []int
+		start := time.Now()
+		if err := grmln.NewOperator(c).EvalDefault(grmln.WithIdempotent(ctx, true), "g.V()", nil, collect(t, &data)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(data) != 1 || data[0] != 2 {
+			t.Fatalf("expected the fast server's results but got %v", data)
+		}
+		if time.Since(start) > time.Second {
+			t.Fatal("hedged request waited for the slow server")
+		}
+	}
+}
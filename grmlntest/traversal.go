@@ -0,0 +1,1127 @@
+package grmlntest
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// traverser is a value moving through a traversal along with the values labelled by as()
+type traverser struct {
+	value  interface{}
+	labels map[string]interface{}
+}
+
+func (t traverser) with(value interface{}) traverser {
+	return traverser{value: value, labels: t.labels}
+}
+
+// edgeProperty is a property of an edge as returned by properties()
+type edgeProperty struct {
+	Key   string
+	Value interface{}
+}
+
+func (g *Graph) evaluateScript(s *script) ([]interface{}, error) {
+	var values []interface{}
+	for _, statement := range s.statements {
+		values = nil
+
+		// A list statement's results are the results of each traversal in it, in order
+		list, ok := statement.([]interface{})
+		if !ok {
+			list = []interface{}{statement}
+		}
+
+		for _, e := range list {
+			t, ok := e.(*traversal)
+			if !ok {
+				values = append(values, e)
+				continue
+			}
+
+			results, err := g.evaluate(t, nil)
+			if err != nil {
+				return nil, err
+			}
+			for _, r := range results {
+				values = append(values, r.value)
+			}
+		}
+	}
+	return values, nil
+}
+
+// evaluate runs t. A nil input starts a new traversal, otherwise t continues from input
+func (g *Graph) evaluate(t *traversal, input []traverser) ([]traverser, error) {
+	traversers := input
+	start := input == nil
+
+	for i, s := range t.steps {
+		if i == 0 && start && !startSteps[s.name] {
+			return nil, fmt.Errorf("traversal can't start with %s()", s.name)
+		}
+
+		var err error
+		if traversers, err = g.step(s, traversers, i == 0 && start); err != nil {
+			return nil, fmt.Errorf("%s(): %v", s.name, err)
+		}
+	}
+
+	return traversers, nil
+}
+
+// evaluateFrom runs an anonymous traversal for a single traverser
+func (g *Graph) evaluateFrom(t *traversal, from traverser) ([]traverser, error) {
+	return g.evaluate(t, []traverser{from})
+}
+
+var startSteps = map[string]bool{
+	"V":      true,
+	"E":      true,
+	"addV":   true,
+	"addE":   true,
+	"inject": true,
+}
+
+func (g *Graph) step(s *step, in []traverser, start bool) ([]traverser, error) {
+	if start {
+		// Start steps run once with an empty traverser
+		in = []traverser{{}}
+	}
+
+	switch s.name {
+	case "V", "E", "addV", "addE", "inject", "property", "as", "identity", "constant",
+		"has", "hasLabel", "hasId", "hasNot", "is", "coalesce", "where",
+		"out", "in", "both", "outE", "inE", "bothE", "outV", "inV", "bothV",
+		"values", "properties", "valueMap", "id", "label", "key", "value", "select", "unfold":
+		return g.flatMap(s, in, start)
+	case "count":
+		return []traverser{{value: int64(len(in))}}, nil
+	case "limit":
+		n, err := intArg(s.args, 0)
+		if err != nil {
+			return nil, err
+		}
+		return sliceTraversers(in, 0, n), nil
+	case "skip":
+		n, err := intArg(s.args, 0)
+		if err != nil {
+			return nil, err
+		}
+		return sliceTraversers(in, n, -1), nil
+	case "range":
+		lo, err := intArg(s.args, 0)
+		if err != nil {
+			return nil, err
+		}
+		hi, err := intArg(s.args, 1)
+		if err != nil {
+			return nil, err
+		}
+		if hi >= 0 {
+			hi -= lo
+		}
+		return sliceTraversers(in, lo, hi), nil
+	case "order":
+		return g.order(s, in)
+	case "dedup":
+		var out []traverser
+		for _, t := range in {
+			duplicate := false
+			for _, seen := range out {
+				if valuesEqual(seen.value, t.value) {
+					duplicate = true
+					break
+				}
+			}
+			if !duplicate {
+				out = append(out, t)
+			}
+		}
+		return out, nil
+	case "fold":
+		values := []interface{}{}
+		for _, t := range in {
+			values = append(values, t.value)
+		}
+		return []traverser{{value: values}}, nil
+	case "sum", "min", "max", "mean":
+		return reduceNumbers(s.name, in)
+	case "drop":
+		for _, t := range in {
+			if err := g.drop(t.value); err != nil {
+				return nil, err
+			}
+		}
+		return nil, nil
+	}
+
+	return nil, fmt.Errorf("unsupported step")
+}
+
+// flatMap applies steps that map each traverser to zero or more traversers
+func (g *Graph) flatMap(s *step, in []traverser, start bool) ([]traverser, error) {
+	var out []traverser
+	for _, t := range in {
+		values, err := g.apply(s, t, start)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range values {
+			if next, ok := v.(traverser); ok {
+				out = append(out, next)
+				continue
+			}
+			out = append(out, t.with(v))
+		}
+	}
+	return out, nil
+}
+
+func (g *Graph) apply(s *step, t traverser, start bool) ([]interface{}, error) {
+	switch s.name {
+	case "V":
+		var out []interface{}
+		for _, v := range g.vertices {
+			if matchesID(v.ID, s.args) {
+				out = append(out, v)
+			}
+		}
+		return out, nil
+	case "E":
+		var out []interface{}
+		for _, e := range g.edges {
+			if matchesID(e.ID, s.args) {
+				out = append(out, e)
+			}
+		}
+		return out, nil
+	case "inject":
+		if !start {
+			return []interface{}{t.value}, nil
+		}
+		return flatten(s.args), nil
+	case "addV":
+		label, err := optionalStringArg(s.args)
+		if err != nil {
+			return nil, err
+		}
+		return []interface{}{g.addVertex(label)}, nil
+	case "addE":
+		return g.applyAddE(s, t)
+	case "property":
+		return g.applyProperty(s, t)
+	case "as":
+		labels := make(map[string]interface{}, len(t.labels)+len(s.args))
+		for k, v := range t.labels {
+			labels[k] = v
+		}
+		for _, arg := range s.args {
+			name, ok := arg.(string)
+			if !ok {
+				return nil, fmt.Errorf("invalid label %v", arg)
+			}
+			labels[name] = t.value
+		}
+		return []interface{}{traverser{value: t.value, labels: labels}}, nil
+	case "identity":
+		return []interface{}{t.value}, nil
+	case "constant":
+		if len(s.args) != 1 {
+			return nil, fmt.Errorf("expected 1 argument")
+		}
+		return []interface{}{s.args[0]}, nil
+	case "select":
+		if len(s.args) == 1 {
+			v, ok := t.labels[fmt.Sprint(s.args[0])]
+			if !ok {
+				return nil, nil
+			}
+			return []interface{}{v}, nil
+		}
+		selected := map[string]interface{}{}
+		for _, arg := range s.args {
+			v, ok := t.labels[fmt.Sprint(arg)]
+			if !ok {
+				return nil, nil
+			}
+			selected[fmt.Sprint(arg)] = v
+		}
+		return []interface{}{selected}, nil
+	case "coalesce":
+		for _, arg := range s.args {
+			sub, ok := arg.(*traversal)
+			if !ok {
+				return nil, fmt.Errorf("expected traversal but got %v", arg)
+			}
+			results, err := g.evaluateFrom(sub, t)
+			if err != nil {
+				return nil, err
+			}
+			if len(results) > 0 {
+				out := make([]interface{}, len(results))
+				for i, r := range results {
+					out[i] = r
+				}
+				return out, nil
+			}
+		}
+		return nil, nil
+	case "where":
+		if len(s.args) != 1 {
+			return nil, fmt.Errorf("expected a single traversal argument")
+		}
+		sub, ok := s.args[0].(*traversal)
+		if !ok {
+			return nil, fmt.Errorf("expected traversal but got %v", s.args[0])
+		}
+		results, err := g.evaluateFrom(sub, t)
+		if err != nil || len(results) == 0 {
+			return nil, err
+		}
+		return []interface{}{t.value}, nil
+	case "has", "hasLabel", "hasId", "hasNot", "is":
+		ok, err := g.filter(s, t)
+		if err != nil || !ok {
+			return nil, err
+		}
+		return []interface{}{t.value}, nil
+	case "out", "in", "both", "outE", "inE", "bothE":
+		v, ok := t.value.(*Vertex)
+		if !ok {
+			return nil, fmt.Errorf("expected vertex but got %T", t.value)
+		}
+		return adjacent(v, s.name, s.args), nil
+	case "outV", "inV", "bothV":
+		e, ok := t.value.(*Edge)
+		if !ok {
+			return nil, fmt.Errorf("expected edge but got %T", t.value)
+		}
+		switch s.name {
+		case "outV":
+			return []interface{}{e.OutV}, nil
+		case "inV":
+			return []interface{}{e.InV}, nil
+		}
+		return []interface{}{e.OutV, e.InV}, nil
+	case "values", "properties":
+		return properties(t.value, s.name == "values", stringArgs(s.args))
+	case "valueMap":
+		return valueMap(t.value, s.args)
+	case "id":
+		switch e := t.value.(type) {
+		case *Vertex:
+			return []interface{}{e.ID}, nil
+		case *Edge:
+			return []interface{}{e.ID}, nil
+		case *VertexProperty:
+			return []interface{}{e.ID}, nil
+		}
+		return nil, fmt.Errorf("expected element but got %T", t.value)
+	case "label":
+		switch e := t.value.(type) {
+		case *Vertex:
+			return []interface{}{e.Label}, nil
+		case *Edge:
+			return []interface{}{e.Label}, nil
+		case *VertexProperty:
+			return []interface{}{e.Key}, nil
+		}
+		return nil, fmt.Errorf("expected element but got %T", t.value)
+	case "key", "value":
+		switch p := t.value.(type) {
+		case *VertexProperty:
+			if s.name == "key" {
+				return []interface{}{p.Key}, nil
+			}
+			return []interface{}{p.Value}, nil
+		case *edgeProperty:
+			if s.name == "key" {
+				return []interface{}{p.Key}, nil
+			}
+			return []interface{}{p.Value}, nil
+		}
+		return nil, fmt.Errorf("expected property but got %T", t.value)
+	case "unfold":
+		switch v := t.value.(type) {
+		case []interface{}:
+			return v, nil
+		case map[string]interface{}:
+			keys := sortedKeys(v)
+			out := make([]interface{}, len(keys))
+			for i, k := range keys {
+				out[i] = map[string]interface{}{k: v[k]}
+			}
+			return out, nil
+		}
+		return []interface{}{t.value}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported step")
+}
+
+func (g *Graph) applyAddE(s *step, t traverser) ([]interface{}, error) {
+	label, err := optionalStringArg(s.args)
+	if err != nil {
+		return nil, err
+	}
+
+	var from, to *Vertex
+	if v, ok := t.value.(*Vertex); ok {
+		from, to = v, v
+	}
+
+	for _, m := range s.modulators {
+		if m.name != "from" && m.name != "to" {
+			return nil, fmt.Errorf("unsupported modulator %s()", m.name)
+		}
+		if len(m.args) != 1 {
+			return nil, fmt.Errorf("%s() expects 1 argument", m.name)
+		}
+
+		v, err := g.resolveVertex(m.args[0], t)
+		if err != nil {
+			return nil, fmt.Errorf("%s(): %v", m.name, err)
+		}
+
+		if m.name == "from" {
+			from = v
+		} else {
+			to = v
+		}
+	}
+
+	if from == nil || to == nil {
+		return nil, fmt.Errorf("edge requires both an out and in vertex")
+	}
+	return []interface{}{g.addEdge(label, from, to)}, nil
+}
+
+// resolveVertex resolves from() and to() arguments: a label from as(), a traversal, a vertex or a vertex id
+func (g *Graph) resolveVertex(arg interface{}, t traverser) (*Vertex, error) {
+	switch a := arg.(type) {
+	case *Vertex:
+		return a, nil
+	case string:
+		v, ok := t.labels[a].(*Vertex)
+		if !ok {
+			return nil, fmt.Errorf("no vertex labelled %q", a)
+		}
+		return v, nil
+	case *traversal:
+		input := []traverser{t}
+		if len(a.steps) > 0 && startSteps[a.steps[0].name] {
+			input = nil
+		}
+		results, err := g.evaluate(a, input)
+		if err != nil {
+			return nil, err
+		}
+		if len(results) == 0 {
+			return nil, fmt.Errorf("traversal returned no vertex")
+		}
+		v, ok := results[0].value.(*Vertex)
+		if !ok {
+			return nil, fmt.Errorf("expected vertex but got %T", results[0].value)
+		}
+		return v, nil
+	}
+
+	for _, v := range g.vertices {
+		if valuesEqual(v.ID, arg) {
+			return v, nil
+		}
+	}
+	return nil, fmt.Errorf("vertex %v not found", arg)
+}
+
+func (g *Graph) applyProperty(s *step, t traverser) ([]interface{}, error) {
+	args := s.args
+	cardinality := "single"
+	if len(args) > 0 {
+		if c, ok := args[0].(token); ok && (c == "single" || c == "list" || c == "set") {
+			cardinality = string(c)
+			args = args[1:]
+		}
+	}
+	if len(args) < 2 || len(args)%2 != 0 {
+		return nil, fmt.Errorf("expected key and value")
+	}
+
+	if args[0] == token("id") {
+		if err := g.setID(t.value, args[1]); err != nil {
+			return nil, err
+		}
+		return []interface{}{t.value}, nil
+	}
+
+	for i := 0; i < len(args); i += 2 {
+		key, ok := args[i].(string)
+		if !ok {
+			return nil, fmt.Errorf("invalid property key %v", args[i])
+		}
+		value := args[i+1]
+		if sub, ok := value.(*traversal); ok {
+			results, err := g.evaluateFrom(sub, t)
+			if err != nil {
+				return nil, err
+			}
+			if len(results) == 0 {
+				return nil, fmt.Errorf("traversal returned no value for %q", key)
+			}
+			value = results[0].value
+		}
+
+		switch e := t.value.(type) {
+		case *Vertex:
+			// Only the first key value pair is the vertex property, the rest are meta properties which aren't supported
+			if i == 0 {
+				g.setVertexProperty(e, cardinality, key, value)
+			}
+		case *Edge:
+			g.setEdgeProperty(e, key, value)
+		default:
+			return nil, fmt.Errorf("expected element but got %T", t.value)
+		}
+	}
+
+	return []interface{}{t.value}, nil
+}
+
+func (g *Graph) filter(s *step, t traverser) (bool, error) {
+	switch s.name {
+	case "is":
+		if len(s.args) != 1 {
+			return false, fmt.Errorf("expected 1 argument")
+		}
+		return test(s.args[0], t.value), nil
+	case "hasLabel":
+		label, ok := elementLabel(t.value)
+		return ok && matchesAny(label, s.args), nil
+	case "hasId":
+		id, ok := elementID(t.value)
+		return ok && matchesAny(id, s.args), nil
+	case "hasNot":
+		if len(s.args) != 1 {
+			return false, fmt.Errorf("expected 1 argument")
+		}
+		values, err := propertyValues(t.value, fmt.Sprint(s.args[0]))
+		return len(values) == 0, err
+	}
+
+	args := s.args
+	switch len(args) {
+	case 1:
+		values, err := propertyValues(t.value, fmt.Sprint(args[0]))
+		return len(values) > 0, err
+	case 3:
+		label, ok := elementLabel(t.value)
+		if !ok || !test(args[0], label) {
+			return false, nil
+		}
+		args = args[1:]
+	case 2:
+	default:
+		return false, fmt.Errorf("expected 1 to 3 arguments")
+	}
+
+	var values []interface{}
+	switch key := args[0].(type) {
+	case token:
+		switch key {
+		case "id":
+			id, ok := elementID(t.value)
+			if !ok {
+				return false, nil
+			}
+			values = []interface{}{id}
+		case "label":
+			label, ok := elementLabel(t.value)
+			if !ok {
+				return false, nil
+			}
+			values = []interface{}{label}
+		default:
+			return false, fmt.Errorf("unsupported key %v", key)
+		}
+	case string:
+		var err error
+		if values, err = propertyValues(t.value, key); err != nil {
+			return false, err
+		}
+	default:
+		return false, fmt.Errorf("invalid key %v", args[0])
+	}
+
+	for _, v := range values {
+		if test(args[1], v) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (g *Graph) order(s *step, in []traverser) ([]traverser, error) {
+	type sortKey struct {
+		by   interface{}
+		desc bool
+	}
+
+	var keys []sortKey
+	for _, m := range s.modulators {
+		if m.name != "by" {
+			return nil, fmt.Errorf("unsupported modulator %s()", m.name)
+		}
+
+		k := sortKey{}
+		args := m.args
+		if len(args) > 0 {
+			if o, ok := args[len(args)-1].(token); ok && (o == "asc" || o == "desc" || o == "incr" || o == "decr") {
+				k.desc = o == "desc" || o == "decr"
+				args = args[:len(args)-1]
+			}
+		}
+		if len(args) > 0 {
+			k.by = args[0]
+		}
+		keys = append(keys, k)
+	}
+	if len(keys) == 0 {
+		keys = []sortKey{{}}
+	}
+
+	values := make([][]interface{}, len(in))
+	for i, t := range in {
+		values[i] = make([]interface{}, len(keys))
+		for j, k := range keys {
+			v, err := g.byValue(k.by, t)
+			if err != nil {
+				return nil, err
+			}
+			values[i][j] = v
+		}
+	}
+
+	index := make([]int, len(in))
+	for i := range index {
+		index[i] = i
+	}
+	sort.SliceStable(index, func(a, b int) bool {
+		for j, k := range keys {
+			c := compareValues(values[index[a]][j], values[index[b]][j])
+			if c == 0 {
+				continue
+			}
+			if k.desc {
+				return c > 0
+			}
+			return c < 0
+		}
+		return false
+	})
+
+	out := make([]traverser, len(in))
+	for i, idx := range index {
+		out[i] = in[idx]
+	}
+	return out, nil
+}
+
+// byValue resolves a by() modulator for t: nothing, a property key, a token or a traversal
+func (g *Graph) byValue(by interface{}, t traverser) (interface{}, error) {
+	switch b := by.(type) {
+	case nil:
+		return t.value, nil
+	case token:
+		switch b {
+		case "id":
+			id, _ := elementID(t.value)
+			return id, nil
+		case "label":
+			label, _ := elementLabel(t.value)
+			return label, nil
+		}
+		return nil, fmt.Errorf("unsupported by(%v)", b)
+	case string:
+		values, err := propertyValues(t.value, b)
+		if err != nil || len(values) == 0 {
+			return nil, err
+		}
+		return values[0], nil
+	case *traversal:
+		results, err := g.evaluateFrom(b, t)
+		if err != nil || len(results) == 0 {
+			return nil, err
+		}
+		return results[0].value, nil
+	}
+	return nil, fmt.Errorf("unsupported by(%v)", by)
+}
+
+func (g *Graph) drop(v interface{}) error {
+	switch e := v.(type) {
+	case *Vertex:
+		g.removeVertex(e)
+	case *Edge:
+		g.removeEdge(e)
+	case *VertexProperty:
+		for _, vertex := range g.vertices {
+			props := vertex.Properties[e.Key]
+			for i, p := range props {
+				if p == e {
+					vertex.Properties[e.Key] = append(props[:i], props[i+1:]...)
+					if len(vertex.Properties[e.Key]) == 0 {
+						delete(vertex.Properties, e.Key)
+						vertex.keys = removeKey(vertex.keys, e.Key)
+					}
+					return nil
+				}
+			}
+		}
+	default:
+		return fmt.Errorf("can't drop %T", v)
+	}
+	return nil
+}
+
+func removeKey(keys []string, key string) []string {
+	for i, k := range keys {
+		if k == key {
+			return append(keys[:i], keys[i+1:]...)
+		}
+	}
+	return keys
+}
+
+func adjacent(v *Vertex, direction string, labels []interface{}) []interface{} {
+	var edges []*Edge
+	switch strings.TrimSuffix(direction, "E") {
+	case "out":
+		edges = v.out
+	case "in":
+		edges = v.in
+	default:
+		edges = append(append(edges, v.out...), v.in...)
+	}
+
+	var out []interface{}
+	for _, e := range edges {
+		if len(labels) > 0 && !matchesAny(e.Label, labels) {
+			continue
+		}
+
+		switch {
+		case strings.HasSuffix(direction, "E"):
+			out = append(out, e)
+		case e.OutV == v && direction != "in":
+			out = append(out, e.InV)
+		default:
+			out = append(out, e.OutV)
+		}
+	}
+	return out
+}
+
+func properties(element interface{}, values bool, keys []string) ([]interface{}, error) {
+	var out []interface{}
+	switch e := element.(type) {
+	case *Vertex:
+		for _, key := range selectKeys(e.keys, keys) {
+			for _, p := range e.Properties[key] {
+				if values {
+					out = append(out, p.Value)
+				} else {
+					out = append(out, p)
+				}
+			}
+		}
+	case *Edge:
+		for _, key := range selectKeys(e.keys, keys) {
+			if values {
+				out = append(out, e.Properties[key])
+			} else {
+				out = append(out, &edgeProperty{Key: key, Value: e.Properties[key]})
+			}
+		}
+	case *VertexProperty:
+		if values {
+			return nil, fmt.Errorf("meta properties aren't supported")
+		}
+	default:
+		return nil, fmt.Errorf("expected element but got %T", element)
+	}
+	return out, nil
+}
+
+func valueMap(element interface{}, args []interface{}) ([]interface{}, error) {
+	includeTokens := false
+	if len(args) > 0 {
+		if b, ok := args[0].(bool); ok {
+			includeTokens = b
+			args = args[1:]
+		}
+	}
+	keys := stringArgs(args)
+
+	m := map[string]interface{}{}
+	switch e := element.(type) {
+	case *Vertex:
+		for _, key := range selectKeys(e.keys, keys) {
+			values := make([]interface{}, len(e.Properties[key]))
+			for i, p := range e.Properties[key] {
+				values[i] = p.Value
+			}
+			m[key] = values
+		}
+		if includeTokens {
+			m["id"] = e.ID
+			m["label"] = e.Label
+		}
+	case *Edge:
+		for _, key := range selectKeys(e.keys, keys) {
+			m[key] = e.Properties[key]
+		}
+		if includeTokens {
+			m["id"] = e.ID
+			m["label"] = e.Label
+		}
+	default:
+		return nil, fmt.Errorf("expected element but got %T", element)
+	}
+	return []interface{}{m}, nil
+}
+
+// selectKeys returns the keys of an element in insertion order, limited to wanted if it isn't empty
+func selectKeys(keys, wanted []string) []string {
+	if len(wanted) == 0 {
+		return keys
+	}
+
+	var out []string
+	for _, w := range wanted {
+		for _, k := range keys {
+			if k == w {
+				out = append(out, k)
+				break
+			}
+		}
+	}
+	return out
+}
+
+func propertyValues(element interface{}, key string) ([]interface{}, error) {
+	switch element.(type) {
+	case *Vertex, *Edge:
+		return properties(element, true, []string{key})
+	}
+	return nil, fmt.Errorf("expected element but got %T", element)
+}
+
+func elementID(element interface{}) (interface{}, bool) {
+	switch e := element.(type) {
+	case *Vertex:
+		return e.ID, true
+	case *Edge:
+		return e.ID, true
+	case *VertexProperty:
+		return e.ID, true
+	}
+	return nil, false
+}
+
+func elementLabel(element interface{}) (interface{}, bool) {
+	switch e := element.(type) {
+	case *Vertex:
+		return e.Label, true
+	case *Edge:
+		return e.Label, true
+	case *VertexProperty:
+		return e.Key, true
+	}
+	return nil, false
+}
+
+// matchesID reports whether id is one of ids (elements or raw ids). No ids matches everything
+func matchesID(id int64, ids []interface{}) bool {
+	ids = flatten(ids)
+	if len(ids) == 0 {
+		return true
+	}
+
+	for _, candidate := range ids {
+		if elementID, ok := elementID(candidate); ok {
+			candidate = elementID
+		}
+		if valuesEqual(id, candidate) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesAny reports whether v passes any of the values or predicates in args
+func matchesAny(v interface{}, args []interface{}) bool {
+	for _, arg := range flatten(args) {
+		if test(arg, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// test checks v against a predicate, or for equality with a plain value
+func test(p interface{}, v interface{}) bool {
+	pred, ok := p.(predicate)
+	if !ok {
+		return valuesEqual(p, v)
+	}
+
+	arg := func(i int) interface{} {
+		if i < len(pred.args) {
+			return pred.args[i]
+		}
+		return nil
+	}
+	ordered := func(i int) bool {
+		return isNumber(v) && isNumber(arg(i)) || isString(v) && isString(arg(i))
+	}
+	str := func() (string, string, bool) {
+		s, ok1 := v.(string)
+		a, ok2 := arg(0).(string)
+		return s, a, ok1 && ok2
+	}
+
+	switch pred.op {
+	case "eq":
+		return valuesEqual(v, arg(0))
+	case "neq":
+		return !valuesEqual(v, arg(0))
+	case "gt":
+		return ordered(0) && compareValues(v, arg(0)) > 0
+	case "gte":
+		return ordered(0) && compareValues(v, arg(0)) >= 0
+	case "lt":
+		return ordered(0) && compareValues(v, arg(0)) < 0
+	case "lte":
+		return ordered(0) && compareValues(v, arg(0)) <= 0
+	case "between":
+		return ordered(0) && ordered(1) && compareValues(v, arg(0)) >= 0 && compareValues(v, arg(1)) < 0
+	case "inside":
+		return ordered(0) && ordered(1) && compareValues(v, arg(0)) > 0 && compareValues(v, arg(1)) < 0
+	case "outside":
+		return ordered(0) && ordered(1) && (compareValues(v, arg(0)) < 0 || compareValues(v, arg(1)) > 0)
+	case "within", "without":
+		found := false
+		for _, a := range pred.args {
+			if valuesEqual(v, a) {
+				found = true
+				break
+			}
+		}
+		return found == (pred.op == "within")
+	case "containing", "notContaining":
+		s, a, ok := str()
+		return ok && strings.Contains(s, a) == (pred.op == "containing")
+	case "startingWith", "notStartingWith":
+		s, a, ok := str()
+		return ok && strings.HasPrefix(s, a) == (pred.op == "startingWith")
+	case "endingWith", "notEndingWith":
+		s, a, ok := str()
+		return ok && strings.HasSuffix(s, a) == (pred.op == "endingWith")
+	}
+	return false
+}
+
+func reduceNumbers(op string, in []traverser) ([]traverser, error) {
+	var values []interface{}
+	for _, t := range in {
+		if !isNumber(t.value) {
+			return nil, fmt.Errorf("expected number but got %T", t.value)
+		}
+		values = append(values, t.value)
+	}
+
+	if len(values) == 0 {
+		if op == "sum" {
+			return []traverser{{value: int64(0)}}, nil
+		}
+		return nil, nil
+	}
+
+	switch op {
+	case "min", "max":
+		result := values[0]
+		for _, v := range values[1:] {
+			c := compareValues(v, result)
+			if op == "min" && c < 0 || op == "max" && c > 0 {
+				result = v
+			}
+		}
+		return []traverser{{value: result}}, nil
+	}
+
+	var isum int64
+	var fsum float64
+	floats := false
+	for _, v := range values {
+		switch n := v.(type) {
+		case int64:
+			isum += n
+			fsum += float64(n)
+		case float64:
+			floats = true
+			fsum += n
+		}
+	}
+
+	if op == "mean" {
+		return []traverser{{value: fsum / float64(len(values))}}, nil
+	}
+	if floats {
+		return []traverser{{value: fsum}}, nil
+	}
+	return []traverser{{value: isum}}, nil
+}
+
+func sliceTraversers(in []traverser, lo, n int) []traverser {
+	if lo > len(in) {
+		return nil
+	}
+	in = in[lo:]
+	if n >= 0 && n < len(in) {
+		in = in[:n]
+	}
+	return in
+}
+
+func intArg(args []interface{}, i int) (int, error) {
+	if i >= len(args) {
+		return 0, fmt.Errorf("missing argument %d", i+1)
+	}
+	n, ok := args[i].(int64)
+	if !ok {
+		return 0, fmt.Errorf("expected integer but got %v", args[i])
+	}
+	return int(n), nil
+}
+
+func optionalStringArg(args []interface{}) (string, error) {
+	if len(args) == 0 {
+		return "", nil
+	}
+	s, ok := args[0].(string)
+	if !ok || len(args) > 1 {
+		return "", fmt.Errorf("expected a single string argument")
+	}
+	return s, nil
+}
+
+func stringArgs(args []interface{}) []string {
+	var out []string
+	for _, arg := range flatten(args) {
+		out = append(out, fmt.Sprint(arg))
+	}
+	return out
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func isNumber(v interface{}) bool {
+	switch v.(type) {
+	case int64, float64:
+		return true
+	}
+	return false
+}
+
+func isString(v interface{}) bool {
+	_, ok := v.(string)
+	return ok
+}
+
+func toFloat(v interface{}) float64 {
+	switch n := v.(type) {
+	case int64:
+		return float64(n)
+	case float64:
+		return n
+	}
+	return math.NaN()
+}
+
+// valuesEqual compares values, treating numbers of different types as equal if they have the same value
+func valuesEqual(a, b interface{}) bool {
+	if isNumber(a) && isNumber(b) {
+		return toFloat(a) == toFloat(b)
+	}
+
+	switch av := a.(type) {
+	case []interface{}:
+		bv, ok := b.([]interface{})
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for i := range av {
+			if !valuesEqual(av[i], bv[i]) {
+				return false
+			}
+		}
+		return true
+	case map[string]interface{}:
+		bv, ok := b.(map[string]interface{})
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for k := range av {
+			if !valuesEqual(av[k], bv[k]) {
+				return false
+			}
+		}
+		return true
+	}
+
+	return a == b
+}
+
+// compareValues orders numbers numerically, then strings, then anything else by its string form
+func compareValues(a, b interface{}) int {
+	if isNumber(a) && isNumber(b) {
+		fa, fb := toFloat(a), toFloat(b)
+		switch {
+		case fa < fb:
+			return -1
+		case fa > fb:
+			return 1
+		}
+		return 0
+	}
+
+	if ida, ok := elementID(a); ok {
+		if idb, ok := elementID(b); ok {
+			return compareValues(ida, idb)
+		}
+	}
+
+	if ab, ok := a.(bool); ok {
+		if bb, ok := b.(bool); ok {
+			switch {
+			case ab == bb:
+				return 0
+			case !ab:
+				return -1
+			}
+			return 1
+		}
+	}
+
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
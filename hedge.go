@@ -0,0 +1,265 @@
+package grmln
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Hedge defaults
+const (
+	DefaultHedgeMinSamples = 100
+	hedgeLatencySamples    = 1000
+)
+
+type idempotentKey struct{}
+
+// HedgeConfig configures hedged requests. When an idempotent or read-only request outside a session
+// hasn't completed within the hedge delay, a duplicate is sent to a second host. The
+// first attempt to respond is used and the other is cancelled.
+type HedgeConfig struct {
+	// Delay is how long to wait before sending the duplicate request. 0 sends the duplicate
+	// immediately, so every hedged request runs on two hosts
+	Delay time.Duration
+
+	// Percentile (0-1), when set, hedges once a request has taken longer than this percentile of
+	// recent latencies. Delay is used until MinSamples latencies have been observed
+	Percentile float64
+
+	// MinSamples is the number of latencies required before Percentile is used. Defaults to 100
+	MinSamples int
+}
+
+// WithIdempotent marks requests made with the returned context as safe to send more than once
+func WithIdempotent(ctx context.Context, idempotent bool) context.Context {
+	return context.WithValue(ctx, idempotentKey{}, idempotent)
+}
+
+// isIdempotent returns whether r may be hedged. Session state lives on one host, so session requests
+// are never hedged whatever ctx says
+func (c *Cluster) isIdempotent(ctx context.Context, r Request) bool {
+	if r.Processor == processorSession {
+		return false
+	}
+
+	if idempotent, ok := ctx.Value(idempotentKey{}).(bool); ok {
+		return idempotent
+	}
+
+	return c.isReadOnly(ctx, r)
+}
+
+// markedIdempotent returns whether ctx marks its request idempotent or read-only
+func markedIdempotent(ctx context.Context) bool {
+	if idempotent, ok := ctx.Value(idempotentKey{}).(bool); ok {
+		return idempotent
+	}
+
+	readOnly, _ := readOnlyFromContext(ctx)
+	return readOnly
+}
+
+// hedger tracks recent latencies to calculate the hedge delay
+type hedger struct {
+	config HedgeConfig
+
+	mu        sync.Mutex
+	latencies []time.Duration
+	next      int
+}
+
+func newHedger(config HedgeConfig) *hedger {
+	if config.MinSamples == 0 {
+		config.MinSamples = DefaultHedgeMinSamples
+	}
+
+	return &hedger{
+		config: config,
+	}
+}
+
+func (h *hedger) observe(latency time.Duration) {
+	if h.config.Percentile == 0 {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(h.latencies) < hedgeLatencySamples {
+		h.latencies = append(h.latencies, latency)
+		return
+	}
+
+	h.latencies[h.next] = latency
+	h.next = (h.next + 1) % hedgeLatencySamples
+}
+
+func (h *hedger) delay() time.Duration {
+	if h.config.Percentile == 0 {
+		return h.config.Delay
+	}
+
+	h.mu.Lock()
+	if len(h.latencies) < h.config.MinSamples {
+		h.mu.Unlock()
+		return h.config.Delay
+	}
+	sorted := make([]time.Duration, len(h.latencies))
+	copy(sorted, h.latencies)
+	h.mu.Unlock()
+
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	i := int(h.config.Percentile * float64(len(sorted)))
+	if i >= len(sorted) {
+		i = len(sorted) - 1
+	}
+	return sorted[i]
+}
+
+// hedgeAttempt is a single copy of a hedged request
+type hedgeAttempt struct {
+	cancel context.CancelFunc
+	err    error
+}
+
+// hedgeRace decides which attempt's frames are passed on. The first attempt to receive a frame wins
+// and the others are cancelled
+type hedgeRace struct {
+	mu       sync.Mutex
+	attempts []*hedgeAttempt
+	winner   *hedgeAttempt
+}
+
+// add adds an attempt to the race. It returns false if the race has already been won
+func (h *hedgeRace) add(a *hedgeAttempt) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.winner != nil {
+		return false
+	}
+	h.attempts = append(h.attempts, a)
+	return true
+}
+
+// claim returns whether a's frames are passed on, making a the winner if there isn't one yet
+func (h *hedgeRace) claim(a *hedgeAttempt) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.winner == nil {
+		h.winner = a
+		for _, other := range h.attempts {
+			if other != a {
+				other.cancel()
+			}
+		}
+	}
+	return h.winner == a
+}
+
+func (h *hedgeRace) won(a *hedgeAttempt) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.winner == a
+}
+
+// processHedged sends r and, if it hasn't completed within the hedge delay, a duplicate to a different host.
+// The first attempt to receive a frame streams its frames to onResponse and the other is cancelled.
+//
+// Gremlin Server has no way to cancel a request, so cancelling the losing attempt closes its
+// connection and the pool dials a replacement. Once frames have been passed on the winner's error,
+// if any, is returned because the other attempt can't continue where it left off.
+func (c *Cluster) processHedged(ctx context.Context, pool *connPool, r Request, onResponse ...OnResponse) error {
+	primary, err := c.getConn(ctx, pool, "", true)
+	if err != nil {
+		return err
+	}
+	setRequestHost(ctx, primary.addr)
+
+	start := c.clock.Now()
+	results := make(chan *hedgeAttempt, 2)
+	race := &hedgeRace{}
+
+	c.startHedgeAttempt(ctx, primary, r, race, results, onResponse)
+	pending := 1
+
+	hedgeTimer := c.clock.After(c.hedge.delay())
+
+	var firstErr error
+	for {
+		select {
+		case <-hedgeTimer:
+			hedgeTimer = nil
+
+			// Only hedge if another host is available right now
+			conn, err := c.getConn(ctx, pool, primary.addr, false)
+			if err == nil {
+				if !c.startHedgeAttempt(ctx, conn, r, race, results, onResponse) {
+					continue
+				}
+				SpanFromContext(ctx).AddEvent("hedge", Attribute{Key: AttributeHost, Value: conn.addr})
+				pending++
+			}
+		case a := <-results:
+			pending--
+
+			if race.won(a) {
+				if a.err == nil {
+					c.hedge.observe(c.clock.Now().Sub(start))
+				}
+				return a.err
+			}
+
+			if firstErr == nil {
+				firstErr = a.err
+			}
+
+			// Hedging isn't a retry; a failure before the duplicate is sent is returned as is
+			if pending == 0 {
+				return firstErr
+			}
+		}
+	}
+}
+
+// startHedgeAttempt runs r on conn in the background, passing its frames to onResponse if it wins the race.
+// It returns false, and returns conn to the pool, if the race has already been won
+func (c *Cluster) startHedgeAttempt(ctx context.Context, conn *Conn, r Request, race *hedgeRace, results chan<- *hedgeAttempt, onResponse []OnResponse) bool {
+	ctx, cancel := context.WithCancel(ctx)
+	a := &hedgeAttempt{cancel: cancel}
+	if !race.add(a) {
+		cancel()
+		c.putConn(conn, nil)
+		c.record(conn.addr, 0, context.Canceled)
+		return false
+	}
+
+	// The attempt may outlive ProcessRequest, so Shutdown needs to wait for it too
+	c.inflight.Add(1)
+
+	go func() {
+		defer c.inflight.Done()
+		defer cancel()
+
+		start := c.clock.Now()
+
+		a.err = c.roundTrip(ctx, conn, r, func(resp *Response) {
+			if !race.claim(a) {
+				return
+			}
+			setRequestHost(ctx, conn.addr)
+			for _, or := range onResponse {
+				or(resp)
+			}
+		})
+		c.record(conn.addr, c.clock.Now().Sub(start), a.err)
+
+		results <- a
+	}()
+	return true
+}
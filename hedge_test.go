@@ -0,0 +1,132 @@
+package grmln
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestHedgeDelay(t *testing.T) {
+	h := newHedger(HedgeConfig{
+		Delay:      time.Second,
+		Percentile: 0.9,
+		MinSamples: 10,
+	})
+
+	for i := 1; i < 10; i++ {
+		h.observe(time.Duration(i) * time.Millisecond)
+	}
+
+	if d := h.delay(); d != time.Second {
+		t.Fatalf("expected fixed delay before min samples but got %v", d)
+	}
+
+	for i := 10; i <= 100; i++ {
+		h.observe(time.Duration(i) * time.Millisecond)
+	}
+
+	if d := h.delay(); d != 91*time.Millisecond {
+		t.Fatalf("expected 91ms but got %v", d)
+	}
+}
+
+func TestIsIdempotent(t *testing.T) {
+	c := &Cluster{detectReadOnly: true}
+	ctx := WithIdempotent(context.Background(), true)
+
+	if !c.isIdempotent(ctx, NewRequest("", processorDefault, opEval, EvalArgs{Gremlin: "g.addV()"})) {
+		t.Fatal("expected a request marked idempotent to be hedged")
+	}
+
+	// Session state lives on one host
+	session := NewRequest("", processorSession, opEval, SessionEvalArgs{SessionArgs: SessionArgs{Session: "s"}})
+	if c.isIdempotent(ctx, session) || c.isIdempotent(WithReadOnly(context.Background(), true), session) {
+		t.Fatal("expected session requests never to be hedged")
+	}
+}
+
+// TestProcessHedged ensures the hedge streams the first response to arrive and cancels the other attempt
+func TestProcessHedged(t *testing.T) {
+	abandoned := make(chan struct{})
+	release := make(chan struct{})
+	var requests int32
+
+	upgrader := websocket.Upgrader{}
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer ws.Close()
+
+		for {
+			_, frame, err := ws.ReadMessage()
+			if err != nil {
+				return
+			}
+			var req Request
+			if err := json.Unmarshal(frame[int(frame[0])+1:], &req); err != nil {
+				t.Errorf("unexpected error: %v", err)
+				return
+			}
+
+			// The first request never completes. The client closes its connection once the hedge wins
+			if atomic.AddInt32(&requests, 1) == 1 {
+				ws.ReadMessage()
+				close(abandoned)
+				return
+			}
+
+			ws.WriteJSON(Response{RequestID: req.RequestID, Status: ResponseStatus{Code: StatusPartialContent}, Result: ResponseResult{Data: json.RawMessage("[1]")}})
+			select {
+			case <-release:
+			case <-time.After(time.Second):
+			}
+			ws.WriteJSON(Response{RequestID: req.RequestID, Status: ResponseStatus{Code: StatusSuccess}, Result: ResponseResult{Data: json.RawMessage("[2]")}})
+		}
+	}))
+	defer s.Close()
+
+	// The paths make two hosts on one server
+	addr := "ws" + strings.TrimPrefix(s.URL, "http")
+	c := NewCluster(ClusterConfig{Hedge: &HedgeConfig{Delay: time.Millisecond * 20}}, addr+"/a", addr+"/b")
+	defer c.Close()
+
+	for len(c.writers.conns) < 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	var data []string
+	start := time.Now()
+	err := c.processHedged(ctx, c.writers, NewRequest("", processorDefault, opEval, EvalArgs{Gremlin: "g.V()"}), func(resp *Response) {
+		if len(data) == 0 {
+			close(release)
+		}
+		data = append(data, string(resp.Result.Data))
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Join(data, ",") != "[1],[2]" {
+		t.Fatalf("expected both frames but got %v", data)
+	}
+	if elapsed := time.Since(start); elapsed > time.Millisecond*500 {
+		t.Fatalf("expected the first frame to be passed on before the response completed but it took %v", elapsed)
+	}
+
+	select {
+	case <-abandoned:
+	case <-time.After(time.Second):
+		t.Fatal("expected the losing attempt's connection to be closed")
+	}
+}
@@ -0,0 +1,140 @@
+package grmln
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+)
+
+// RedactedValue replaces binding values that are not allowed to be logged
+const RedactedValue = "[REDACTED]"
+
+// LogLevel is the severity of a log entry
+type LogLevel int
+
+// Log levels
+const (
+	LogDebug LogLevel = iota
+	LogInfo
+	LogWarn
+	LogError
+)
+
+var logLevelStrings = map[LogLevel]string{
+	LogDebug: "DEBUG",
+	LogInfo:  "INFO",
+	LogWarn:  "WARN",
+	LogError: "ERROR",
+}
+
+func (l LogLevel) String() string {
+	str, ok := logLevelStrings[l]
+	if !ok {
+		return fmt.Sprintf("LEVEL(%d)", l)
+	}
+
+	return str
+}
+
+// Logger is a leveled, structured logger. keyvals are alternating keys and values
+type Logger interface {
+	Log(level LogLevel, msg string, keyvals ...interface{})
+}
+
+type noopLogger struct{}
+
+func (noopLogger) Log(level LogLevel, msg string, keyvals ...interface{}) {}
+
+// StdLogger adapts a *log.Logger to Logger, writing entries at or above MinLevel as "LEVEL msg key=value..."
+type StdLogger struct {
+	Logger   *log.Logger
+	MinLevel LogLevel
+}
+
+// Log implements Logger
+func (l StdLogger) Log(level LogLevel, msg string, keyvals ...interface{}) {
+	if level < l.MinLevel {
+		return
+	}
+
+	var b strings.Builder
+	b.WriteString(level.String())
+	b.WriteByte(' ')
+	b.WriteString(msg)
+	for i := 0; i < len(keyvals); i += 2 {
+		var v interface{} = "(missing)"
+		if i+1 < len(keyvals) {
+			v = keyvals[i+1]
+		}
+		fmt.Fprintf(&b, " %v=%q", keyvals[i], fmt.Sprint(v))
+	}
+
+	logger := l.Logger
+	if logger == nil {
+		logger = log.New(log.Writer(), "", log.LstdFlags)
+	}
+	logger.Print(b.String())
+}
+
+// RedactBindings returns a copy of bindings with every value not in allow replaced by RedactedValue
+func RedactBindings(bindings Bindings, allow []string) Bindings {
+	if bindings == nil {
+		return nil
+	}
+
+	redacted := make(Bindings, len(bindings))
+	for k, v := range bindings {
+		redacted[k] = RedactedValue
+		for _, a := range allow {
+			if a == k {
+				redacted[k] = v
+				break
+			}
+		}
+	}
+	return redacted
+}
+
+type requestInfoKey struct{}
+
+// requestInfo collects details about a request from the processors that handle it
+type requestInfo struct {
+	mu   sync.Mutex
+	host string
+}
+
+func withRequestInfo(ctx context.Context) (context.Context, *requestInfo) {
+	info := &requestInfo{}
+	return context.WithValue(ctx, requestInfoKey{}, info), info
+}
+
+func (i *requestInfo) Host() string {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.host
+}
+
+// setRequestHost records the host serving the request in ctx, for spans and logs
+func setRequestHost(ctx context.Context, addr string) {
+	SpanFromContext(ctx).SetAttributes(Attribute{Key: AttributeHost, Value: addr})
+
+	if info, ok := ctx.Value(requestInfoKey{}).(*requestInfo); ok {
+		info.mu.Lock()
+		info.host = addr
+		info.mu.Unlock()
+	}
+}
+
+// logEvent logs cluster events
+func logEvent(logger Logger, e Event) {
+	switch e := e.(type) {
+	case HostGaveUpEvent:
+		logger.Log(LogError, "gave up connecting to host", "addr", e.Addr, "attempts", e.Attempts, "error", e.Err)
+	case BreakerStateEvent:
+		logger.Log(LogWarn, "circuit breaker state changed", "addr", e.Addr, "from", e.From, "to", e.To)
+	case FailoverEvent:
+		logger.Log(LogWarn, "failed over", "from", e.From, "to", e.To)
+	}
+}
@@ -0,0 +1,92 @@
+package grmln
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+type logEntry struct {
+	level   LogLevel
+	msg     string
+	keyvals map[string]interface{}
+}
+
+type captureLogger struct {
+	mu      sync.Mutex
+	entries []logEntry
+}
+
+func (l *captureLogger) Log(level LogLevel, msg string, keyvals ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	m := map[string]interface{}{}
+	for i := 0; i+1 < len(keyvals); i += 2 {
+		m[keyvals[i].(string)] = keyvals[i+1]
+	}
+	l.entries = append(l.entries, logEntry{level: level, msg: msg, keyvals: m})
+}
+
+func (l *captureLogger) find(msg string) (logEntry, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, e := range l.entries {
+		if e.msg == msg {
+			return e, true
+		}
+	}
+	return logEntry{}, false
+}
+
+func TestRedactBindings(t *testing.T) {
+	redacted := RedactBindings(Bindings{"id": 1, "ssn": "123-45-6789"}, []string{"id"})
+
+	if redacted["id"] != 1 {
+		t.Errorf("expected allowed binding to be kept but got %v", redacted["id"])
+	}
+	if redacted["ssn"] != RedactedValue {
+		t.Errorf("expected binding to be redacted but got %v", redacted["ssn"])
+	}
+}
+
+func TestOperatorSlowQueryLog(t *testing.T) {
+	logger := &captureLogger{}
+
+	slow := RequestProcessorFunc(func(ctx context.Context, r Request, onResponse ...OnResponse) error {
+		setRequestHost(ctx, "ws://slow:8182/gremlin")
+		time.Sleep(time.Millisecond * 10)
+		return respondWith("a").ProcessRequest(ctx, r, onResponse...)
+	})
+
+	op := NewOperator(slow)
+	op.Logger = logger
+	op.LogBindings = []string{"name"}
+	op.SlowQueryThreshold = time.Millisecond * 5
+
+	if err := op.EvalDefault(context.Background(), "g.V().has('name', name).has('secret', secret)", Bindings{"name": "marko", "secret": "hunter2"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	entry, ok := logger.find("slow query")
+	if !ok {
+		t.Fatal("expected slow query to be logged")
+	}
+
+	if entry.level != LogWarn {
+		t.Errorf("expected %v but got %v", LogWarn, entry.level)
+	}
+	if entry.keyvals["host"] != "ws://slow:8182/gremlin" {
+		t.Errorf("expected host to be logged but got %v", entry.keyvals["host"])
+	}
+	if entry.keyvals["frames"] != 2 {
+		t.Errorf("expected 2 frames but got %v", entry.keyvals["frames"])
+	}
+
+	bindings := entry.keyvals["bindings"].(Bindings)
+	if bindings["name"] != "marko" || bindings["secret"] != RedactedValue {
+		t.Errorf("unexpected bindings %v", bindings)
+	}
+}
@@ -0,0 +1,38 @@
+package grmln
+
+import "time"
+
+// Metrics collects metrics from connections and clusters. Implementations must be safe for concurrent use and fast
+type Metrics interface {
+	// RequestCompleted is called when a request completes. status is the status of the final
+	// frame or error response, or 0 if the request failed without a response
+	RequestCompleted(addr, op string, status StatusCode, latency time.Duration)
+
+	// ResponseFrames is called with the number of frames received for each request
+	ResponseFrames(op string, frames int)
+
+	// BytesSent is called after each websocket message is written
+	BytesSent(addr string, n int)
+
+	// BytesReceived is called after each websocket message is read
+	BytesReceived(addr string, n int)
+
+	// PoolSize is called with the number of established connections to a host whenever it changes
+	PoolSize(addr string, connections int)
+
+	// ConnectAttempt is called after every cluster connection attempt. err is nil if it succeeded
+	ConnectAttempt(addr string, err error)
+
+	// AuthRoundTrip is called after answering an authentication challenge
+	AuthRoundTrip(addr string, latency time.Duration, err error)
+}
+
+type noopMetrics struct{}
+
+func (noopMetrics) RequestCompleted(addr, op string, status StatusCode, latency time.Duration) {}
+func (noopMetrics) ResponseFrames(op string, frames int)                                       {}
+func (noopMetrics) BytesSent(addr string, n int)                                               {}
+func (noopMetrics) BytesReceived(addr string, n int)                                           {}
+func (noopMetrics) PoolSize(addr string, connections int)                                      {}
+func (noopMetrics) ConnectAttempt(addr string, err error)                                      {}
+func (noopMetrics) AuthRoundTrip(addr string, latency time.Duration, err error)                {}
@@ -0,0 +1,184 @@
+package grmln
+
+import (
+	"context"
+	"time"
+)
+
+// Retry defaults
+const (
+	DefaultRetryMaxAttempts = 3
+)
+
+// Middleware wraps a RequestProcessor with additional behavior
+type Middleware func(RequestProcessor) RequestProcessor
+
+// RequestProcessorFunc adapts an ordinary function to a RequestProcessor
+type RequestProcessorFunc func(ctx context.Context, r Request, onResponse ...OnResponse) error
+
+// ProcessRequest calls f
+func (f RequestProcessorFunc) ProcessRequest(ctx context.Context, r Request, onResponse ...OnResponse) error {
+	return f(ctx, r, onResponse...)
+}
+
+// Chain wraps p with middlewares. The first middleware is the outermost, so it sees requests first and responses last
+func Chain(p RequestProcessor, middlewares ...Middleware) RequestProcessor {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		p = middlewares[i](p)
+	}
+	return p
+}
+
+type (
+	// RequestInterceptor can inspect or modify a request before it is sent. Returning an error aborts the request
+	RequestInterceptor func(ctx context.Context, r *Request) error
+
+	// ResponseInterceptor can inspect or modify each response frame before it is passed on
+	ResponseInterceptor func(ctx context.Context, r Request, resp *Response)
+)
+
+// Intercept returns a middleware that calls onRequest before every request and onResponse for every response frame. Either may be nil
+func Intercept(onRequest RequestInterceptor, onResponse ResponseInterceptor) Middleware {
+	return func(next RequestProcessor) RequestProcessor {
+		return RequestProcessorFunc(func(ctx context.Context, r Request, ors ...OnResponse) error {
+			if onRequest != nil {
+				if err := onRequest(ctx, &r); err != nil {
+					return err
+				}
+			}
+
+			if onResponse == nil {
+				return next.ProcessRequest(ctx, r, ors...)
+			}
+
+			return next.ProcessRequest(ctx, r, func(resp *Response) {
+				onResponse(ctx, r, resp)
+				for _, or := range ors {
+					or(resp)
+				}
+			})
+		})
+	}
+}
+
+// RequestStats describes a completed request
+type RequestStats struct {
+	Request  Request
+	Duration time.Duration
+	Frames   int
+	Err      error
+}
+
+// Timing returns a middleware that calls onComplete with stats about every request once it completes
+func Timing(onComplete func(stats RequestStats)) Middleware {
+	return func(next RequestProcessor) RequestProcessor {
+		return RequestProcessorFunc(func(ctx context.Context, r Request, ors ...OnResponse) error {
+			stats := RequestStats{Request: r}
+
+			start := time.Now()
+			stats.Err = next.ProcessRequest(ctx, r, func(resp *Response) {
+				stats.Frames++
+				for _, or := range ors {
+					or(resp)
+				}
+			})
+			stats.Duration = time.Since(start)
+
+			onComplete(stats)
+			return stats.Err
+		})
+	}
+}
+
+// Logging returns a middleware that logs every request with logf (e.g. log.Printf)
+func Logging(logf func(format string, args ...interface{})) Middleware {
+	return Timing(func(stats RequestStats) {
+		if stats.Err != nil {
+			logf("grmln: %s %s request %s failed after %v: %v", stats.Request.Processor, stats.Request.Operation, stats.Request.RequestID, stats.Duration, stats.Err)
+			return
+		}
+		logf("grmln: %s %s request %s completed in %v (%d frames)", stats.Request.Processor, stats.Request.Operation, stats.Request.RequestID, stats.Duration, stats.Frames)
+	})
+}
+
+// RetryConfig configures the Retry middleware
+type RetryConfig struct {
+	// MaxAttempts is the maximum number of times a request is sent. Defaults to 3
+	MaxAttempts int
+
+	// Backoff decides how long to wait between attempts. Defaults to DecorrelatedJitterBackoff using the cluster defaults
+	Backoff Backoff
+
+	// Retryable decides whether an error can be retried. Defaults to server errors, server timeouts, and connection
+	// errors, but only for requests that are marked idempotent or read-only (see WithIdempotent and WithReadOnly)
+	// or that failed before they were sent, so writes never run twice
+	Retryable func(err error) bool
+}
+
+// Retry returns a middleware that retries failed requests. A request is only retried if no
+// response frames were passed on, so callers never see a partial result twice.
+func Retry(config RetryConfig) Middleware {
+	if config.MaxAttempts == 0 {
+		config.MaxAttempts = DefaultRetryMaxAttempts
+	}
+
+	if config.Backoff == nil {
+		config.Backoff = DecorrelatedJitterBackoff{
+			Base: DefaultBackoffBase,
+			Max:  DefaultBackoffMax,
+		}
+	}
+
+	return func(next RequestProcessor) RequestProcessor {
+		return RequestProcessorFunc(func(ctx context.Context, r Request, ors ...OnResponse) error {
+			retryable := config.Retryable
+			if retryable == nil {
+				retryable = func(err error) bool {
+					return defaultRetryable(ctx, err)
+				}
+			}
+
+			var sleep time.Duration
+			for attempts := 1; ; attempts++ {
+				delivered := false
+				err := next.ProcessRequest(ctx, r, func(resp *Response) {
+					delivered = true
+					for _, or := range ors {
+						or(resp)
+					}
+				})
+				if err == nil || delivered || attempts >= config.MaxAttempts || !retryable(err) {
+					return err
+				}
+
+				var retry bool
+				sleep, retry = config.Backoff.Next(attempts, sleep)
+				if !retry {
+					return err
+				}
+
+				select {
+				case <-ctx.Done():
+					return err
+				case <-time.After(sleep):
+				}
+			}
+		})
+	}
+}
+
+// defaultRetryable retries host failures of requests that are safe to send again
+func defaultRetryable(ctx context.Context, err error) bool {
+	if IsClusterClosed(err) || err == context.Canceled || err == context.DeadlineExceeded || !isHostFailure(err) {
+		return false
+	}
+	return notSent(err) || markedIdempotent(ctx)
+}
+
+// notSent returns whether err happened before the request reached a server
+func notSent(err error) bool {
+	if _, ok := err.(sendError); ok {
+		return true
+	}
+	return IsNoHostsAvailable(err)
+}
@@ -0,0 +1,99 @@
+package grmln
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestChainOrder(t *testing.T) {
+	var order []string
+	trace := func(name string) Middleware {
+		return Intercept(
+			func(ctx context.Context, r *Request) error {
+				order = append(order, name+" request")
+				return nil
+			},
+			func(ctx context.Context, r Request, resp *Response) {
+				order = append(order, name+" response")
+			},
+		)
+	}
+
+	p := Chain(respondWith("a"), trace("outer"), trace("inner"))
+	if err := p.ProcessRequest(context.Background(), Request{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []string{"outer request", "inner request", "inner response", "outer response", "inner response", "outer response"}
+	if len(order) != len(expected) {
+		t.Fatalf("expected %v but got %v", expected, order)
+	}
+	for i := range expected {
+		if order[i] != expected[i] {
+			t.Fatalf("expected %v but got %v", expected, order)
+		}
+	}
+}
+
+func TestRetry(t *testing.T) {
+	attempts := 0
+	flaky := RequestProcessorFunc(func(ctx context.Context, r Request, onResponse ...OnResponse) error {
+		attempts++
+		if attempts < 3 {
+			return errors.New("connection reset")
+		}
+		return respondWith("ok").ProcessRequest(ctx, r, onResponse...)
+	})
+
+	p := Chain(flaky, Retry(RetryConfig{Backoff: ConstantBackoff{Delay: time.Millisecond}}))
+	if err := p.ProcessRequest(WithIdempotent(context.Background(), true), Request{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if attempts != 3 {
+		t.Fatalf("expected 3 attempts but got %d", attempts)
+	}
+
+	// A write that may have reached the server is not sent again
+	attempts = 0
+	write := NewRequest("", processorDefault, opEval, EvalArgs{Gremlin: "g.addV('person')"})
+	if err := p.ProcessRequest(context.Background(), write); err == nil || err.Error() != "connection reset" {
+		t.Fatalf("expected connection reset but got %v", err)
+	}
+	if attempts != 1 {
+		t.Fatalf("expected a write not to be retried but got %d attempts", attempts)
+	}
+
+	// A request that was never sent is retried even if it's a write
+	attempts = 0
+	unsent := RequestProcessorFunc(func(ctx context.Context, r Request, onResponse ...OnResponse) error {
+		attempts++
+		if attempts < 2 {
+			return sendError{errors.New("broken pipe")}
+		}
+		return respondWith("ok").ProcessRequest(ctx, r, onResponse...)
+	})
+	p = Chain(unsent, Retry(RetryConfig{Backoff: ConstantBackoff{Delay: time.Millisecond}}))
+	if err := p.ProcessRequest(context.Background(), write); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if attempts != 2 {
+		t.Fatalf("expected 2 attempts but got %d", attempts)
+	}
+
+	attempts = 0
+	scriptError := responseError{response: Response{Status: ResponseStatus{Code: StatusScriptEvaluationError}}}
+	failing := RequestProcessorFunc(func(ctx context.Context, r Request, onResponse ...OnResponse) error {
+		attempts++
+		return scriptError
+	})
+
+	p = Chain(failing, Retry(RetryConfig{Backoff: ConstantBackoff{Delay: time.Millisecond}}))
+	if err := p.ProcessRequest(context.Background(), Request{}); !IsScriptEvaluationError(err) {
+		t.Fatalf("expected script evaluation error but got %v", err)
+	}
+	if attempts != 1 {
+		t.Fatalf("expected script errors not to be retried but got %d attempts", attempts)
+	}
+}
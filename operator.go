@@ -38,6 +38,56 @@ type OperatorConfig struct {
 
 	// DefaultBatchSize is the default size of batched responses. 0 uses server default
 	DefaultBatchSize int
+
+	// Logger logs every request. Binding values are redacted unless their key is in LogBindings. Defaults to no logging
+	Logger Logger
+
+	// LogBindings are the binding keys whose values may be logged
+	LogBindings []string
+
+	// SlowQueryThreshold logs evals that take at least this long as slow queries. 0 disables the slow query log
+	SlowQueryThreshold time.Duration
+}
+
+func (o OperatorConfig) logger() Logger {
+	if o.Logger == nil {
+		return noopLogger{}
+	}
+	return o.Logger
+}
+
+// process sends r to p, logging the request and any slow queries
+func (o OperatorConfig) process(ctx context.Context, p RequestProcessor, r Request, onResponse ...OnResponse) error {
+	logger := o.logger()
+
+	keyvals := []interface{}{"request_id", r.RequestID, "processor", r.Processor, "op", r.Operation}
+	gremlin, isEval := requestGremlin(r)
+	if isEval {
+		keyvals = append(keyvals, "gremlin", gremlin, "bindings", RedactBindings(requestBindings(r), o.LogBindings))
+	}
+
+	logger.Log(LogDebug, "sending request", keyvals...)
+
+	ctx, info := withRequestInfo(ctx)
+	frames := 0
+	start := time.Now()
+
+	err := p.ProcessRequest(ctx, r, withOnResponse(onResponse, func(*Response) { frames++ })...)
+
+	duration := time.Since(start)
+	keyvals = append(keyvals, "host", info.Host(), "frames", frames, "duration", duration)
+
+	if isEval && o.SlowQueryThreshold > 0 && duration >= o.SlowQueryThreshold {
+		logger.Log(LogWarn, "slow query", keyvals...)
+	}
+
+	if err != nil {
+		logger.Log(LogError, "request failed", append(keyvals, "error", err)...)
+		return err
+	}
+
+	logger.Log(LogDebug, "request completed", keyvals...)
+	return nil
 }
 
 func (o OperatorConfig) evalArgs(gremlin string, bindings Bindings) EvalArgs {
@@ -82,7 +132,7 @@ func (o *Operator) NewSession() *SessionOperator {
 
 // Eval evaluates a gremlin statement
 func (o *Operator) Eval(ctx context.Context, args EvalArgs, onResponse ...OnResponse) error {
-	return o.p.ProcessRequest(ctx, NewRequest("", processorDefault, opEval, args), onResponse...)
+	return o.process(ctx, o.p, NewRequest("", processorDefault, opEval, args), onResponse...)
 }
 
 // EvalDefault is a helper that calls Eval using the default argument values
@@ -107,7 +157,7 @@ func (o *SessionOperator) sessionArgs() SessionArgs {
 
 // Eval evaluates a gremlin statement
 func (o *SessionOperator) Eval(ctx context.Context, args TransactionEvalArgs, onResponse ...OnResponse) error {
-	return o.p.ProcessRequest(ctx, NewRequest("", processorSession, opEval, SessionEvalArgs{
+	return o.process(ctx, o.p, NewRequest("", processorSession, opEval, SessionEvalArgs{
 		SessionArgs:         o.sessionArgs(),
 		TransactionEvalArgs: args,
 	}), onResponse...)
@@ -126,7 +176,7 @@ func (o *SessionOperator) EvalDefault(ctx context.Context, gremlin string, bindi
 
 // Close closes the session
 func (o *SessionOperator) Close(ctx context.Context, args CloseArgs, onResponse ...OnResponse) error {
-	return o.p.ProcessRequest(ctx, NewRequest("", processorSession, opAuthentication,
+	return o.process(ctx, o.p, NewRequest("", processorSession, opClose,
 		SessionCloseArgs{
 			SessionArgs: o.sessionArgs(),
 			CloseArgs:   args,
@@ -135,7 +185,7 @@ func (o *SessionOperator) Close(ctx context.Context, args CloseArgs, onResponse
 
 // CloseDefault closes the session with default optionss
 func (o *SessionOperator) CloseDefault(ctx context.Context, onResponse ...OnResponse) error {
-	return o.p.ProcessRequest(ctx, NewRequest("", processorSession, opAuthentication,
+	return o.process(ctx, o.p, NewRequest("", processorSession, opClose,
 		SessionCloseArgs{
 			SessionArgs: o.sessionArgs(),
 		}), onResponse...)
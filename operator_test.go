@@ -0,0 +1,32 @@
+package grmln
+
+import (
+	"context"
+	"testing"
+)
+
+func TestSessionOperatorClose(t *testing.T) {
+	var requests []Request
+	p := RequestProcessorFunc(func(ctx context.Context, r Request, onResponse ...OnResponse) error {
+		requests = append(requests, r)
+		return nil
+	})
+
+	s := NewOperator(p).NewSession()
+	if err := s.Close(context.Background(), CloseArgs{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := s.CloseDefault(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(requests) != 2 {
+		t.Fatalf("expected 2 requests but got %d", len(requests))
+	}
+	for _, r := range requests {
+		args, ok := r.Arguments.(SessionCloseArgs)
+		if r.Operation != "close" || r.Processor != "session" || !ok || args.Session != s.session {
+			t.Fatalf("expected a session close request but got %+v", r)
+		}
+	}
+}
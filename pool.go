@@ -0,0 +1,29 @@
+package grmln
+
+// connPool is a pool of connections to a set of addresses. Its counters are guarded by the owning Cluster's mutex
+type connPool struct {
+	addrs []string
+	conns chan *Conn
+
+	// slots is the number of connections we are still trying to keep open
+	slots int
+	// connected is the number of connections currently established
+	connected int
+	// exhausted is closed once every slot has been given up on
+	exhausted chan struct{}
+}
+
+func newConnPool(addrs []string, connectionsPerAddress int) *connPool {
+	pool := &connPool{
+		addrs:     addrs,
+		conns:     make(chan *Conn, len(addrs)*connectionsPerAddress),
+		slots:     len(addrs) * connectionsPerAddress,
+		exhausted: make(chan struct{}),
+	}
+
+	if pool.slots == 0 {
+		close(pool.exhausted)
+	}
+
+	return pool
+}
@@ -0,0 +1,420 @@
+package grmln
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Profile environment variables. GRMLN_CONFIG and GRMLN_PROFILE select the profiles file and profile,
+// the rest override the profile's fields
+const (
+	EnvConfig  = "GRMLN_CONFIG"
+	EnvProfile = "GRMLN_PROFILE"
+)
+
+// mimeTypes are the short names accepted for mime types in profiles
+var mimeTypes = map[string]string{
+	"graphson1": "application/vnd.gremlin-v1.0+json",
+	"graphson2": "application/vnd.gremlin-v2.0+json",
+	"graphson3": "application/vnd.gremlin-v3.0+json",
+}
+
+// Profile is a named connection configuration: the addresses to connect to with the cluster and
+// operator configuration to use
+type Profile struct {
+	Name     string
+	Addrs    []string
+	Cluster  ClusterConfig
+	Operator OperatorConfig
+}
+
+// NewCluster creates a cluster connected to the profile's addresses
+func (p Profile) NewCluster() *Cluster {
+	return NewCluster(p.Cluster, p.Addrs...)
+}
+
+// NewOperator creates an operator using the profile's operator configuration
+func (p Profile) NewOperator(rp RequestProcessor) *Operator {
+	o := NewOperator(rp)
+	o.OperatorConfig = p.Operator
+	return o
+}
+
+// profilesFile is a profiles file. default names the profile used when none is given
+type profilesFile struct {
+	Default  string                   `json:"default" yaml:"default"`
+	Profiles map[string]profileFields `json:"profiles" yaml:"profiles"`
+}
+
+// profileFields are a profile as written in a profiles file. Durations are strings such as "5s"
+type profileFields struct {
+	Addrs       []string          `json:"addrs" yaml:"addrs"`
+	User        string            `json:"user" yaml:"user"`
+	Password    string            `json:"password" yaml:"password"`
+	Mime        string            `json:"mime" yaml:"mime"`
+	Pool        *int              `json:"pool" yaml:"pool"`
+	Headers     map[string]string `json:"headers" yaml:"headers"`
+	BackoffBase string            `json:"backoffBase" yaml:"backoffBase"`
+	BackoffMax  string            `json:"backoffMax" yaml:"backoffMax"`
+	Timeout     string            `json:"timeout" yaml:"timeout"`
+	Language    string            `json:"language" yaml:"language"`
+	Batch       *int              `json:"batch" yaml:"batch"`
+	SlowQuery   string            `json:"slowQuery" yaml:"slowQuery"`
+	LogBindings []string          `json:"logBindings" yaml:"logBindings"`
+	Breaker     *breakerFields    `json:"breaker" yaml:"breaker"`
+	Hedge       *hedgeFields      `json:"hedge" yaml:"hedge"`
+}
+
+// breakerFields are a profile's circuit breaker. The breaker is enabled when the section is present
+type breakerFields struct {
+	Window           string  `json:"window" yaml:"window"`
+	MinRequests      int     `json:"minRequests" yaml:"minRequests"`
+	ErrorRate        float64 `json:"errorRate" yaml:"errorRate"`
+	LatencyThreshold string  `json:"latencyThreshold" yaml:"latencyThreshold"`
+	SlowRate         float64 `json:"slowRate" yaml:"slowRate"`
+	OpenTimeout      string  `json:"openTimeout" yaml:"openTimeout"`
+	HalfOpenRequests int     `json:"halfOpenRequests" yaml:"halfOpenRequests"`
+}
+
+// hedgeFields are a profile's request hedging. Hedging is enabled when the section is present
+type hedgeFields struct {
+	Delay      string  `json:"delay" yaml:"delay"`
+	Percentile float64 `json:"percentile" yaml:"percentile"`
+	MinSamples int     `json:"minSamples" yaml:"minSamples"`
+}
+
+// profileError is a profile field with an invalid value. field is the name of the field in the
+// profiles file, or the environment variable the value came from
+type profileError struct {
+	profile string
+	field   string
+	err     error
+}
+
+func (e profileError) Error() string {
+	if e.profile == "" {
+		return fmt.Sprintf("%s: %v", e.field, e.err)
+	}
+	return fmt.Sprintf("profile %q: %s: %v", e.profile, e.field, e.err)
+}
+
+func (e profileError) IsInvalidProfile() bool {
+	return true
+}
+
+type invalidProfile interface {
+	IsInvalidProfile() bool
+}
+
+// IsInvalidProfile returns whether or not the error is because a profile field has an invalid value
+func IsInvalidProfile(err error) bool {
+	e, ok := err.(invalidProfile)
+	return ok && e.IsInvalidProfile()
+}
+
+// LoadProfile loads a connection profile. The profile is read from the YAML (.yaml or .yml) or JSON
+// profiles file at path, or the file named by GRMLN_CONFIG if path is empty. name selects the profile,
+// falling back to GRMLN_PROFILE, the file's default profile, and then its only profile. Without a file the
+// profile is built from the environment alone.
+//
+// Environment variables override the profile's fields: GRMLN_ADDRS (comma separated), GRMLN_USER,
+// GRMLN_PASSWORD, GRMLN_MIME, GRMLN_POOL, GRMLN_BACKOFF_BASE, GRMLN_BACKOFF_MAX, GRMLN_TIMEOUT,
+// GRMLN_LANGUAGE, GRMLN_BATCH, GRMLN_SLOW_QUERY and GRMLN_LOG_BINDINGS (comma separated).
+//
+// A profile file can enable a circuit breaker and hedging with breaker and hedge sections. Other
+// ClusterConfig fields, such as read/write routing and the function valued fields, can't be set from
+// a profile and are set on the returned Profile's Cluster
+func LoadProfile(path, name string) (Profile, error) {
+	return loadProfile(path, name, os.Getenv)
+}
+
+func loadProfile(path, name string, getenv func(string) string) (Profile, error) {
+	if path == "" {
+		path = getenv(EnvConfig)
+	}
+	if name == "" {
+		name = getenv(EnvProfile)
+	}
+
+	var fields profileFields
+	if path != "" {
+		file, err := readProfilesFile(path)
+		if err != nil {
+			return Profile{}, err
+		}
+
+		if name == "" {
+			name = file.Default
+		}
+		if name == "" && len(file.Profiles) == 1 {
+			for n := range file.Profiles {
+				name = n
+			}
+		}
+		if name == "" {
+			return Profile{}, fmt.Errorf("%s: no profile selected and no default profile", path)
+		}
+
+		var ok bool
+		if fields, ok = file.Profiles[name]; !ok {
+			return Profile{}, fmt.Errorf("%s: profile %q not found", path, name)
+		}
+	} else if name != "" {
+		return Profile{}, fmt.Errorf("profile %q requires a profiles file", name)
+	}
+
+	names := map[string]string{}
+	if err := fields.setEnv(name, getenv, names); err != nil {
+		return Profile{}, err
+	}
+	return fields.profile(name, names)
+}
+
+func readProfilesFile(path string) (profilesFile, error) {
+	var file profilesFile
+
+	f, err := os.Open(path)
+	if err != nil {
+		return file, err
+	}
+	defer f.Close()
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(f)
+		dec.KnownFields(true)
+		err = dec.Decode(&file)
+	default:
+		dec := json.NewDecoder(f)
+		dec.DisallowUnknownFields()
+		err = dec.Decode(&file)
+	}
+	if err != nil {
+		return file, fmt.Errorf("%s: %v", path, err)
+	}
+	return file, nil
+}
+
+// setEnv overrides fields with environment variables, recording which variable set each field in names
+func (f *profileFields) setEnv(profile string, getenv func(string) string, names map[string]string) error {
+	strs := []struct {
+		field, env string
+		value      *string
+	}{
+		{"user", "GRMLN_USER", &f.User},
+		{"password", "GRMLN_PASSWORD", &f.Password},
+		{"mime", "GRMLN_MIME", &f.Mime},
+		{"backoffBase", "GRMLN_BACKOFF_BASE", &f.BackoffBase},
+		{"backoffMax", "GRMLN_BACKOFF_MAX", &f.BackoffMax},
+		{"timeout", "GRMLN_TIMEOUT", &f.Timeout},
+		{"language", "GRMLN_LANGUAGE", &f.Language},
+		{"slowQuery", "GRMLN_SLOW_QUERY", &f.SlowQuery},
+	}
+	for _, s := range strs {
+		if v := getenv(s.env); v != "" {
+			*s.value = v
+			names[s.field] = s.env
+		}
+	}
+
+	lists := []struct {
+		field, env string
+		value      *[]string
+	}{
+		{"addrs", "GRMLN_ADDRS", &f.Addrs},
+		{"logBindings", "GRMLN_LOG_BINDINGS", &f.LogBindings},
+	}
+	for _, l := range lists {
+		if v := getenv(l.env); v != "" {
+			*l.value = splitList(v)
+			names[l.field] = l.env
+		}
+	}
+
+	ints := []struct {
+		field, env string
+		value      **int
+	}{
+		{"pool", "GRMLN_POOL", &f.Pool},
+		{"batch", "GRMLN_BATCH", &f.Batch},
+	}
+	for _, i := range ints {
+		v := getenv(i.env)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return profileError{profile, i.env, fmt.Errorf("%q is not an integer", v)}
+		}
+		*i.value = &n
+		names[i.field] = i.env
+	}
+	return nil
+}
+
+func splitList(s string) []string {
+	var list []string
+	for _, e := range strings.Split(s, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			list = append(list, e)
+		}
+	}
+	return list
+}
+
+// profile validates the fields and builds the profile. names maps fields to the environment variables that set them.
+// Nothing is returned with an error so a partly built profile can't leak the password
+func (f profileFields) profile(name string, names map[string]string) (Profile, error) {
+	invalid := func(field string, format string, args ...interface{}) error {
+		if env, ok := names[field]; ok {
+			field = env
+		}
+		return profileError{name, field, fmt.Errorf(format, args...)}
+	}
+
+	p := Profile{
+		Name:  name,
+		Addrs: f.Addrs,
+		Cluster: ClusterConfig{
+			UserName: f.User,
+			Password: f.Password,
+		},
+		Operator: NewOperator(nil).OperatorConfig,
+	}
+
+	if len(f.Addrs) == 0 {
+		return Profile{}, invalid("addrs", "at least one address is required")
+	}
+	for _, addr := range f.Addrs {
+		u, err := url.Parse(addr)
+		if err != nil || (u.Scheme != "ws" && u.Scheme != "wss") || u.Host == "" {
+			return Profile{}, invalid("addrs", "%q is not a ws:// or wss:// address", addr)
+		}
+	}
+
+	if f.Password != "" && f.User == "" {
+		return Profile{}, invalid("password", "a password requires a user")
+	}
+
+	if f.Mime != "" {
+		mime, ok := mimeTypes[f.Mime]
+		if !ok && !strings.Contains(f.Mime, "/") {
+			return Profile{}, invalid("mime", "unknown mime type %q", f.Mime)
+		}
+		if !ok {
+			mime = f.Mime
+		}
+		p.Cluster.MimeType = mime
+	}
+
+	if f.Pool != nil {
+		if *f.Pool < 1 {
+			return Profile{}, invalid("pool", "must be at least 1 but is %d", *f.Pool)
+		}
+		p.Cluster.ConnectionsPerAddress = *f.Pool
+	}
+
+	if f.Batch != nil {
+		if *f.Batch < 0 {
+			return Profile{}, invalid("batch", "must not be negative but is %d", *f.Batch)
+		}
+		p.Operator.DefaultBatchSize = *f.Batch
+	}
+
+	if len(f.Headers) > 0 {
+		p.Cluster.Headers = http.Header{}
+		for k, v := range f.Headers {
+			p.Cluster.Headers.Set(k, v)
+		}
+	}
+
+	if f.Language != "" {
+		p.Operator.DefaultEvalLanguage = f.Language
+	}
+	p.Operator.LogBindings = f.LogBindings
+
+	type duration struct {
+		field string
+		value string
+		d     *time.Duration
+	}
+	durations := []duration{
+		{"backoffBase", f.BackoffBase, &p.Cluster.BackoffBase},
+		{"backoffMax", f.BackoffMax, &p.Cluster.BackoffMax},
+		{"timeout", f.Timeout, &p.Operator.DefaultScriptEvaluationTimeout},
+		{"slowQuery", f.SlowQuery, &p.Operator.SlowQueryThreshold},
+	}
+	if f.Breaker != nil {
+		b := f.Breaker
+		p.Cluster.Breaker = &BreakerConfig{
+			MinRequests:      b.MinRequests,
+			ErrorRate:        b.ErrorRate,
+			SlowRate:         b.SlowRate,
+			HalfOpenRequests: b.HalfOpenRequests,
+		}
+		durations = append(durations,
+			duration{"breaker.window", b.Window, &p.Cluster.Breaker.Window},
+			duration{"breaker.latencyThreshold", b.LatencyThreshold, &p.Cluster.Breaker.LatencyThreshold},
+			duration{"breaker.openTimeout", b.OpenTimeout, &p.Cluster.Breaker.OpenTimeout})
+	}
+	if f.Hedge != nil {
+		p.Cluster.Hedge = &HedgeConfig{
+			Percentile: f.Hedge.Percentile,
+			MinSamples: f.Hedge.MinSamples,
+		}
+		durations = append(durations, duration{"hedge.delay", f.Hedge.Delay, &p.Cluster.Hedge.Delay})
+	}
+
+	for _, d := range durations {
+		if d.value == "" {
+			continue
+		}
+		v, err := time.ParseDuration(d.value)
+		if err != nil {
+			return Profile{}, invalid(d.field, "%q is not a duration", d.value)
+		}
+		if v < 0 {
+			return Profile{}, invalid(d.field, "must not be negative but is %v", v)
+		}
+		*d.d = v
+	}
+
+	if b := f.Breaker; b != nil {
+		switch {
+		case b.MinRequests < 0:
+			return Profile{}, invalid("breaker.minRequests", "must not be negative but is %d", b.MinRequests)
+		case b.HalfOpenRequests < 0:
+			return Profile{}, invalid("breaker.halfOpenRequests", "must not be negative but is %d", b.HalfOpenRequests)
+		case b.ErrorRate < 0 || b.ErrorRate > 1:
+			return Profile{}, invalid("breaker.errorRate", "must be between 0 and 1 but is %v", b.ErrorRate)
+		case b.SlowRate < 0 || b.SlowRate > 1:
+			return Profile{}, invalid("breaker.slowRate", "must be between 0 and 1 but is %v", b.SlowRate)
+		}
+	}
+	if h := f.Hedge; h != nil {
+		switch {
+		case p.Cluster.Hedge.Delay == 0:
+			return Profile{}, invalid("hedge.delay", "must be set")
+		case h.MinSamples < 0:
+			return Profile{}, invalid("hedge.minSamples", "must not be negative but is %d", h.MinSamples)
+		case h.Percentile < 0 || h.Percentile > 1:
+			return Profile{}, invalid("hedge.percentile", "must be between 0 and 1 but is %v", h.Percentile)
+		}
+	}
+
+	if p.Cluster.BackoffBase > 0 && p.Cluster.BackoffMax > 0 && p.Cluster.BackoffMax < p.Cluster.BackoffBase {
+		return Profile{}, invalid("backoffMax", "%v is less than backoffBase %v", p.Cluster.BackoffMax, p.Cluster.BackoffBase)
+	}
+
+	return p, nil
+}
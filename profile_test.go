@@ -0,0 +1,160 @@
+package grmln
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testProfilesYAML = `
+default: dev
+profiles:
+  dev:
+    addrs: [ws://localhost:8182/gremlin]
+  prod:
+    addrs:
+      - wss://host1:8182/gremlin
+      - wss://host2:8182/gremlin
+    user: app
+    password: secret
+    mime: graphson3
+    pool: 4
+    headers:
+      X-Tenant: blue
+    timeout: 5s
+    batch: 64
+    slowQuery: 1s
+    logBindings: [id]
+    breaker:
+      errorRate: 0.25
+      openTimeout: 1m
+    hedge:
+      delay: 50ms
+`
+
+func writeProfiles(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return path
+}
+
+func envFunc(env map[string]string) func(string) string {
+	return func(key string) string {
+		return env[key]
+	}
+}
+
+func TestLoadProfile(t *testing.T) {
+	path := writeProfiles(t, "profiles.yaml", testProfilesYAML)
+
+	p, err := loadProfile(path, "prod", envFunc(nil))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if p.Name != "prod" || strings.Join(p.Addrs, ",") != "wss://host1:8182/gremlin,wss://host2:8182/gremlin" {
+		t.Fatalf("unexpected profile %+v", p)
+	}
+	if p.Cluster.UserName != "app" || p.Cluster.Password != "secret" || p.Cluster.ConnectionsPerAddress != 4 {
+		t.Fatalf("unexpected cluster config %+v", p.Cluster)
+	}
+	if p.Cluster.MimeType != "application/vnd.gremlin-v3.0+json" || p.Cluster.Headers.Get("X-Tenant") != "blue" {
+		t.Fatalf("unexpected cluster config %+v", p.Cluster)
+	}
+	if p.Operator.DefaultScriptEvaluationTimeout != time.Second*5 || p.Operator.DefaultBatchSize != 64 ||
+		p.Operator.SlowQueryThreshold != time.Second || p.Operator.DefaultEvalLanguage != LanguageGremlinGroovy ||
+		strings.Join(p.Operator.LogBindings, ",") != "id" {
+		t.Fatalf("unexpected operator config %+v", p.Operator)
+	}
+	if b := p.Cluster.Breaker; b == nil || b.ErrorRate != 0.25 || b.OpenTimeout != time.Minute || b.Window != 0 {
+		t.Fatalf("unexpected breaker config %+v", b)
+	}
+	if h := p.Cluster.Hedge; h == nil || h.Delay != time.Millisecond*50 {
+		t.Fatalf("unexpected hedge config %+v", h)
+	}
+
+	// The default profile is used when none is named, and the environment overrides it
+	p, err = loadProfile(path, "", envFunc(map[string]string{"GRMLN_POOL": "2", "GRMLN_TIMEOUT": "10s"}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if p.Name != "dev" || p.Cluster.ConnectionsPerAddress != 2 || p.Operator.DefaultScriptEvaluationTimeout != time.Second*10 {
+		t.Fatalf("unexpected profile %+v", p)
+	}
+
+	// GRMLN_CONFIG and GRMLN_PROFILE select the file and profile
+	p, err = loadProfile("", "", envFunc(map[string]string{EnvConfig: path, EnvProfile: "prod"}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if p.Name != "prod" {
+		t.Fatalf("expected prod profile but got %q", p.Name)
+	}
+
+	// Without a file the environment is the whole profile
+	p, err = loadProfile("", "", envFunc(map[string]string{"GRMLN_ADDRS": "ws://a:8182/gremlin, ws://b:8182/gremlin", "GRMLN_MIME": "graphson2"}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(p.Addrs) != 2 || p.Cluster.MimeType != "application/vnd.gremlin-v2.0+json" {
+		t.Fatalf("unexpected profile %+v", p)
+	}
+
+	json := writeProfiles(t, "profiles.json", `{"profiles": {"only": {"addrs": ["ws://localhost:8182/gremlin"], "batch": 8}}}`)
+	p, err = loadProfile(json, "", envFunc(nil))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if p.Name != "only" || p.Operator.DefaultBatchSize != 8 {
+		t.Fatalf("unexpected profile %+v", p)
+	}
+}
+
+func TestLoadProfileErrors(t *testing.T) {
+	profile := func(fields string) string {
+		return "profiles:\n  p:\n    addrs: [ws://localhost:8182/gremlin]\n" + fields
+	}
+
+	tests := []struct {
+		name     string
+		content  string
+		env      map[string]string
+		expected string
+		invalid  bool
+	}{
+		{"no addrs", "profiles:\n  p:\n    user: me\n", nil, `profile "p": addrs: at least one address is required`, true},
+		{"bad addr", "profiles:\n  p:\n    addrs: [http://localhost]\n", nil, `profile "p": addrs: "http://localhost" is not a ws:// or wss:// address`, true},
+		{"pool", profile("    pool: 0\n"), nil, `profile "p": pool: must be at least 1 but is 0`, true},
+		{"timeout", profile("    timeout: soon\n"), nil, `profile "p": timeout: "soon" is not a duration`, true},
+		{"mime", profile("    mime: graphson9\n"), nil, `profile "p": mime: unknown mime type "graphson9"`, true},
+		{"password", profile("    password: secret\n"), nil, `profile "p": password: a password requires a user`, true},
+		{"backoff", profile("    backoffBase: 2s\n    backoffMax: 1s\n"), nil, `profile "p": backoffMax: 1s is less than backoffBase 2s`, true},
+		{"breaker rate", profile("    breaker:\n      errorRate: 2\n"), nil, `profile "p": breaker.errorRate: must be between 0 and 1 but is 2`, true},
+		{"hedge delay", profile("    hedge:\n      delay: soon\n"), nil, `profile "p": hedge.delay: "soon" is not a duration`, true},
+		{"hedge no delay", profile("    hedge:\n      percentile: 0.9\n"), nil, `profile "p": hedge.delay: must be set`, true},
+		{"env batch", profile(""), map[string]string{"GRMLN_BATCH": "lots"}, `profile "p": GRMLN_BATCH: "lots" is not an integer`, true},
+		{"env timeout", profile(""), map[string]string{"GRMLN_TIMEOUT": "-1s"}, `profile "p": GRMLN_TIMEOUT: must not be negative but is -1s`, true},
+		{"unknown field", profile("    poool: 2\n"), nil, "field poool not found", false},
+		{"missing profile", profile(""), map[string]string{EnvProfile: "q"}, `profile "q" not found`, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := writeProfiles(t, "profiles.yml", test.content)
+			_, err := loadProfile(path, "", envFunc(test.env))
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if !strings.Contains(err.Error(), test.expected) {
+				t.Fatalf("expected error containing %q but got %q", test.expected, err)
+			}
+			if IsInvalidProfile(err) != test.invalid {
+				t.Fatalf("expected IsInvalidProfile to be %v for %v", test.invalid, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,251 @@
+package grmln
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// latencyBuckets are the histogram buckets for latencies, in seconds
+	latencyBuckets = []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+	// frameBuckets are the histogram buckets for frames per response
+	frameBuckets = []float64{1, 2, 4, 8, 16, 32, 64, 128, 256}
+)
+
+// PrometheusMetrics collects metrics and serves them in the Prometheus text exposition format
+type PrometheusMetrics struct {
+	mu sync.Mutex
+
+	requestDuration map[string]*promHistogram
+	responseFrames  map[string]*promHistogram
+	authDuration    map[string]*promHistogram
+	bytesSent       map[string]float64
+	bytesReceived   map[string]float64
+	poolConnections map[string]float64
+	connectAttempts map[string]float64
+	connectFailures map[string]float64
+	authRoundTrips  map[string]float64
+	authFailures    map[string]float64
+}
+
+// NewPrometheusMetrics creates a new metrics collector that can be served with http.Handle
+func NewPrometheusMetrics() *PrometheusMetrics {
+	return &PrometheusMetrics{
+		requestDuration: map[string]*promHistogram{},
+		responseFrames:  map[string]*promHistogram{},
+		authDuration:    map[string]*promHistogram{},
+		bytesSent:       map[string]float64{},
+		bytesReceived:   map[string]float64{},
+		poolConnections: map[string]float64{},
+		connectAttempts: map[string]float64{},
+		connectFailures: map[string]float64{},
+		authRoundTrips:  map[string]float64{},
+		authFailures:    map[string]float64{},
+	}
+}
+
+type promHistogram struct {
+	buckets []float64
+	counts  []uint64
+	sum     float64
+	count   uint64
+}
+
+func (h *promHistogram) observe(v float64) {
+	for i, b := range h.buckets {
+		if v <= b {
+			h.counts[i]++
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+func promObserve(m map[string]*promHistogram, buckets []float64, labels string, v float64) {
+	h, ok := m[labels]
+	if !ok {
+		h = &promHistogram{buckets: buckets, counts: make([]uint64, len(buckets))}
+		m[labels] = h
+	}
+	h.observe(v)
+}
+
+// promLabelEscaper escapes label values. The text format only escapes backslash, double quote and newline
+var promLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// promLabels formats label pairs (name, value, name, value...) for exposition
+func promLabels(pairs ...string) string {
+	parts := make([]string, 0, len(pairs)/2)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		parts = append(parts, pairs[i]+`="`+promLabelEscaper.Replace(pairs[i+1])+`"`)
+	}
+	return strings.Join(parts, ",")
+}
+
+func statusLabel(status StatusCode) string {
+	if status == 0 {
+		return "error"
+	}
+	return strconv.Itoa(int(status))
+}
+
+// RequestCompleted implements Metrics
+func (m *PrometheusMetrics) RequestCompleted(addr, op string, status StatusCode, latency time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	promObserve(m.requestDuration, latencyBuckets, promLabels("host", addr, "op", op, "status", statusLabel(status)), latency.Seconds())
+}
+
+// ResponseFrames implements Metrics
+func (m *PrometheusMetrics) ResponseFrames(op string, frames int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	promObserve(m.responseFrames, frameBuckets, promLabels("op", op), float64(frames))
+}
+
+// BytesSent implements Metrics
+func (m *PrometheusMetrics) BytesSent(addr string, n int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.bytesSent[promLabels("host", addr)] += float64(n)
+}
+
+// BytesReceived implements Metrics
+func (m *PrometheusMetrics) BytesReceived(addr string, n int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.bytesReceived[promLabels("host", addr)] += float64(n)
+}
+
+// PoolSize implements Metrics
+func (m *PrometheusMetrics) PoolSize(addr string, connections int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.poolConnections[promLabels("host", addr)] = float64(connections)
+}
+
+// ConnectAttempt implements Metrics
+func (m *PrometheusMetrics) ConnectAttempt(addr string, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	l := promLabels("host", addr)
+	m.connectAttempts[l]++
+	if err != nil {
+		m.connectFailures[l]++
+	}
+}
+
+// AuthRoundTrip implements Metrics
+func (m *PrometheusMetrics) AuthRoundTrip(addr string, latency time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	l := promLabels("host", addr)
+	m.authRoundTrips[l]++
+	if err != nil {
+		m.authFailures[l]++
+	}
+	promObserve(m.authDuration, latencyBuckets, l, latency.Seconds())
+}
+
+// ServeHTTP writes every metric in the Prometheus text exposition format
+func (m *PrometheusMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	m.WriteTo(w)
+}
+
+// WriteTo writes every metric in the Prometheus text exposition format
+func (m *PrometheusMetrics) WriteTo(w io.Writer) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ew := &errWriter{w: w}
+
+	writeHistograms(ew, "grmln_request_duration_seconds", "Request latency by host, op and status.", m.requestDuration)
+	writeHistograms(ew, "grmln_response_frames", "Frames received per response.", m.responseFrames)
+	writeCounters(ew, "grmln_bytes_sent_total", "Bytes written to the websocket.", "counter", m.bytesSent)
+	writeCounters(ew, "grmln_bytes_received_total", "Bytes read from the websocket.", "counter", m.bytesReceived)
+	writeCounters(ew, "grmln_pool_connections", "Established connections per host.", "gauge", m.poolConnections)
+	writeCounters(ew, "grmln_connect_attempts_total", "Cluster connection attempts.", "counter", m.connectAttempts)
+	writeCounters(ew, "grmln_connect_failures_total", "Failed cluster connection attempts.", "counter", m.connectFailures)
+	writeCounters(ew, "grmln_auth_round_trips_total", "Authentication challenges answered.", "counter", m.authRoundTrips)
+	writeCounters(ew, "grmln_auth_failures_total", "Authentication challenges that failed.", "counter", m.authFailures)
+	writeHistograms(ew, "grmln_auth_duration_seconds", "Authentication round trip latency.", m.authDuration)
+
+	return ew.n, ew.err
+}
+
+// errWriter remembers the first error so metrics can be written without checking every write
+type errWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (w *errWriter) printf(format string, args ...interface{}) {
+	if w.err != nil {
+		return
+	}
+	n, err := fmt.Fprintf(w.w, format, args...)
+	w.n += int64(n)
+	w.err = err
+}
+
+func sortedKeys(m map[string]float64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func writeCounters(w *errWriter, name, help, kind string, m map[string]float64) {
+	if len(m) == 0 {
+		return
+	}
+
+	w.printf("# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+	for _, l := range sortedKeys(m) {
+		w.printf("%s{%s} %s\n", name, l, formatFloat(m[l]))
+	}
+}
+
+func writeHistograms(w *errWriter, name, help string, m map[string]*promHistogram) {
+	if len(m) == 0 {
+		return
+	}
+
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	w.printf("# HELP %s %s\n# TYPE %s histogram\n", name, help, name)
+	for _, l := range keys {
+		h := m[l]
+		for i, b := range h.buckets {
+			w.printf("%s_bucket{%s,le=%q} %d\n", name, l, formatFloat(b), h.counts[i])
+		}
+		w.printf("%s_bucket{%s,le=\"+Inf\"} %d\n", name, l, h.count)
+		w.printf("%s_sum{%s} %s\n", name, l, formatFloat(h.sum))
+		w.printf("%s_count{%s} %d\n", name, l, h.count)
+	}
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
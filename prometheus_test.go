@@ -0,0 +1,59 @@
+package grmln
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPrometheusMetrics(t *testing.T) {
+	m := NewPrometheusMetrics()
+
+	m.RequestCompleted("ws://a", opEval, StatusSuccess, time.Millisecond*3)
+	m.RequestCompleted("ws://a", opEval, 0, time.Second*20)
+	m.ResponseFrames(opEval, 3)
+	m.BytesSent("ws://a", 100)
+	m.BytesSent("ws://a", 50)
+	m.PoolSize("ws://a", 2)
+	m.ConnectAttempt("ws://a", nil)
+	m.ConnectAttempt("ws://a", errors.New("refused"))
+
+	w := httptest.NewRecorder()
+	m.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	body := w.Body.String()
+
+	expected := []string{
+		`# TYPE grmln_request_duration_seconds histogram`,
+		`grmln_request_duration_seconds_bucket{host="ws://a",op="eval",status="200",le="0.005"} 1`,
+		`grmln_request_duration_seconds_bucket{host="ws://a",op="eval",status="200",le="0.0025"} 0`,
+		`grmln_request_duration_seconds_bucket{host="ws://a",op="eval",status="error",le="+Inf"} 1`,
+		`grmln_request_duration_seconds_count{host="ws://a",op="eval",status="error"} 1`,
+		`grmln_response_frames_bucket{op="eval",le="4"} 1`,
+		`grmln_bytes_sent_total{host="ws://a"} 150`,
+		`# TYPE grmln_pool_connections gauge`,
+		`grmln_pool_connections{host="ws://a"} 2`,
+		`grmln_connect_attempts_total{host="ws://a"} 2`,
+		`grmln_connect_failures_total{host="ws://a"} 1`,
+	}
+
+	for _, line := range expected {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("expected output to contain %q:\n%s", line, body)
+		}
+	}
+}
+
+func TestPrometheusLabelEscaping(t *testing.T) {
+	m := NewPrometheusMetrics()
+	m.BytesSent("ws://a\"b\\c\td\né", 1)
+
+	w := httptest.NewRecorder()
+	m.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+
+	expected := `grmln_bytes_sent_total{host="ws://a\"b\\c` + "\t" + `d\né"} 1`
+	if !strings.Contains(w.Body.String(), expected+"\n") {
+		t.Fatalf("expected output to contain %q:\n%s", expected, w.Body.String())
+	}
+}
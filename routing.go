@@ -0,0 +1,90 @@
+package grmln
+
+import (
+	"context"
+	"regexp"
+)
+
+type readOnlyKey struct{}
+
+// mutatingStep matches the gremlin steps that modify the graph
+var mutatingStep = regexp.MustCompile(`\b(addV|addE|property|drop)\s*\(`)
+
+// NewReadWriteCluster creates a cluster that sends writes to the writer addresses and
+// read-only requests to the reader addresses. Requests are read-only when their context
+// is marked with WithReadOnly, or, with ClusterConfig.DetectReadOnly, when their script
+// has no mutating steps.
+func NewReadWriteCluster(config ClusterConfig, writers, readers []string) *Cluster {
+	if readers == nil {
+		readers = []string{}
+	}
+	return newCluster(config, writers, readers)
+}
+
+// WithReadOnly marks requests made with the returned context as read-only (or not), overriding detection
+func WithReadOnly(ctx context.Context, readOnly bool) context.Context {
+	return context.WithValue(ctx, readOnlyKey{}, readOnly)
+}
+
+func readOnlyFromContext(ctx context.Context) (readOnly, ok bool) {
+	readOnly, ok = ctx.Value(readOnlyKey{}).(bool)
+	return readOnly, ok
+}
+
+// IsMutating returns whether a gremlin script contains steps that modify the graph
+func IsMutating(gremlin string) bool {
+	return mutatingStep.MatchString(gremlin)
+}
+
+// requestGremlin returns the gremlin script of eval requests
+func requestGremlin(r Request) (string, bool) {
+	switch args := r.Arguments.(type) {
+	case EvalArgs:
+		return args.Gremlin, true
+	case TransactionEvalArgs:
+		return args.Gremlin, true
+	case SessionEvalArgs:
+		return args.Gremlin, true
+	}
+	return "", false
+}
+
+// requestBindings returns the bindings of eval requests
+func requestBindings(r Request) Bindings {
+	switch args := r.Arguments.(type) {
+	case EvalArgs:
+		return args.Bindings
+	case TransactionEvalArgs:
+		return args.Bindings
+	case SessionEvalArgs:
+		return args.Bindings
+	}
+	return nil
+}
+
+// isReadOnly returns whether r can be served by a reader
+func (c *Cluster) isReadOnly(ctx context.Context, r Request) bool {
+	if readOnly, ok := readOnlyFromContext(ctx); ok {
+		return readOnly
+	}
+
+	if !c.detectReadOnly || r.Processor == processorSession {
+		return false
+	}
+
+	gremlin, ok := requestGremlin(r)
+	return ok && !IsMutating(gremlin)
+}
+
+// route returns the pool that should serve r
+func (c *Cluster) route(ctx context.Context, r Request) *connPool {
+	if c.readers == nil || !c.isReadOnly(ctx, r) {
+		return c.writers
+	}
+
+	if c.readFallbackToWriter && !c.healthy(c.readers) {
+		return c.writers
+	}
+
+	return c.readers
+}
@@ -0,0 +1,56 @@
+package grmln
+
+import (
+	"context"
+	"testing"
+)
+
+func TestIsMutating(t *testing.T) {
+	tests := map[string]bool{
+		`g.V()`:                               false,
+		`g.V().properties('name')`:            false,
+		`g.V().has('name', 'property')`:       false,
+		`g.addV('person')`:                    true,
+		`g.V(1).addE('knows').to(g.V(2))`:     true,
+		`g.V(1).property('name', 'marko')`:    true,
+		`g.V().hasLabel('person').drop()`:     true,
+		`g.V(1).property (single, 'age', 29)`: true,
+	}
+
+	for gremlin, expected := range tests {
+		if actual := IsMutating(gremlin); actual != expected {
+			t.Errorf("%s: expected %v but got %v", gremlin, expected, actual)
+		}
+	}
+}
+
+func TestReadWriteRouting(t *testing.T) {
+	c := NewReadWriteCluster(ClusterConfig{
+		DetectReadOnly: true,
+	}, []string{"ws://127.0.0.1:1/writer"}, []string{"ws://127.0.0.1:1/reader"})
+	defer c.Close()
+
+	read := NewRequest("", processorDefault, opEval, EvalArgs{Gremlin: `g.V().count()`})
+	write := NewRequest("", processorDefault, opEval, EvalArgs{Gremlin: `g.addV('person')`})
+
+	ctx := context.Background()
+
+	if c.route(ctx, read) != c.readers {
+		t.Error("expected read to be routed to readers")
+	}
+	if c.route(ctx, write) != c.writers {
+		t.Error("expected write to be routed to writers")
+	}
+	if c.route(WithReadOnly(ctx, false), read) != c.writers {
+		t.Error("expected explicit read-write request to be routed to writers")
+	}
+	if c.route(WithReadOnly(ctx, true), write) != c.readers {
+		t.Error("expected explicit read-only request to be routed to readers")
+	}
+
+	// No reader has connected, so reads fall back to the writer when allowed
+	c.readFallbackToWriter = true
+	if c.route(ctx, read) != c.writers {
+		t.Error("expected read to fall back to writers")
+	}
+}
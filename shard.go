@@ -0,0 +1,237 @@
+package grmln
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// DefaultVirtualNodes is the default number of points each shard has on a hash ring
+const DefaultVirtualNodes = 64
+
+type (
+	shardKeyKey  struct{}
+	allShardsKey struct{}
+)
+
+// ShardFunc returns the name of the shard that owns key
+type ShardFunc func(key string) string
+
+// ShardRouterConfig configures a ShardRouter
+type ShardRouterConfig struct {
+	// ShardFunc maps shard keys to shard names. Defaults to a consistent hash ring over the shard names
+	ShardFunc ShardFunc
+
+	// BindingKey is the binding holding the shard key for requests whose context has none
+	BindingKey string
+
+	// VirtualNodes is the number of points each shard has on the default hash ring. Defaults to 64
+	VirtualNodes int
+}
+
+// WithShardKey sets the shard key for requests made with the returned context
+func WithShardKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, shardKeyKey{}, key)
+}
+
+// WithAllShards sends requests made with the returned context to every shard (scatter-gather)
+func WithAllShards(ctx context.Context) context.Context {
+	return context.WithValue(ctx, allShardsKey{}, true)
+}
+
+// ShardRouter routes requests to one of several independent graphs by shard key
+type ShardRouter struct {
+	shards     map[string]RequestProcessor
+	names      []string
+	shardFunc  ShardFunc
+	bindingKey string
+}
+
+// NewShardRouter creates a shard router over the named shards
+func NewShardRouter(config ShardRouterConfig, shards map[string]RequestProcessor) *ShardRouter {
+	names := make([]string, 0, len(shards))
+	for name := range shards {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	if config.VirtualNodes == 0 {
+		config.VirtualNodes = DefaultVirtualNodes
+	}
+
+	if config.ShardFunc == nil {
+		config.ShardFunc = NewHashRing(config.VirtualNodes, names...).Get
+	}
+
+	return &ShardRouter{
+		shards:     shards,
+		names:      names,
+		shardFunc:  config.ShardFunc,
+		bindingKey: config.BindingKey,
+	}
+}
+
+// shardKey returns the shard key from ctx, or from r's bindings
+func (s *ShardRouter) shardKey(ctx context.Context, r Request) (string, bool) {
+	if key, ok := ctx.Value(shardKeyKey{}).(string); ok {
+		return key, true
+	}
+
+	if s.bindingKey == "" {
+		return "", false
+	}
+
+	value, ok := requestBindings(r)[s.bindingKey]
+	if !ok {
+		return "", false
+	}
+	return fmt.Sprint(value), true
+}
+
+// ProcessRequest can process a raw gremlin request
+func (s *ShardRouter) ProcessRequest(ctx context.Context, r Request, onResponse ...OnResponse) error {
+	if all, _ := ctx.Value(allShardsKey{}).(bool); all {
+		return s.scatterGather(ctx, r, onResponse...)
+	}
+
+	key, ok := s.shardKey(ctx, r)
+	if !ok {
+		return clusterErrorNoShardKey
+	}
+
+	name := s.shardFunc(key)
+	shard, ok := s.shards[name]
+	if !ok {
+		return fmt.Errorf("shard key %q mapped to unknown shard %q", key, name)
+	}
+
+	return shard.ProcessRequest(ctx, r, onResponse...)
+}
+
+// scatterGather sends r to every shard and merges the responses into a single stream. Every
+// frame but the final frame of the last shard to finish is passed on as partial content.
+//
+// When a shard fails the other shards are cancelled and no more frames are passed on, so the stream
+// ends with the partial frames received so far and no final frame. The error names the shards that
+// failed; shards that were cancelled because of them are left out.
+func (s *ShardRouter) scatterGather(ctx context.Context, r Request, onResponse ...OnResponse) error {
+	shardCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var mu sync.Mutex
+	remaining := len(s.names)
+	failed := false
+
+	merge := func(resp *Response) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if failed {
+			return
+		}
+
+		if !resp.IsPartial() {
+			remaining--
+			if remaining > 0 {
+				if resp.Status.Code == StatusNoContent {
+					return
+				}
+				merged := *resp
+				merged.Status.Code = StatusPartialContent
+				resp = &merged
+			}
+		}
+
+		for _, or := range onResponse {
+			or(resp)
+		}
+	}
+
+	errs := make([]error, len(s.names))
+	var wg sync.WaitGroup
+	for i, name := range s.names {
+		wg.Add(1)
+		go func(i int, shard RequestProcessor) {
+			defer wg.Done()
+			err := shard.ProcessRequest(shardCtx, r, merge)
+			if err != nil {
+				mu.Lock()
+				failed = true
+				mu.Unlock()
+				cancel()
+			}
+			errs[i] = err
+		}(i, s.shards[name])
+	}
+	wg.Wait()
+
+	var merr, cancelled multiError
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+		shardErr := fmt.Errorf("shard %q: %v", s.names[i], err)
+		if errors.Is(err, context.Canceled) && ctx.Err() == nil {
+			cancelled = append(cancelled, shardErr)
+			continue
+		}
+		merr = append(merr, shardErr)
+	}
+	if len(merr) == 0 {
+		// A shard that reported cancellation by itself still failed the request
+		merr = cancelled
+	}
+	return merr.errOrNil()
+}
+
+// HashRing is a consistent hash ring mapping keys to names
+type HashRing struct {
+	points []uint32
+	owners map[uint32]string
+}
+
+// NewHashRing creates a hash ring with virtualNodes points per name
+func NewHashRing(virtualNodes int, names ...string) *HashRing {
+	h := &HashRing{
+		owners: map[uint32]string{},
+	}
+
+	for _, name := range names {
+		for i := 0; i < virtualNodes; i++ {
+			point := hashKey(name + "#" + strconv.Itoa(i))
+			if _, ok := h.owners[point]; ok {
+				continue
+			}
+			h.owners[point] = name
+			h.points = append(h.points, point)
+		}
+	}
+
+	sort.Slice(h.points, func(i, j int) bool { return h.points[i] < h.points[j] })
+
+	return h
+}
+
+// Get returns the name that owns key
+func (h *HashRing) Get(key string) string {
+	if len(h.points) == 0 {
+		return ""
+	}
+
+	point := hashKey(key)
+	i := sort.Search(len(h.points), func(i int) bool { return h.points[i] >= point })
+	if i == len(h.points) {
+		i = 0
+	}
+	return h.owners[h.points[i]]
+}
+
+func hashKey(key string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return h.Sum32()
+}
@@ -0,0 +1,127 @@
+package grmln
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// respondWith returns a processor that sends a partial frame and a final frame containing name
+func respondWith(name string) RequestProcessor {
+	return RequestProcessorFunc(func(ctx context.Context, r Request, onResponse ...OnResponse) error {
+		for _, code := range []StatusCode{StatusPartialContent, StatusSuccess} {
+			resp := &Response{
+				RequestID: r.RequestID,
+				Status:    ResponseStatus{Code: code},
+				Result:    ResponseResult{Data: json.RawMessage(fmt.Sprintf("[%q]", name))},
+			}
+			for _, or := range onResponse {
+				or(resp)
+			}
+		}
+		return nil
+	})
+}
+
+func TestHashRingStability(t *testing.T) {
+	before := NewHashRing(DefaultVirtualNodes, "a", "b", "c")
+	after := NewHashRing(DefaultVirtualNodes, "a", "b")
+
+	counts := map[string]int{}
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("tenant-%d", i)
+		owner := before.Get(key)
+		counts[owner]++
+
+		if owner != "c" && after.Get(key) != owner {
+			t.Fatalf("key %q moved from %q to %q when removing an unrelated shard", key, owner, after.Get(key))
+		}
+	}
+
+	for _, name := range []string{"a", "b", "c"} {
+		if counts[name] == 0 {
+			t.Fatalf("shard %q received no keys: %v", name, counts)
+		}
+	}
+}
+
+func TestShardRouter(t *testing.T) {
+	s := NewShardRouter(ShardRouterConfig{
+		BindingKey: "tenant",
+		ShardFunc: func(key string) string {
+			return "shard-" + key
+		},
+	}, map[string]RequestProcessor{
+		"shard-1": respondWith("1"),
+		"shard-2": respondWith("2"),
+	})
+
+	var data []string
+	onResponse := func(resp *Response) {
+		data = append(data, string(resp.Result.Data))
+	}
+
+	r := NewRequest("", processorDefault, opEval, EvalArgs{Gremlin: "g.V()", Bindings: Bindings{"tenant": 2}})
+	if err := s.ProcessRequest(context.Background(), r, onResponse); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(data) != 2 || data[0] != `["2"]` {
+		t.Fatalf("expected responses from shard-2 but got %v", data)
+	}
+
+	if err := s.ProcessRequest(context.Background(), NewRequest("", processorDefault, opEval, EvalArgs{})); !IsNoShardKey(err) {
+		t.Fatalf("expected no shard key error but got %v", err)
+	}
+}
+
+func TestShardRouterScatterGather(t *testing.T) {
+	s := NewShardRouter(ShardRouterConfig{}, map[string]RequestProcessor{
+		"a": respondWith("a"),
+		"b": respondWith("b"),
+		"c": respondWith("c"),
+	})
+
+	var frames, final int
+	err := s.ProcessRequest(WithAllShards(context.Background()), NewRequest("", processorDefault, opEval, EvalArgs{}), func(resp *Response) {
+		frames++
+		if !resp.IsPartial() {
+			final++
+		}
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if frames != 6 || final != 1 {
+		t.Fatalf("expected 6 frames with 1 final frame but got %d frames with %d final", frames, final)
+	}
+}
+
+// TestShardRouterScatterGatherFailure ensures a failed shard cancels the others and ends the stream without a final frame
+func TestShardRouterScatterGatherFailure(t *testing.T) {
+	s := NewShardRouter(ShardRouterConfig{}, map[string]RequestProcessor{
+		"a": respondWith("a"),
+		"b": RequestProcessorFunc(func(ctx context.Context, r Request, onResponse ...OnResponse) error {
+			return errors.New("failed")
+		}),
+		"c": RequestProcessorFunc(func(ctx context.Context, r Request, onResponse ...OnResponse) error {
+			<-ctx.Done()
+			return ctx.Err()
+		}),
+	})
+
+	final := 0
+	err := s.ProcessRequest(WithAllShards(context.Background()), NewRequest("", processorDefault, opEval, EvalArgs{}), func(resp *Response) {
+		if !resp.IsPartial() {
+			final++
+		}
+	})
+	if err == nil || err.Error() != `shard "b": failed` {
+		t.Fatalf("expected only the failed shard's error but got %v", err)
+	}
+	if final != 0 {
+		t.Fatalf("expected no final frame but got %d", final)
+	}
+}
@@ -0,0 +1,292 @@
+package grmln
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// Span attribute keys
+const (
+	AttributeHost             = "grmln.host"
+	AttributeRequestID        = "grmln.request_id"
+	AttributeProcessor        = "grmln.processor"
+	AttributeOperation        = "grmln.op"
+	AttributeScriptHash       = "grmln.script_hash"
+	AttributeBatchSize        = "grmln.batch_size"
+	AttributeFrames           = "grmln.frames"
+	AttributeTimeToFirstFrame = "grmln.time_to_first_frame_ms"
+	AttributeStatusCode       = "grmln.status_code"
+)
+
+type spanKey struct{}
+
+// SpanStatus is the status of a span
+type SpanStatus int
+
+// Span statuses
+const (
+	SpanStatusUnset SpanStatus = iota
+	SpanStatusOK
+	SpanStatusError
+)
+
+// Attribute is a key value pair attached to a span
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// Tracer starts spans. It mirrors the shape of an OpenTelemetry tracer so adapting one takes a few lines
+type Tracer interface {
+	// Start starts a span that is a child of any span in ctx, and returns a context containing the new span
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span is a single traced operation
+type Span interface {
+	SetAttributes(attrs ...Attribute)
+	AddEvent(name string, attrs ...Attribute)
+	RecordError(err error)
+	SetStatus(status SpanStatus, description string)
+	End()
+}
+
+// ContextWithSpan returns a context containing span. Tracers use this to propagate spans
+func ContextWithSpan(ctx context.Context, span Span) context.Context {
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+// SpanFromContext returns the span in ctx, or a span that does nothing if there isn't one
+func SpanFromContext(ctx context.Context) Span {
+	if span, ok := ctx.Value(spanKey{}).(Span); ok {
+		return span
+	}
+	return noopSpan{}
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SetAttributes(attrs ...Attribute)                {}
+func (noopSpan) AddEvent(name string, attrs ...Attribute)        {}
+func (noopSpan) RecordError(err error)                           {}
+func (noopSpan) SetStatus(status SpanStatus, description string) {}
+func (noopSpan) End()                                            {}
+
+// ScriptHash returns a short, stable hash of a gremlin script so scripts can be correlated without recording them
+func ScriptHash(gremlin string) string {
+	sum := sha256.Sum256([]byte(gremlin))
+	return hex.EncodeToString(sum[:8])
+}
+
+// Tracing returns a middleware that starts a span for every request. Cluster and Conn add the host to the span
+func Tracing(tracer Tracer) Middleware {
+	return func(next RequestProcessor) RequestProcessor {
+		return RequestProcessorFunc(func(ctx context.Context, r Request, ors ...OnResponse) error {
+			ctx, span := tracer.Start(ctx, "gremlin "+r.Operation)
+			defer span.End()
+
+			attrs := []Attribute{
+				{Key: AttributeRequestID, Value: r.RequestID},
+				{Key: AttributeProcessor, Value: r.Processor},
+				{Key: AttributeOperation, Value: r.Operation},
+			}
+			if gremlin, ok := requestGremlin(r); ok {
+				attrs = append(attrs, Attribute{Key: AttributeScriptHash, Value: ScriptHash(gremlin)})
+			}
+			if batchSize, ok := requestBatchSize(r); ok {
+				attrs = append(attrs, Attribute{Key: AttributeBatchSize, Value: batchSize})
+			}
+			span.SetAttributes(attrs...)
+
+			start := time.Now()
+			frames := 0
+			var status StatusCode
+
+			err := next.ProcessRequest(ctx, r, func(resp *Response) {
+				if frames == 0 {
+					span.AddEvent("first frame")
+					span.SetAttributes(Attribute{Key: AttributeTimeToFirstFrame, Value: time.Since(start).Seconds() * 1000})
+				}
+				frames++
+				status = resp.Status.Code
+
+				for _, or := range ors {
+					or(resp)
+				}
+			})
+
+			if re, ok := err.(responseError); ok {
+				status = re.response.Status.Code
+			}
+
+			span.SetAttributes(
+				Attribute{Key: AttributeFrames, Value: frames},
+				Attribute{Key: AttributeStatusCode, Value: int(status)},
+			)
+
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(SpanStatusError, err.Error())
+				return err
+			}
+
+			span.SetStatus(SpanStatusOK, "")
+			return nil
+		})
+	}
+}
+
+// requestBatchSize returns the batch size requested by eval requests
+func requestBatchSize(r Request) (int, bool) {
+	switch args := r.Arguments.(type) {
+	case EvalArgs:
+		return args.BatchSize, true
+	case TransactionEvalArgs:
+		return args.BatchSize, true
+	case SessionEvalArgs:
+		return args.BatchSize, true
+	}
+	return 0, false
+}
+
+// RecordedSpan is a span captured by a SpanRecorder
+type RecordedSpan struct {
+	TraceID    string
+	SpanID     string
+	ParentID   string
+	Name       string
+	Attributes map[string]interface{}
+	Events     []RecordedEvent
+	Errors     []error
+	Status     SpanStatus
+	StatusDesc string
+	Start      time.Time
+	End        time.Time
+}
+
+// RecordedEvent is an event captured by a SpanRecorder
+type RecordedEvent struct {
+	Name       string
+	Time       time.Time
+	Attributes map[string]interface{}
+}
+
+// SpanRecorder is an in-memory Tracer for tests
+type SpanRecorder struct {
+	mu    sync.Mutex
+	ended []RecordedSpan
+}
+
+// NewSpanRecorder creates a new span recorder
+func NewSpanRecorder() *SpanRecorder {
+	return &SpanRecorder{}
+}
+
+// Start implements Tracer
+func (r *SpanRecorder) Start(ctx context.Context, name string) (context.Context, Span) {
+	span := &recorderSpan{
+		recorder: r,
+		span: RecordedSpan{
+			SpanID:     randomID(8),
+			Name:       name,
+			Attributes: map[string]interface{}{},
+			Start:      time.Now(),
+		},
+	}
+
+	if parent, ok := ctx.Value(spanKey{}).(*recorderSpan); ok {
+		span.span.TraceID = parent.span.TraceID
+		span.span.ParentID = parent.span.SpanID
+	} else {
+		span.span.TraceID = randomID(16)
+	}
+
+	return ContextWithSpan(ctx, span), span
+}
+
+// Spans returns every span that has ended, in the order they ended
+func (r *SpanRecorder) Spans() []RecordedSpan {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	spans := make([]RecordedSpan, len(r.ended))
+	copy(spans, r.ended)
+	return spans
+}
+
+type recorderSpan struct {
+	recorder *SpanRecorder
+
+	mu    sync.Mutex
+	span  RecordedSpan
+	ended bool
+}
+
+func attributeMap(attrs []Attribute) map[string]interface{} {
+	m := make(map[string]interface{}, len(attrs))
+	for _, a := range attrs {
+		m[a.Key] = a.Value
+	}
+	return m
+}
+
+func (s *recorderSpan) SetAttributes(attrs ...Attribute) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, a := range attrs {
+		s.span.Attributes[a.Key] = a.Value
+	}
+}
+
+func (s *recorderSpan) AddEvent(name string, attrs ...Attribute) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.span.Events = append(s.span.Events, RecordedEvent{
+		Name:       name,
+		Time:       time.Now(),
+		Attributes: attributeMap(attrs),
+	})
+}
+
+func (s *recorderSpan) RecordError(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.span.Errors = append(s.span.Errors, err)
+}
+
+func (s *recorderSpan) SetStatus(status SpanStatus, description string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.span.Status = status
+	s.span.StatusDesc = description
+}
+
+func (s *recorderSpan) End() {
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.span.End = time.Now()
+	span := s.span
+	s.mu.Unlock()
+
+	s.recorder.mu.Lock()
+	defer s.recorder.mu.Unlock()
+	s.recorder.ended = append(s.recorder.ended, span)
+}
+
+func randomID(n int) string {
+	id := make([]byte, n)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
@@ -0,0 +1,56 @@
+package grmln
+
+import (
+	"context"
+	"testing"
+)
+
+func TestTracing(t *testing.T) {
+	recorder := NewSpanRecorder()
+
+	ctx, parent := recorder.Start(context.Background(), "parent")
+
+	annotated := RequestProcessorFunc(func(ctx context.Context, r Request, onResponse ...OnResponse) error {
+		SpanFromContext(ctx).SetAttributes(Attribute{Key: AttributeHost, Value: "ws://host:8182/gremlin"})
+		return respondWith("a").ProcessRequest(ctx, r, onResponse...)
+	})
+
+	r := NewRequest("id", processorDefault, opEval, EvalArgs{OpArgs: OpArgs{BatchSize: 64}, Gremlin: "g.V()"})
+	if err := Chain(annotated, Tracing(recorder)).ProcessRequest(ctx, r); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	parent.End()
+
+	spans := recorder.Spans()
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans but got %d", len(spans))
+	}
+
+	span := spans[0]
+	if span.ParentID != spans[1].SpanID || span.TraceID != spans[1].TraceID {
+		t.Fatal("expected request span to be a child of the context span")
+	}
+
+	expected := map[string]interface{}{
+		AttributeHost:       "ws://host:8182/gremlin",
+		AttributeRequestID:  "id",
+		AttributeOperation:  opEval,
+		AttributeScriptHash: ScriptHash("g.V()"),
+		AttributeBatchSize:  64,
+		AttributeFrames:     2,
+		AttributeStatusCode: int(StatusSuccess),
+	}
+	for k, v := range expected {
+		if span.Attributes[k] != v {
+			t.Errorf("expected %s to be %v but got %v", k, v, span.Attributes[k])
+		}
+	}
+
+	if _, ok := span.Attributes[AttributeTimeToFirstFrame]; !ok {
+		t.Errorf("expected %s to be recorded", AttributeTimeToFirstFrame)
+	}
+
+	if span.Status != SpanStatusOK {
+		t.Errorf("expected status %v but got %v", SpanStatusOK, span.Status)
+	}
+}